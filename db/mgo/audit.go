@@ -0,0 +1,444 @@
+package mgo
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/arwoosa/vulpes/ezgrpc/interceptor"
+	"github.com/arwoosa/vulpes/log"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Actions recorded in the audit trail.
+const (
+	AuditInsert  = "insert"
+	AuditUpdate  = "update"
+	AuditReplace = "replace"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// Audited is implemented by models whose updates and deletes are recorded in the audit trail.
+// The method is only a marker:
+//
+//	func (*Order) Audited() {}
+type Audited interface {
+	Audited()
+}
+
+// isAudited reports whether the model opted in to auditing.
+func isAudited(doc any) bool {
+	_, ok := doc.(Audited)
+	return ok
+}
+
+// AuditEntry records one change of a document. Before and After hold only the fields
+// that changed; a field missing from one side did not exist at that point.
+// Values are stored as written, so encrypted fields stay encrypted.
+type AuditEntry struct {
+	ID         bson.ObjectID `bson:"_id,omitempty"`
+	Collection string        `bson:"collection"`
+	DocumentID any           `bson:"documentId"`
+	Action     string        `bson:"action"`
+	Actor      string        `bson:"actor,omitempty"`
+	RequestID  string        `bson:"requestId,omitempty"`
+	At         time.Time     `bson:"at"`
+	Before     bson.M        `bson:"before,omitempty"`
+	After      bson.M        `bson:"after,omitempty"`
+}
+
+func (e *AuditEntry) C() string { return auditConfig.collection }
+
+// Indexes supports History; register the entry with RegisterIndex to create it.
+func (e *AuditEntry) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{{Keys: bson.D{
+		{Key: "collection", Value: 1},
+		{Key: "documentId", Value: 1},
+		{Key: "at", Value: -1},
+	}}}
+}
+func (e *AuditEntry) Validate() error { return nil }
+func (e *AuditEntry) GetId() any      { return e.ID }
+func (e *AuditEntry) SetId(id any)    { e.ID = id.(bson.ObjectID) }
+
+// AuditOption configures the audit trail.
+type AuditOption func(*auditSettings)
+
+type auditSettings struct {
+	collection string
+	actor      func(ctx context.Context) string
+	limit      int
+}
+
+// auditConfig holds the settings applied by ConfigureAudit.
+var auditConfig = auditSettings{
+	collection: "audit_log",
+	limit:      1000,
+}
+
+// ConfigureAudit changes the audit trail settings. It should be called once at startup.
+func ConfigureAudit(opts ...AuditOption) {
+	for _, opt := range opts {
+		opt(&auditConfig)
+	}
+}
+
+// WithAuditCollection stores the audit entries in the named collection instead of "audit_log".
+func WithAuditCollection(name string) AuditOption {
+	return func(s *auditSettings) {
+		s.collection = name
+	}
+}
+
+// WithAuditActor sets how the actor of a change is determined when ctx has none set
+// with WithActor, e.g. the user of the gRPC caller:
+//
+//	mgo.ConfigureAudit(mgo.WithAuditActor(func(ctx context.Context) string {
+//		if user, _ := ezgrpc.GetUser(ctx); user != nil {
+//			return user.ID
+//		}
+//		return ""
+//	}))
+func WithAuditActor(actor func(ctx context.Context) string) AuditOption {
+	return func(s *auditSettings) {
+		s.actor = actor
+	}
+}
+
+// WithAuditLimit caps the number of documents whose before states UpdateMany and
+// DeleteMany hold in memory for the audit trail. Writes matching more documents still
+// apply to all of them, but only the first n are recorded. The default is 1000.
+func WithAuditLimit(n int) AuditOption {
+	return func(s *auditSettings) {
+		s.limit = max(n, 1)
+	}
+}
+
+type ctxKeyActor struct{}
+
+// WithActor returns a context recording actor as the author of changes, e.g. for jobs
+// that do not run on behalf of a gRPC caller.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, ctxKeyActor{}, actor)
+}
+
+// actorOf returns the actor set with WithActor, or else the one found by the
+// configured WithAuditActor.
+func actorOf(ctx context.Context) string {
+	if actor, ok := ctx.Value(ctxKeyActor{}).(string); ok {
+		return actor
+	}
+	if auditConfig.actor != nil {
+		return auditConfig.actor(ctx)
+	}
+	return ""
+}
+
+// auditRecord captures the documents a write is about to change.
+type auditRecord struct {
+	ctx        context.Context
+	ds         Datastore
+	collection string
+	action     string
+	ids        []any
+	before     []bson.M
+}
+
+// beginAudit loads the documents matching filter before a write on an audited model.
+// It returns filter narrowed to the loaded documents, so the write changes exactly
+// what was loaded, and a record to finish once the write succeeded. Models that are
+// not audited get the filter back unchanged and a nil record.
+// Single-document writes load the first match in sort order. When more documents than
+// the audit limit match, only the first ones are recorded and the filter is returned
+// unchanged, see WithAuditLimit.
+func beginAudit[F any](ctx context.Context, ds Datastore, doc DocInter, action string, filter F, many bool, sort any) (F, *auditRecord, error) {
+	if !isAudited(doc) {
+		return filter, nil, nil
+	}
+	var query any = filter
+	if query == nil {
+		query = bson.D{}
+	}
+	findOpts := options.Find()
+	if sort != nil {
+		findOpts.SetSort(sort)
+	}
+	if many {
+		findOpts.SetLimit(int64(auditConfig.limit) + 1)
+	} else {
+		findOpts.SetLimit(1)
+	}
+	cursor, err := ds.Find(ctx, doc.C(), query, findOpts)
+	if err != nil {
+		return filter, nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	record := &auditRecord{ctx: ctx, ds: ds, collection: doc.C(), action: action}
+	if err := cursor.All(ctx, &record.before); err != nil {
+		return filter, nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	partial := len(record.before) > auditConfig.limit
+	if partial {
+		record.before = record.before[:auditConfig.limit]
+		log.Warn("mongodb audit trail limited to the first documents of a write",
+			log.String("collection", doc.C()),
+			log.Int("limit", auditConfig.limit),
+			log.String("request_id", interceptor.GetRequestID(ctx)),
+		)
+	}
+	for _, d := range record.before {
+		record.ids = append(record.ids, d["_id"])
+	}
+	if partial || len(record.ids) == 0 {
+		return filter, record, nil
+	}
+	cond := bson.E{Key: "_id", Value: bson.D{{Key: "$in", Value: bson.A(record.ids)}}}
+	if !many {
+		cond = bson.E{Key: "_id", Value: record.ids[0]}
+	}
+	narrowed, ok := andFilter(query, cond).(F)
+	if !ok {
+		return filter, nil, fmt.Errorf("%w: filter %T cannot be narrowed for the audit trail", ErrInvalidDocument, filter)
+	}
+	return narrowed, record, nil
+}
+
+// refuseAudited refuses bulk writes changing documents of an audited model, which the
+// audit trail would not record.
+func refuseAudited(doc any) error {
+	if !isAudited(doc) {
+		return nil
+	}
+	return fmt.Errorf("%w: %T is audited, its documents cannot be changed by bulk operations", ErrInvalidDocument, doc)
+}
+
+// finish records an entry for every changed document. upsertedID is the _id of the
+// document a single-document upsert inserted, if any. Failing to write the entries is logged,
+// since the change itself has already been applied.
+func (r *auditRecord) finish(upsertedID any) {
+	if r == nil {
+		return
+	}
+	ids := r.ids
+	if upsertedID != nil && len(ids) == 0 {
+		ids = []any{upsertedID}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	cursor, err := r.ds.Find(r.ctx, r.collection, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: bson.A(ids)}}}})
+	var docs []bson.M
+	if err == nil {
+		err = cursor.All(r.ctx, &docs)
+	}
+	if err != nil {
+		logAuditFailure(r.ctx, r.collection, r.action, err)
+		return
+	}
+	// Hard-deleted documents are missing and have no after state.
+	after := make(map[any]bson.M, len(docs))
+	for _, d := range docs {
+		after[d["_id"]] = d
+	}
+	var entries []DocInter
+	for i, id := range ids {
+		var before bson.M
+		action := r.action
+		if i < len(r.before) {
+			before = r.before[i]
+		} else {
+			action = AuditInsert
+		}
+		if entry := newAuditEntry(r.ctx, r.collection, id, action, before, after[id]); entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return
+	}
+	if _, err := r.ds.InsertMany(r.ctx, auditConfig.collection, entries); err != nil {
+		logAuditFailure(r.ctx, r.collection, r.action, err)
+	}
+}
+
+func logAuditFailure(ctx context.Context, collection, action string, err error) {
+	log.Error("mongodb audit trail not written",
+		log.String("collection", collection),
+		log.String("action", action),
+		log.String("request_id", interceptor.GetRequestID(ctx)),
+		log.Err(err),
+	)
+}
+
+// newAuditEntry builds the entry for a change from before to after, or returns nil
+// when no field changed.
+func newAuditEntry(ctx context.Context, collection string, id any, action string, before, after bson.M) *AuditEntry {
+	changedBefore, changedAfter := diffDocs(before, after)
+	if len(changedBefore) == 0 && len(changedAfter) == 0 {
+		return nil
+	}
+	return &AuditEntry{
+		Collection: collection,
+		DocumentID: id,
+		Action:     action,
+		Actor:      actorOf(ctx),
+		RequestID:  interceptor.GetRequestID(ctx),
+		At:         nowFunc(),
+		Before:     changedBefore,
+		After:      changedAfter,
+	}
+}
+
+// diffDocs returns the top-level fields that differ between before and after, with
+// their value on each side. A field missing on one side is left out of that side.
+func diffDocs(before, after bson.M) (bson.M, bson.M) {
+	changedBefore, changedAfter := bson.M{}, bson.M{}
+	for k, v := range before {
+		av, ok := after[k]
+		if ok && reflect.DeepEqual(v, av) {
+			continue
+		}
+		changedBefore[k] = v
+		if ok {
+			changedAfter[k] = av
+		}
+	}
+	for k, v := range after {
+		if _, ok := before[k]; !ok {
+			changedAfter[k] = v
+		}
+	}
+	return changedBefore, changedAfter
+}
+
+// History returns the audit entries of the document identified by doc's _id, newest first.
+func History[T DocInter](ctx context.Context, doc T) ([]*AuditEntry, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return nil, ErrNotConnected
+	}
+	if err := tenantOwns(ctx, ds, doc); err != nil {
+		return nil, err
+	}
+	return history(ctx, ds, doc.C(), doc.GetId())
+}
+
+func history(ctx context.Context, ds Datastore, collection string, id any) ([]*AuditEntry, error) {
+	filter := bson.D{{Key: "collection", Value: collection}, {Key: "documentId", Value: id}}
+	sort := bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}}
+	cursor, err := ds.Find(ctx, auditConfig.collection, filter, options.Find().SetSort(sort))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	var entries []*AuditEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return entries, nil
+}
+
+// RestoreVersion returns the document identified by doc's _id to the state it had
+// before the audit entry entryID, undoing that change and every later one. This also
+// brings back deleted documents, and deletes documents that did not exist yet. doc
+// receives the restored document, and the restore is recorded in the audit trail.
+// It returns ErrNotFound when the entry is not part of the document's history.
+func RestoreVersion[T DocInter](ctx context.Context, doc T, entryID bson.ObjectID) error {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return ErrNotConnected
+	}
+	if err := tenantOwns(ctx, ds, doc); err != nil {
+		return err
+	}
+	id := doc.GetId()
+	entries, err := history(ctx, ds, doc.C(), id)
+	if err != nil {
+		return err
+	}
+	target := slices.IndexFunc(entries, func(e *AuditEntry) bool { return e.ID == entryID })
+	if target < 0 {
+		return fmt.Errorf("%w: audit entry %s", ErrNotFound, entryID.Hex())
+	}
+
+	cursor, err := ds.Find(ctx, doc.C(), bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	var current []bson.M
+	if err := cursor.All(ctx, &current); err != nil {
+		return fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	before := bson.M{}
+	if len(current) > 0 {
+		before = current[0]
+	}
+	state := maps.Clone(before)
+	for _, e := range entries[:target+1] {
+		for k := range e.After {
+			delete(state, k)
+		}
+		maps.Copy(state, e.Before)
+	}
+
+	if len(state) == 0 {
+		if len(before) > 0 {
+			if _, err := ds.DeleteOne(ctx, doc.C(), bson.D{{Key: "_id", Value: id}}); err != nil {
+				return writeError(err)
+			}
+		}
+	} else if err := writeState(ctx, ds, doc.C(), id, before, state); err != nil {
+		return err
+	}
+	if entry := newAuditEntry(ctx, doc.C(), id, AuditRestore, before, state); entry != nil {
+		if _, err := ds.InsertMany(ctx, auditConfig.collection, []DocInter{entry}); err != nil {
+			logAuditFailure(ctx, doc.C(), AuditRestore, err)
+		}
+	}
+	if len(state) == 0 {
+		return nil
+	}
+	raw, err := bson.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	if err := bson.Unmarshal(raw, doc); err != nil {
+		return fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	_, err = decryptDoc(ctx, doc)
+	return err
+}
+
+// writeState overwrites the stored document id, which currently is current, with state,
+// inserting it if it does not exist.
+func writeState(ctx context.Context, ds Datastore, collection string, id any, current, state bson.M) error {
+	set := bson.D{}
+	for _, k := range slices.Sorted(maps.Keys(state)) {
+		if k != "_id" {
+			set = append(set, bson.E{Key: k, Value: state[k]})
+		}
+	}
+	unset := bson.D{}
+	for _, k := range slices.Sorted(maps.Keys(current)) {
+		if _, ok := state[k]; !ok {
+			unset = append(unset, bson.E{Key: k, Value: ""})
+		}
+	}
+	update := bson.D{}
+	if len(set) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
+	if len(unset) > 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+	if len(update) == 0 {
+		return nil
+	}
+	_, err := ds.Upsert(ctx, collection, bson.D{{Key: "_id", Value: id}}, update)
+	return writeError(err)
+}
@@ -0,0 +1,172 @@
+package mgo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+	"github.com/arwoosa/vulpes/ezgrpc"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"google.golang.org/grpc/metadata"
+)
+
+// testInvoice records its changes in the audit trail.
+type testInvoice struct {
+	ID     bson.ObjectID `bson:"_id,omitempty"`
+	Number string        `bson:"number"`
+	Amount int           `bson:"amount"`
+	Note   string        `bson:"note,omitempty"`
+}
+
+func (i *testInvoice) C() string                   { return "invoices" }
+func (i *testInvoice) Indexes() []mongo.IndexModel { return nil }
+func (i *testInvoice) Validate() error             { return nil }
+func (i *testInvoice) GetId() any                  { return i.ID }
+func (i *testInvoice) SetId(id any)                { i.ID = id.(bson.ObjectID) }
+func (i *testInvoice) Audited()                    {}
+
+func TestAuditTrail(t *testing.T) {
+	store := mgo.NewMemoryDatastore()
+	defer mgo.SetDatastore(store)()
+	mgo.ConfigureAudit(mgo.WithAuditActor(func(ctx context.Context) string {
+		if user, _ := ezgrpc.GetUser(ctx); user != nil {
+			return user.ID
+		}
+		return ""
+	}))
+	defer mgo.ConfigureAudit(mgo.WithAuditActor(nil))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("user-id", "u-42"))
+
+	invoice, err := mgo.Save(ctx, &testInvoice{Number: "INV-1", Amount: 100})
+	assert.NoError(t, err)
+	history, err := mgo.History(ctx, invoice)
+	assert.NoError(t, err)
+	assert.Empty(t, history, "inserts are not audited")
+
+	_, err = mgo.UpdateById(ctx, invoice, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "amount", Value: 120},
+		{Key: "note", Value: "corrected"},
+	}}})
+	assert.NoError(t, err)
+	_, err = mgo.UpdateById(mgo.WithActor(ctx, "billing-job"), invoice, bson.D{{Key: "$set", Value: bson.D{{Key: "amount", Value: 150}}}})
+	assert.NoError(t, err)
+
+	t.Run("Records changed fields and actor", func(t *testing.T) {
+		history, err := mgo.History(ctx, invoice)
+		assert.NoError(t, err)
+		assert.Len(t, history, 2)
+
+		first := history[1]
+		assert.Equal(t, mgo.AuditUpdate, first.Action)
+		assert.Equal(t, "invoices", first.Collection)
+		assert.Equal(t, "u-42", first.Actor)
+		assert.Equal(t, bson.M{"amount": int32(100)}, first.Before)
+		assert.Equal(t, bson.M{"amount": int32(120), "note": "corrected"}, first.After)
+		assert.Equal(t, "billing-job", history[0].Actor)
+	})
+
+	t.Run("Restores the version before an entry", func(t *testing.T) {
+		history, err := mgo.History(ctx, invoice)
+		assert.NoError(t, err)
+
+		restored := &testInvoice{ID: invoice.ID}
+		assert.NoError(t, mgo.RestoreVersion(ctx, restored, history[1].ID))
+		assert.Equal(t, 100, restored.Amount)
+		assert.Empty(t, restored.Note)
+
+		stored := &testInvoice{ID: invoice.ID}
+		assert.NoError(t, mgo.FindById(ctx, stored))
+		assert.Equal(t, restored, stored)
+
+		history, err = mgo.History(ctx, invoice)
+		assert.NoError(t, err)
+		assert.Equal(t, mgo.AuditRestore, history[0].Action)
+	})
+
+	t.Run("Deletes and restores", func(t *testing.T) {
+		_, err := mgo.DeleteById(ctx, invoice)
+		assert.NoError(t, err)
+
+		history, err := mgo.History(ctx, invoice)
+		assert.NoError(t, err)
+		assert.Equal(t, mgo.AuditDelete, history[0].Action)
+		assert.Equal(t, "INV-1", history[0].Before["number"])
+		assert.Empty(t, history[0].After)
+
+		restored := &testInvoice{ID: invoice.ID}
+		assert.NoError(t, mgo.RestoreVersion(ctx, restored, history[0].ID))
+		assert.Equal(t, "INV-1", restored.Number)
+		assert.NoError(t, mgo.FindById(ctx, &testInvoice{ID: invoice.ID}))
+	})
+
+	t.Run("Unknown entry", func(t *testing.T) {
+		err := mgo.RestoreVersion(ctx, &testInvoice{ID: invoice.ID}, bson.NewObjectID())
+		assert.ErrorIs(t, err, mgo.ErrNotFound)
+	})
+}
+
+func TestAuditUpdateMany(t *testing.T) {
+	store := mgo.NewMemoryDatastore()
+	defer mgo.SetDatastore(store)()
+	ctx := context.Background()
+
+	_, err := mgo.InsertMany(ctx, []*testInvoice{{Number: "A", Amount: 1}, {Number: "B", Amount: 2}, {Number: "C", Amount: 3}})
+	assert.NoError(t, err)
+
+	_, err = mgo.UpdateMany(ctx, &testInvoice{},
+		bson.D{{Key: "amount", Value: bson.D{{Key: "$gte", Value: 2}}}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "note", Value: "due"}}}})
+	assert.NoError(t, err)
+	_, err = mgo.Upsert(ctx, &testInvoice{},
+		bson.D{{Key: "number", Value: "D"}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "amount", Value: 4}}}})
+	assert.NoError(t, err)
+
+	cursor, err := store.Find(ctx, "audit_log", bson.D{})
+	assert.NoError(t, err)
+	var entries []mgo.AuditEntry
+	assert.NoError(t, cursor.All(ctx, &entries))
+	assert.Len(t, entries, 3)
+	assert.Equal(t, mgo.AuditInsert, entries[2].Action, "upserts that insert are recorded")
+
+	// Models without Audited are not recorded.
+	_, err = mgo.UpdateMany(ctx, &testAccount{}, bson.D{}, bson.D{{Key: "$set", Value: bson.D{{Key: "score", Value: 1}}}})
+	assert.NoError(t, err)
+	count, err := store.Find(ctx, "audit_log", bson.D{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count.RemainingBatchLength())
+}
+
+func TestAuditLimits(t *testing.T) {
+	store := mgo.NewMemoryDatastore()
+	defer mgo.SetDatastore(store)()
+	ctx := context.Background()
+	_, err := mgo.InsertMany(ctx, []*testInvoice{{Number: "A", Amount: 1}, {Number: "B", Amount: 2}, {Number: "C", Amount: 3}})
+	assert.NoError(t, err)
+
+	mgo.ConfigureAudit(mgo.WithAuditLimit(2))
+	defer mgo.ConfigureAudit(mgo.WithAuditLimit(1000))
+	res, err := mgo.UpdateMany(ctx, &testInvoice{}, bson.D{}, bson.D{{Key: "$set", Value: bson.D{{Key: "note", Value: "checked"}}}})
+	assert.NoError(t, err, "the write does not fail over the limit")
+	assert.Equal(t, int64(3), res.ModifiedCount, "every document is changed")
+	cursor, err := store.Find(ctx, "audit_log", bson.D{})
+	assert.NoError(t, err)
+	var entries []mgo.AuditEntry
+	assert.NoError(t, cursor.All(ctx, &entries))
+	assert.Len(t, entries, 2, "only the documents within the limit are recorded")
+
+	t.Run("Bulk operations", func(t *testing.T) {
+		bulk, err := mgo.NewBulkOperation("invoices", mgo.WithModel(&testInvoice{}))
+		assert.NoError(t, err)
+		_, err = bulk.UpdateMany(bson.D{}, bson.D{{Key: "$set", Value: bson.D{{Key: "note", Value: "x"}}}}).Execute(ctx)
+		assert.ErrorIs(t, err, mgo.ErrInvalidDocument)
+
+		bulk, err = mgo.NewBulkOperation("invoices")
+		assert.NoError(t, err)
+		_, err = bulk.InsertOne(&testInvoice{Number: "D"}).Execute(ctx)
+		assert.NoError(t, err, "inserts are not audited")
+	})
+}
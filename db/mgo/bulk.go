@@ -2,40 +2,84 @@ package mgo
 
 import (
 	"context"
+	"errors"
 	"fmt"
-
-	"github.com/arwoosa/vulpes/log"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 // BulkOperation provides a fluent builder for constructing and executing
 // bulk write operations, leveraging MongoDB's BulkWrite capabilities.
 // It allows combining multiple insert, update, and delete operations into a single request.
 type bulkOperation struct {
+	// cname is the collection the operations write to.
+	cname      string
 	operations []mongo.WriteModel
-	collection *mongo.Collection
+	// write executes the given operations against the underlying store.
+	write func(ctx context.Context, models []mongo.WriteModel, ordered bool) (*mongo.BulkWriteResult, error)
+	// model is the optional model the operation is bound to, see WithModel.
+	model DocInter
+	// chunkSize caps the number of operations per request; 0 sends them all at once.
+	chunkSize int
+	unordered bool
+}
+
+// BulkOption configures a bulk operation.
+type BulkOption func(*bulkOperation)
+
+// WithModel binds the bulk operation to a model so that model-level behaviour
+// also applies to operations that only receive filters and updates,
+// e.g. refreshing `updatedAt` for models embedding Timestamps, running the
+// BeforeUpdate and BeforeDelete hooks of the model, or encrypting the values of its
+// encrypted fields in filters and updates.
+func WithModel(doc DocInter) BulkOption {
+	return func(b *bulkOperation) {
+		b.model = doc
+	}
+}
+
+// WithChunkSize splits the operations into requests of at most size operations,
+// keeping huge batches within sensible request sizes. Chunks are sent one after another.
+func WithChunkSize(size int) BulkOption {
+	return func(b *bulkOperation) {
+		b.chunkSize = max(size, 0)
+	}
+}
+
+// WithUnordered lets the server execute the operations in any order and carry on
+// after a failed operation. By default operations run in order and stop at the first failure.
+func WithUnordered() BulkOption {
+	return func(b *bulkOperation) {
+		b.unordered = true
+	}
 }
 
 // NewBulkOperation creates a new builder for a bulk operation on a specific collection.
 // cname: The name of the collection to perform operations on.
-func NewBulkOperation(cname string) (BulkOperator, error) {
-	if dataStore == nil {
+// opts: Optional settings such as WithModel. A model bound to a named datastore
+// with DatastoreBinder routes the operation to that datastore.
+func NewBulkOperation(cname string, opts ...BulkOption) (BulkOperator, error) {
+	probe := &bulkOperation{}
+	for _, opt := range opts {
+		opt(probe)
+	}
+	ds := storeFor(probe.model)
+	if ds == nil {
 		return nil, ErrNotConnected
 	}
-	return dataStore.NewBulkOperation(cname), nil
+	return ds.NewBulkOperation(cname, opts...), nil
 }
 
 // InsertOne adds an InsertOne operation to the bulk request.
-// The provided document will be validated before being added.
+// The document is validated in Execute; an invalid one is reported as a failed operation.
+// Documents embedding Timestamps get their CreatedAt and UpdatedAt fields set in Execute.
 func (b *bulkOperation) InsertOne(doc DocInter) BulkOperator {
-	if err := doc.Validate(); err != nil {
-		log.Warn("Invalid document in bulk operation: " + err.Error())
-		// To maintain the fluent API, we don't return an error here.
-		// The error will be caught by the driver during Execute.
-		// Consider pre-validating documents before adding them to the bulk operation.
-	}
 	model := mongo.NewInsertOneModel().SetDocument(doc)
 	b.operations = append(b.operations, model)
 	return b
@@ -57,8 +101,30 @@ func (b *bulkOperation) UpdateById(id any, update any) BulkOperator {
 	return b.UpdateOne(bson.M{"_id": id}, update)
 }
 
+// UpdateMany adds an UpdateMany operation updating all documents matching filter.
+func (b *bulkOperation) UpdateMany(filter any, update any) BulkOperator {
+	model := mongo.NewUpdateManyModel().
+		SetFilter(filter).
+		SetUpdate(update)
+	b.operations = append(b.operations, model)
+	return b
+}
+
+// Upsert adds an UpdateOne operation that inserts a document when none matches filter.
+// Bound models embedding Timestamps also get `createdAt` in the $setOnInsert stage.
+func (b *bulkOperation) Upsert(filter any, update any) BulkOperator {
+	model := mongo.NewUpdateOneModel().
+		SetFilter(filter).
+		SetUpdate(update).
+		SetUpsert(true)
+	b.operations = append(b.operations, model)
+	return b
+}
+
 // DeleteOne adds a DeleteOne operation to the bulk request.
 // filter: The filter to select the document to delete.
+// Documents of models embedding SoftDelete are flagged as deleted instead, and are
+// counted as modified in the result. This also applies to DeleteById and DeleteMany.
 func (b *bulkOperation) DeleteOne(filter any) BulkOperator {
 	model := mongo.NewDeleteOneModel().SetFilter(filter)
 	b.operations = append(b.operations, model)
@@ -70,8 +136,16 @@ func (b *bulkOperation) DeleteById(id any) BulkOperator {
 	return b.DeleteOne(bson.M{"_id": id})
 }
 
+// DeleteMany adds a DeleteMany operation removing all documents matching filter.
+func (b *bulkOperation) DeleteMany(filter any) BulkOperator {
+	model := mongo.NewDeleteManyModel().SetFilter(filter)
+	b.operations = append(b.operations, model)
+	return b
+}
+
 // ReplaceOne adds a ReplaceOne operation to the bulk request.
 // The replacement document must not have an _id field if it's different from the filter's _id.
+// It is validated in Execute like inserted documents.
 func (b *bulkOperation) ReplaceOne(filter any, replacement DocInter) BulkOperator {
 	model := mongo.NewReplaceOneModel().
 		SetFilter(filter).
@@ -80,23 +154,488 @@ func (b *bulkOperation) ReplaceOne(filter any, replacement DocInter) BulkOperato
 	return b
 }
 
-// Execute sends the accumulated operations to the database as a single bulk write request.
-// Returns the result of the bulk write operation, or an error if it fails.
+// Execute prepares a copy of the accumulated operations (hooks, timestamps, validation,
+// tenant scope and encryption) and sends it in chunks, returning a *BulkError for failed operations.
 func (b *bulkOperation) Execute(ctx context.Context) (*mongo.BulkWriteResult, error) {
 	if len(b.operations) == 0 {
 		return nil, fmt.Errorf("%w: no operations to execute", ErrInvalidDocument)
 	}
-	result, err := b.collection.BulkWrite(ctx, b.operations)
+	model := b.collectionModel()
+	ops, err := b.prepare(ctx, model)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrWriteFailed, err)
+		return nil, err
+	}
+	failures := validateOps(ops)
+	pending := make([]int, 0, len(ops))
+	for i := range ops {
+		if !slices.ContainsFunc(failures, func(f BulkFailure) bool { return f.Index == i }) {
+			pending = append(pending, i)
+		}
+	}
+	if !b.unordered && len(failures) > 0 {
+		// An ordered write stops at the first invalid operation; all before it are valid.
+		pending = pending[:failures[0].Index]
+	}
+
+	restore, err := b.encrypt(ctx, model, ops, pending)
+	if err != nil {
+		return nil, err
+	}
+	result, failures, err := b.send(ctx, ops, pending, failures)
+	restore()
+	if err != nil {
+		return result, err
+	}
+	var bulkErr *BulkError
+	if len(failures) > 0 {
+		bulkErr = b.bulkError(failures)
 	}
 
+	for i, op := range ops {
+		if m, ok := op.(*mongo.InsertOneModel); ok && !bulkErr.has(i) {
+			if err := afterInsert(ctx, m.Document); err != nil && bulkErr == nil {
+				return result, err
+			}
+		}
+	}
+	if bulkErr != nil {
+		return result, bulkErr
+	}
 	return result, nil
 }
 
-func (m *mongoStore) NewBulkOperation(cname string) BulkOperator {
-	return &bulkOperation{
+// send writes the pending operations in chunks and adds the failed ones to failures.
+func (b *bulkOperation) send(ctx context.Context, ops []mongo.WriteModel, pending []int, failures []BulkFailure) (*mongo.BulkWriteResult, []BulkFailure, error) {
+	result := &mongo.BulkWriteResult{UpsertedIDs: map[int64]any{}, Acknowledged: true}
+	for chunk := range slices.Chunk(pending, b.chunkLen(len(pending))) {
+		models := make([]mongo.WriteModel, len(chunk))
+		for i, index := range chunk {
+			models[i] = ops[index]
+		}
+		res, err := b.write(ctx, models, !b.unordered)
+		mergeBulkResult(result, res, chunk)
+		if err == nil {
+			continue
+		}
+		var bwe mongo.BulkWriteException
+		if !errors.As(err, &bwe) || len(bwe.WriteErrors) == 0 {
+			return result, failures, fmt.Errorf("%w: %w", ErrWriteFailed, err)
+		}
+		for _, we := range bwe.WriteErrors {
+			failures = append(failures, newBulkFailure(chunk[we.Index], we.WriteError))
+		}
+		if !b.unordered {
+			break
+		}
+	}
+	return result, failures, nil
+}
+
+// encrypt encrypts the encrypted fields of the pending operations, after validation saw
+// the plaintext: inserted and replacement documents in place until restore is called,
+// and the filters and updates on the copies, for the replaced document or model.
+// Updates other than bson.D and bson.M cannot be encrypted and are refused.
+func (b *bulkOperation) encrypt(ctx context.Context, model DocInter, ops []mongo.WriteModel, pending []int) (restore func(), err error) {
+	var restores []func()
+	restore = func() {
+		for _, r := range restores {
+			r()
+		}
+	}
+	encrypted := model != nil && len(encryptedFields(reflect.TypeOf(model))) > 0
+	for _, i := range pending {
+		switch m := ops[i].(type) {
+		case *mongo.InsertOneModel:
+			var r func()
+			r, err = encryptDoc(ctx, m.Document)
+			restores = append(restores, r)
+		case *mongo.ReplaceOneModel:
+			var r func()
+			if r, err = encryptDoc(ctx, m.Replacement); err == nil {
+				m.Filter, err = encryptFilter(ctx, m.Replacement, m.Filter)
+			}
+			restores = append(restores, r)
+		case *mongo.UpdateOneModel:
+			if encrypted {
+				m.Filter, m.Update, err = encryptBulkUpdate(ctx, model, m.Filter, m.Update)
+			}
+		case *mongo.UpdateManyModel:
+			if encrypted {
+				m.Filter, m.Update, err = encryptBulkUpdate(ctx, model, m.Filter, m.Update)
+			}
+		case *mongo.DeleteOneModel:
+			if encrypted {
+				m.Filter, err = encryptFilter(ctx, model, m.Filter)
+			}
+		case *mongo.DeleteManyModel:
+			if encrypted {
+				m.Filter, err = encryptFilter(ctx, model, m.Filter)
+			}
+		}
+		if err != nil {
+			restore()
+			return func() {}, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return restore, nil
+}
+
+// encryptBulkUpdate encrypts the filter and the update of an update operation on model.
+func encryptBulkUpdate(ctx context.Context, model DocInter, filter, update any) (any, any, error) {
+	d, ok := updateDoc(update)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: update %T cannot be encrypted, use bson.D or bson.M", ErrEncryption, update)
+	}
+	filter, err := encryptFilter(ctx, model, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	encrypted, err := encryptUpdate(ctx, model, d)
+	return filter, encrypted, err
+}
+
+// chunkLen returns the number of operations per request for n pending operations.
+func (b *bulkOperation) chunkLen(n int) int {
+	if b.chunkSize > 0 {
+		return b.chunkSize
+	}
+	return max(n, 1)
+}
+
+// validateOps validates the inserted and replacement documents and reports the invalid ones.
+func validateOps(ops []mongo.WriteModel) []BulkFailure {
+	var failures []BulkFailure
+	for i, op := range ops {
+		var doc any
+		switch m := op.(type) {
+		case *mongo.InsertOneModel:
+			doc = m.Document
+		case *mongo.ReplaceOneModel:
+			doc = m.Replacement
+		default:
+			continue
+		}
+		if d, ok := doc.(DocInter); ok {
+			if err := validateDoc(d); err != nil {
+				failures = append(failures, BulkFailure{Index: i, Reason: BulkFailureValidation, Err: err})
+			}
+		}
+	}
+	return failures
+}
+
+// bulkError builds the error reporting failures. For ordered writes only the first
+// failure is reported and every later operation is skipped.
+func (b *bulkOperation) bulkError(failures []BulkFailure) *BulkError {
+	slices.SortFunc(failures, func(x, y BulkFailure) int { return x.Index - y.Index })
+	if b.unordered {
+		return &BulkError{Failures: failures}
+	}
+	first := failures[0]
+	var skipped []int
+	for i := first.Index + 1; i < len(b.operations); i++ {
+		skipped = append(skipped, i)
+	}
+	return &BulkError{Failures: []BulkFailure{first}, Skipped: skipped}
+}
+
+// mergeBulkResult adds the result of the chunk holding the operations at indexes to total.
+func mergeBulkResult(total, res *mongo.BulkWriteResult, indexes []int) {
+	if res == nil {
+		return
+	}
+	total.InsertedCount += res.InsertedCount
+	total.MatchedCount += res.MatchedCount
+	total.ModifiedCount += res.ModifiedCount
+	total.DeletedCount += res.DeletedCount
+	total.UpsertedCount += res.UpsertedCount
+	for i, id := range res.UpsertedIDs {
+		total.UpsertedIDs[int64(indexes[int(i)])] = id
+	}
+	total.Acknowledged = total.Acknowledged && res.Acknowledged
+}
+
+// collectionModel returns the model of the collection, which scopes the operations to the
+// tenant, encrypts their filters and refuses them when audited: the model bound with
+// WithModel, else a model registered with RegisterIndex for the collection, else the
+// first inserted or replacement document. It returns nil when none is known.
+func (b *bulkOperation) collectionModel() DocInter {
+	if b.model != nil {
+		return b.model
+	}
+	if doc := registeredModel(b.cname); doc != nil {
+		return doc
+	}
+	for _, op := range b.operations {
+		switch m := op.(type) {
+		case *mongo.InsertOneModel:
+			if doc, ok := m.Document.(DocInter); ok {
+				return doc
+			}
+		case *mongo.ReplaceOneModel:
+			if doc, ok := m.Replacement.(DocInter); ok {
+				return doc
+			}
+		}
+	}
+	return nil
+}
+
+// prepare returns a copy of the accumulated operations with the model hooks run, the
+// timestamps set and the filters scoped to the tenant of ctx for model, see collectionModel.
+// The accumulated operations are left untouched, so that executing them again does not
+// apply any of it twice. Models implementing TenantDatabase are refused since the
+// datastore was chosen without a context.
+func (b *bulkOperation) prepare(ctx context.Context, model DocInter) ([]mongo.WriteModel, error) {
+	if _, ok := model.(TenantDatabase); ok {
+		return nil, fmt.Errorf("%w: bulk operations are not routed to tenant databases", ErrTenantDenied)
+	}
+	now := nowFunc()
+	ops := make([]mongo.WriteModel, len(b.operations))
+	for i, op := range b.operations {
+		var err error
+		if ops[i], err = b.prepareOne(ctx, model, op, now); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return ops, nil
+}
+
+// prepareOne copies op and prepares the copy. The before hooks run first so that
+// the timestamps and the tenant cannot be overridden by them.
+func (b *bulkOperation) prepareOne(ctx context.Context, model DocInter, op mongo.WriteModel, now time.Time) (mongo.WriteModel, error) {
+	scope := model != nil && isTenanted(model)
+	var err error
+	switch m := op.(type) {
+	case *mongo.InsertOneModel:
+		c := *m
+		if _, ok := c.Document.(TenantDatabase); ok {
+			return nil, fmt.Errorf("%w: bulk operations are not routed to tenant databases", ErrTenantDenied)
+		}
+		if err = beforeInsert(ctx, c.Document); err != nil {
+			return nil, err
+		}
+		stampInsert(c.Document, now)
+		return &c, stampTenant(ctx, c.Document)
+	case *mongo.UpdateOneModel:
+		c := *m
+		if err = refuseAudited(model); err != nil {
+			return nil, err
+		}
+		if c.Update, err = b.beforeUpdate(ctx, c.Update); err != nil {
+			return nil, err
+		}
+		c.Update = b.stampUpdate(c.Update, c.Upsert != nil && *c.Upsert, now)
+		if scope {
+			c.Filter, err = tenantUpdate(ctx, model, c.Filter, c.Update)
+		}
+		return &c, err
+	case *mongo.UpdateManyModel:
+		c := *m
+		if err = refuseAudited(model); err != nil {
+			return nil, err
+		}
+		if c.Update, err = b.beforeUpdate(ctx, c.Update); err != nil {
+			return nil, err
+		}
+		c.Update = b.stampUpdate(c.Update, false, now)
+		if scope {
+			c.Filter, err = tenantUpdate(ctx, model, c.Filter, c.Update)
+		}
+		return &c, err
+	case *mongo.ReplaceOneModel:
+		c := *m
+		if err = refuseAudited(c.Replacement); err != nil {
+			return nil, err
+		}
+		if scope {
+			if err = stampTenant(ctx, c.Replacement); err == nil {
+				c.Filter, err = tenantFilter(ctx, model, c.Filter)
+			}
+		}
+		return &c, err
+	case *mongo.DeleteOneModel:
+		c := *m
+		if err = refuseAudited(model); err != nil {
+			return nil, err
+		}
+		if err = beforeDelete(ctx, b.model); err == nil && scope {
+			c.Filter, err = tenantFilter(ctx, model, c.Filter)
+		}
+		if err == nil && model != nil && isSoftDeletable(model) {
+			return mongo.NewUpdateOneModel().
+				SetFilter(andFilter(c.Filter, notDeleted)).
+				SetUpdate(softDeleteUpdate(model, now)).
+				SetCollation(c.Collation).
+				SetHint(c.Hint), nil
+		}
+		return &c, err
+	case *mongo.DeleteManyModel:
+		c := *m
+		if err = refuseAudited(model); err != nil {
+			return nil, err
+		}
+		if err = beforeDelete(ctx, b.model); err == nil && scope {
+			c.Filter, err = tenantFilter(ctx, model, c.Filter)
+		}
+		if err == nil && model != nil && isSoftDeletable(model) {
+			return mongo.NewUpdateManyModel().
+				SetFilter(andFilter(c.Filter, notDeleted)).
+				SetUpdate(softDeleteUpdate(model, now)).
+				SetCollation(c.Collation).
+				SetHint(c.Hint), nil
+		}
+		return &c, err
+	}
+	return op, nil
+}
+
+// tenantUpdate restricts the filter of an update to the tenant of ctx, refusing
+// updates that change the tenant field.
+func tenantUpdate(ctx context.Context, model DocInter, filter, update any) (any, error) {
+	if d, ok := updateDoc(update); ok {
+		if err := checkTenantUpdate(ctx, model, d); err != nil {
+			return nil, err
+		}
+	}
+	return tenantFilter(ctx, model, filter)
+}
+
+// beforeUpdate runs the BeforeUpdate hook of the bound model on update.
+// Only bson.D and bson.M updates are passed to the hook; others are returned unchanged.
+func (b *bulkOperation) beforeUpdate(ctx context.Context, update any) (any, error) {
+	if _, ok := b.model.(BeforeUpdater); !ok {
+		return update, nil
+	}
+	d, ok := updateDoc(update)
+	if !ok {
+		return update, nil
+	}
+	return beforeUpdate(ctx, b.model, d)
+}
+
+// stampUpdate refreshes `updatedAt` in update when the bound model embeds Timestamps,
+// and sets `createdAt` on insert for upserts.
+// Only bson.D and bson.M updates can be extended; others are returned unchanged.
+func (b *bulkOperation) stampUpdate(update any, upsert bool, now time.Time) any {
+	if b.model == nil || !isTimestamped(b.model) {
+		return update
+	}
+	d, ok := updateDoc(update)
+	if !ok {
+		return update
+	}
+	if upsert {
+		return stampUpsert(b.model, d, now)
+	}
+	return stampUpdate(b.model, d, now)
+}
+
+// updateDoc returns a copy of a bson.D or bson.M update as bson.D.
+func updateDoc(update any) (bson.D, bool) {
+	switch u := update.(type) {
+	case bson.D:
+		return slices.Clone(u), true
+	case bson.M:
+		d := make(bson.D, 0, len(u))
+		for k, v := range u {
+			d = append(d, bson.E{Key: k, Value: v})
+		}
+		return d, true
+	default:
+		return nil, false
+	}
+}
+
+// BulkFailureReason classifies why an operation of a bulk write failed.
+type BulkFailureReason string
+
+const (
+	// BulkFailureDuplicateKey means the operation violated a unique index.
+	BulkFailureDuplicateKey BulkFailureReason = "duplicate_key"
+	// BulkFailureValidation means the document failed Validate or the collection validator.
+	BulkFailureValidation BulkFailureReason = "validation"
+	// BulkFailureOther covers every other server error.
+	BulkFailureOther BulkFailureReason = "other"
+)
+
+// codeDocumentValidationFailure is the server error code of a document rejected by
+// the collection validator.
+const codeDocumentValidationFailure = 121
+
+// BulkFailure describes a failed operation of a bulk write.
+type BulkFailure struct {
+	// Index is the position of the operation in the order it was added.
+	Index int
+	// Reason classifies the failure.
+	Reason BulkFailureReason
+	// Err is the error of the operation. Server errors are wrapped in ErrWriteFailed and,
+	// for duplicates, ErrDuplicateKey; validation errors in ErrInvalidDocument.
+	Err error
+}
+
+// newBulkFailure classifies the server error of the operation at index.
+func newBulkFailure(index int, we mongo.WriteError) BulkFailure {
+	var cause error = mongo.WriteException{WriteErrors: mongo.WriteErrors{we}}
+	reason := BulkFailureOther
+	switch {
+	case mongo.IsDuplicateKeyError(cause):
+		reason = BulkFailureDuplicateKey
+	case we.Code == codeDocumentValidationFailure:
+		reason = BulkFailureValidation
+	}
+	return BulkFailure{Index: index, Reason: reason, Err: writeError(fmt.Errorf("%w: %w", ErrWriteFailed, cause))}
+}
+
+// BulkError is returned by Execute when operations of a bulk write failed.
+// It matches ErrWriteFailed with errors.Is, as well as ErrDuplicateKey and
+// ErrInvalidDocument when one of the failures has that reason.
+type BulkError struct {
+	// Failures lists the failed operations by index.
+	Failures []BulkFailure
+	// Skipped lists the operations an ordered write did not attempt after its failure.
+	Skipped []int
+}
+
+func (e *BulkError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = fmt.Sprintf("operation %d: %v", f.Index, f.Err)
+	}
+	msg := fmt.Sprintf("%d bulk operations failed: %s", len(e.Failures), strings.Join(msgs, "; "))
+	if len(e.Skipped) > 0 {
+		msg += fmt.Sprintf(" (%d skipped)", len(e.Skipped))
+	}
+	return msg
+}
+
+// has reports whether the operation at index failed or was skipped. It is nil-safe.
+func (e *BulkError) has(index int) bool {
+	if e == nil {
+		return false
+	}
+	return slices.Contains(e.Skipped, index) ||
+		slices.ContainsFunc(e.Failures, func(f BulkFailure) bool { return f.Index == index })
+}
+
+func (e *BulkError) Unwrap() []error {
+	errs := []error{ErrWriteFailed}
+	for _, f := range e.Failures {
+		errs = append(errs, f.Err)
+	}
+	return errs
+}
+
+func (m *mongoStore) NewBulkOperation(cname string, opts ...BulkOption) BulkOperator {
+	b := &bulkOperation{
+		cname:      cname,
 		operations: make([]mongo.WriteModel, 0),
-		collection: m.getCollection(cname),
+		write: func(ctx context.Context, models []mongo.WriteModel, ordered bool) (*mongo.BulkWriteResult, error) {
+			return m.collection(ctx, cname).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(ordered))
+		},
+	}
+	for _, opt := range opts {
+		opt(b)
 	}
+	return b
 }
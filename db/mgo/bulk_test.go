@@ -0,0 +1,111 @@
+package mgo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestBulkOperations(t *testing.T) {
+	defer mgo.SetDatastore(mgo.NewMemoryDatastore())()
+	seedUsers(t)
+	ctx := context.Background()
+
+	bulk, err := mgo.NewBulkOperation("users", mgo.WithChunkSize(2))
+	assert.NoError(t, err)
+	result, err := bulk.
+		UpdateMany(bson.D{{Key: "age", Value: bson.D{{Key: "$lt", Value: 35}}}}, bson.D{{Key: "$inc", Value: bson.D{{Key: "age", Value: 1}}}}).
+		DeleteMany(bson.D{{Key: "name", Value: "Bob"}}).
+		Upsert(bson.D{{Key: "name", Value: "Alice"}}, bson.D{{Key: "$set", Value: bson.D{{Key: "age", Value: 27}}}}).
+		Upsert(bson.D{{Key: "name", Value: "Dave"}}, bson.D{{Key: "$set", Value: bson.D{{Key: "age", Value: 19}}}}).
+		Execute(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), result.MatchedCount)
+	assert.Equal(t, int64(1), result.DeletedCount)
+	assert.Equal(t, int64(1), result.UpsertedCount)
+	assert.Contains(t, result.UpsertedIDs, int64(3), "upserted ids are keyed by operation, across chunks")
+
+	users, err := mgo.Find(ctx, &testUser{}, nil)
+	assert.NoError(t, err)
+	ages := map[string]int{}
+	for _, u := range users {
+		ages[u.Name] = u.Age
+	}
+	assert.Equal(t, map[string]int{"Peter": 31, "Alice": 27, "Dave": 19}, ages)
+}
+
+func TestBulkFailures(t *testing.T) {
+	ctx := context.Background()
+	dup := bson.NewObjectID()
+	execute := func(t *testing.T, opts ...mgo.BulkOption) (int64, *mgo.BulkError) {
+		t.Helper()
+		defer mgo.SetDatastore(mgo.NewMemoryDatastore())()
+		bulk, err := mgo.NewBulkOperation("posts", opts...)
+		assert.NoError(t, err)
+		result, err := bulk.
+			InsertOne(&testPost{ID: dup, Title: "First"}).
+			InsertOne(&testPost{ID: dup, Title: "Second"}).
+			InsertOne(&testPost{ID: bson.NewObjectID()}).
+			InsertOne(&testPost{ID: bson.NewObjectID(), Title: "Fourth"}).
+			Execute(ctx)
+		assert.ErrorIs(t, err, mgo.ErrWriteFailed)
+		var bulkErr *mgo.BulkError
+		assert.True(t, errors.As(err, &bulkErr))
+		return result.InsertedCount, bulkErr
+	}
+
+	t.Run("Ordered stops at the first failure", func(t *testing.T) {
+		inserted, err := execute(t)
+		assert.Equal(t, int64(1), inserted)
+		assert.ErrorIs(t, err, mgo.ErrDuplicateKey)
+		assert.Len(t, err.Failures, 1)
+		assert.Equal(t, 1, err.Failures[0].Index)
+		assert.Equal(t, mgo.BulkFailureDuplicateKey, err.Failures[0].Reason)
+		assert.Equal(t, []int{2, 3}, err.Skipped)
+	})
+
+	t.Run("Unordered reports every failure", func(t *testing.T) {
+		inserted, err := execute(t, mgo.WithUnordered(), mgo.WithChunkSize(1))
+		assert.Equal(t, int64(2), inserted)
+		assert.ErrorIs(t, err, mgo.ErrInvalidDocument)
+		assert.Empty(t, err.Skipped)
+		if assert.Len(t, err.Failures, 2) {
+			assert.Equal(t, 1, err.Failures[0].Index)
+			assert.Equal(t, mgo.BulkFailureDuplicateKey, err.Failures[0].Reason)
+			assert.Equal(t, 2, err.Failures[1].Index)
+			assert.Equal(t, mgo.BulkFailureValidation, err.Failures[1].Reason)
+		}
+	})
+}
+
+func TestBulkExecuteTwice(t *testing.T) {
+	defer mgo.SetDatastore(mgo.NewMemoryDatastore())()
+	ctx := context.Background()
+	post, err := mgo.Save(ctx, &testPost{Title: "First Post"})
+	assert.NoError(t, err)
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "title", Value: "Latest Post"}}}}
+	bulk, err := mgo.NewBulkOperation("posts", mgo.WithModel(&testPost{}))
+	assert.NoError(t, err)
+	bulk.UpdateById(post.ID, update)
+	for range 2 {
+		result, err := bulk.Execute(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), result.MatchedCount)
+	}
+	assert.Len(t, update[0].Value.(bson.D), 1, "hooks run on a copy of the update")
+
+	article := &testArticle{Title: "queued"}
+	bulk, err = mgo.NewBulkOperation("articles")
+	assert.NoError(t, err)
+	bulk.InsertOne(article)
+	assert.True(t, article.CreatedAt.IsZero(), "timestamps are set in Execute")
+	_, err = bulk.Execute(ctx)
+	assert.NoError(t, err)
+	assert.False(t, article.CreatedAt.IsZero())
+}
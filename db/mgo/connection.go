@@ -5,16 +5,25 @@ package mgo
 import (
 	"context"
 	"errors"
+	"reflect"
 	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readconcern"
 	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
 )
 
 var once sync.Once
 
+var (
+	namedMu sync.RWMutex
+	// named holds the datastores added with Register.
+	named = map[string]Datastore{}
+)
+
 // Option defines a function signature for configuring the MongoDB client.
 // This follows the functional options pattern, allowing for flexible and clear configuration.
 type Option func(*options.ClientOptions)
@@ -47,8 +56,32 @@ func WithMaxConnIdleTime(d time.Duration) Option {
 	}
 }
 
+// WithDefaultReadPreference sets the read preference of the client,
+// replacing the default of reading from secondaries when available.
+func WithDefaultReadPreference(rp *readpref.ReadPref) Option {
+	return func(o *options.ClientOptions) {
+		o.SetReadPreference(rp)
+	}
+}
+
+// WithDefaultReadConcern sets the read concern of the client.
+func WithDefaultReadConcern(rc *readconcern.ReadConcern) Option {
+	return func(o *options.ClientOptions) {
+		o.SetReadConcern(rc)
+	}
+}
+
+// WithDefaultWriteConcern sets the write concern of the client.
+func WithDefaultWriteConcern(wc *writeconcern.WriteConcern) Option {
+	return func(o *options.ClientOptions) {
+		o.SetWriteConcern(wc)
+	}
+}
+
 // InitConnection establishes a connection to the MongoDB server using a singleton pattern.
 // It is safe to call this function multiple times; the connection will only be initialized once.
+// The connection becomes the default datastore used by all models that are not bound to a
+// named datastore, see Register.
 //
 // ctx: A context for the connection process.
 // dbName: The name of the database to connect to.
@@ -56,43 +89,148 @@ func WithMaxConnIdleTime(d time.Duration) Option {
 func InitConnection(ctx context.Context, dbName string, opts ...Option) error {
 	var err error
 	once.Do(func() {
-		var client *mongo.Client
-		clientOpts := options.Client()
-		// Default to reading from secondary nodes if available, improving read performance.
-		clientOpts.SetReadPreference(readpref.SecondaryPreferred())
-
-		// Apply all user-provided configuration options.
-		for _, o := range opts {
-			o(clientOpts)
-		}
+		dataStore, err = Connect(ctx, dbName, opts...)
+	})
 
-		// Establish the connection to the server.
-		client, err = mongo.Connect(clientOpts)
-		if err != nil {
-			err = errors.Join(ErrConnectionFailed, err)
-			return
-		}
+	return err
+}
 
-		// Ping the primary node to verify that the connection is alive.
-		err = client.Ping(ctx, readpref.Primary())
-		if err != nil {
-			err = errors.Join(ErrPingFailed, err)
-			return
-		}
+// Connect establishes a new connection to the MongoDB server and returns a Datastore
+// for database dbName. Unlike InitConnection it can be called any number of times,
+// e.g. to connect to further databases passed to Register.
+// Reads go to secondary nodes when available unless WithDefaultReadPreference says otherwise.
+func Connect(ctx context.Context, dbName string, opts ...Option) (Datastore, error) {
+	clientOpts := options.Client()
+	// Default to reading from secondary nodes if available, improving read performance.
+	clientOpts.SetReadPreference(readpref.SecondaryPreferred())
+
+	// Apply all user-provided configuration options.
+	for _, o := range opts {
+		o(clientOpts)
+	}
 
-		dataStore = &mongoStore{
-			db: client.Database(dbName),
+	// Establish the connection to the server.
+	client, err := mongo.Connect(clientOpts)
+	if err != nil {
+		return nil, errors.Join(ErrConnectionFailed, err)
+	}
+
+	// Ping the primary node to verify that the connection is alive.
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		return nil, errors.Join(ErrPingFailed, err)
+	}
+
+	return &mongoStore{db: client.Database(dbName)}, nil
+}
+
+// Register makes ds available under name. Models implementing DatastoreBinder with that
+// name are read from and written to ds instead of the default datastore:
+//
+//	analytics, err := mgo.Connect(ctx, "analytics", mgo.WithURI(uri))
+//	if err != nil { ... }
+//	mgo.Register("analytics", analytics)
+//
+// Registering a nil Datastore removes the name. Close disconnects registered datastores too.
+func Register(name string, ds Datastore) {
+	namedMu.Lock()
+	defer namedMu.Unlock()
+	if ds == nil {
+		delete(named, name)
+		return
+	}
+	named[name] = ds
+}
+
+// DatastoreBinder is an optional interface for Index definitions whose collection lives
+// in a named datastore rather than the default one.
+type DatastoreBinder interface {
+	// DatastoreName returns the name passed to Register; empty means the default datastore.
+	DatastoreName() string
+}
+
+// storeFor returns the datastore index is bound to, or nil if it is not connected.
+func storeFor(index any) Datastore {
+	if b, ok := index.(DatastoreBinder); ok {
+		if name := b.DatastoreName(); name != "" {
+			namedMu.RLock()
+			defer namedMu.RUnlock()
+			return named[name]
 		}
-	})
+	}
+	return dataStore
+}
 
-	return err
+type ctxKeyPinnedStore struct{}
+
+// pinnedStore routes the models of one type to a datastore, see WithRepositoryDatastore.
+type pinnedStore struct {
+	model reflect.Type
+	ds    Datastore
+}
+
+// pinStore returns a context routing the generic functions for models of doc's type to ds.
+func pinStore(ctx context.Context, doc any, ds Datastore) context.Context {
+	return context.WithValue(ctx, ctxKeyPinnedStore{}, pinnedStore{model: reflect.TypeOf(doc), ds: ds})
+}
+
+// storeIn is storeFor, except that a datastore pinned on ctx for the model's type wins.
+// Models implementing TenantDatabase are routed to the database of the tenant of ctx.
+func storeIn(ctx context.Context, index any) Datastore {
+	if p, ok := ctx.Value(ctxKeyPinnedStore{}).(pinnedStore); ok && p.model == reflect.TypeOf(index) {
+		return tenantStore(ctx, index, p.ds)
+	}
+	return tenantStore(ctx, index, storeFor(index))
 }
 
 // Close gracefully disconnects the client from the MongoDB server.
 // It should be called at the end of the application's lifecycle, for example, using defer in main.
+// Datastores added with Register are closed as well.
 func Close(ctx context.Context) error {
+	var errs []error
 	if dataStore != nil {
-		return dataStore.close(ctx)
+		errs = append(errs, dataStore.close(ctx))
 	}
-	return nil
+	namedMu.RLock()
+	defer namedMu.RUnlock()
+	for _, ds := range named {
+		if ds != dataStore {
+			errs = append(errs, ds.close(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// callOptions holds the per-call overrides set on a context.
+type callOptions struct {
+	readPref     *readpref.ReadPref
+	readConcern  *readconcern.ReadConcern
+	writeConcern *writeconcern.WriteConcern
+}
+
+type callOptionsKey struct{}
+
+func withCallOptions(ctx context.Context, set func(*callOptions)) context.Context {
+	o := callOptions{}
+	if current, ok := ctx.Value(callOptionsKey{}).(callOptions); ok {
+		o = current
+	}
+	set(&o)
+	return context.WithValue(ctx, callOptionsKey{}, o)
+}
+
+// WithReadPreference returns a context whose operations read with rp instead of the
+// client's read preference, e.g. readpref.Primary() to read your own writes.
+func WithReadPreference(ctx context.Context, rp *readpref.ReadPref) context.Context {
+	return withCallOptions(ctx, func(o *callOptions) { o.readPref = rp })
+}
+
+// WithReadConcern returns a context whose operations use read concern rc.
+func WithReadConcern(ctx context.Context, rc *readconcern.ReadConcern) context.Context {
+	return withCallOptions(ctx, func(o *callOptions) { o.readConcern = rc })
+}
+
+// WithWriteConcern returns a context whose operations use write concern wc,
+// e.g. writeconcern.Majority() for writes that must survive a failover.
+func WithWriteConcern(ctx context.Context, wc *writeconcern.WriteConcern) context.Context {
+	return withCallOptions(ctx, func(o *callOptions) { o.writeConcern = wc })
 }
@@ -0,0 +1,83 @@
+package mgo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+)
+
+// testEvent is stored in the "analytics" datastore.
+type testEvent struct {
+	ID   bson.ObjectID `bson:"_id,omitempty"`
+	Name string        `bson:"name"`
+}
+
+func (e *testEvent) C() string                   { return "events" }
+func (e *testEvent) Indexes() []mongo.IndexModel { return nil }
+func (e *testEvent) Validate() error             { return nil }
+func (e *testEvent) GetId() any                  { return e.ID }
+func (e *testEvent) SetId(id any)                { e.ID = id.(bson.ObjectID) }
+func (e *testEvent) DatastoreName() string       { return "analytics" }
+
+func TestNamedDatastore(t *testing.T) {
+	primary := NewMemoryDatastore()
+	restore := SetDatastore(primary)
+	defer restore()
+	ctx := context.Background()
+
+	t.Run("Not registered", func(t *testing.T) {
+		_, err := Save(ctx, &testEvent{Name: "signup"})
+		assert.ErrorIs(t, err, ErrNotConnected)
+	})
+
+	analytics := NewMemoryDatastore()
+	Register("analytics", analytics)
+	defer Register("analytics", nil)
+
+	t.Run("Routes bound models", func(t *testing.T) {
+		_, err := Save(ctx, &testEvent{Name: "signup"})
+		assert.NoError(t, err)
+
+		events, err := Find(ctx, &testEvent{}, nil)
+		assert.NoError(t, err)
+		assert.Len(t, events, 1)
+
+		cursor, err := primary.Find(ctx, "events", bson.D{})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, cursor.RemainingBatchLength(), "nothing written to the default datastore")
+	})
+
+	t.Run("Bulk operations follow the model", func(t *testing.T) {
+		bulk, err := NewBulkOperation("events", WithModel(&testEvent{}))
+		assert.NoError(t, err)
+		_, err = bulk.InsertOne(&testEvent{Name: "login"}).Execute(ctx)
+		assert.NoError(t, err)
+
+		events, err := Find(ctx, &testEvent{}, nil)
+		assert.NoError(t, err)
+		assert.Len(t, events, 2)
+	})
+}
+
+func TestCallOptions(t *testing.T) {
+	assert.Nil(t, collectionOptions(context.Background()))
+
+	ctx := WithReadPreference(context.Background(), readpref.Primary())
+	ctx = WithReadConcern(ctx, readconcern.Majority())
+	ctx = WithWriteConcern(ctx, writeconcern.Majority())
+
+	opts := &options.CollectionOptions{}
+	for _, set := range collectionOptions(ctx).List() {
+		assert.NoError(t, set(opts))
+	}
+	assert.Equal(t, readpref.PrimaryMode, opts.ReadPreference.Mode())
+	assert.Equal(t, readconcern.Majority(), opts.ReadConcern)
+	assert.Equal(t, writeconcern.Majority(), opts.WriteConcern)
+}
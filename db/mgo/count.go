@@ -0,0 +1,138 @@
+package mgo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Count returns the number of documents of doc's collection matching filter, e.g. the
+// total of a list endpoint. Like Find, soft-deleted documents are excluded unless ctx is
+// wrapped with WithDeleted, and conditions on deterministic encrypted fields are encrypted.
+func Count[T DocInter](ctx context.Context, doc T, filter any, opts ...options.Lister[options.CountOptions]) (int64, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return 0, ErrNotConnected
+	}
+	filter, err := tenantFilter(ctx, doc, filter)
+	if err != nil {
+		return 0, err
+	}
+	filter, err = encryptFilter(ctx, doc, filter)
+	if err != nil {
+		return 0, err
+	}
+	n, err := ds.CountDocuments(ctx, doc.C(), queryFilter(ctx, doc, filter), opts...)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return n, nil
+}
+
+// EstimatedCount returns the number of documents in doc's collection read from the
+// collection metadata. It is much faster than Count on large collections, but takes no
+// filter, so soft-deleted documents are included, and the number may be off after an
+// unclean shutdown or with orphaned documents in a sharded cluster.
+// Models with a tenant field count the documents of the tenant with Count instead.
+func EstimatedCount[T DocInter](ctx context.Context, doc T, opts ...options.Lister[options.EstimatedDocumentCountOptions]) (int64, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return 0, ErrNotConnected
+	}
+	tenant, err := tenantOf(ctx, doc)
+	if err != nil {
+		return 0, err
+	}
+	if tenant != "" && tenantFieldOf(reflect.TypeOf(doc)) != nil {
+		return Count(WithDeleted(ctx), doc, nil)
+	}
+	n, err := ds.EstimatedDocumentCount(ctx, doc.C(), opts...)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return n, nil
+}
+
+// Distinct returns the distinct values of field among the documents of doc's collection
+// matching filter, decoded as V:
+//
+//	countries, err := mgo.Distinct[*User, string](ctx, &User{}, "country", nil)
+//
+// Filtering works like Find. Deterministic encrypted fields are decrypted; randomly
+// encrypted fields hold a different ciphertext per document and return ErrEncryption.
+func Distinct[T DocInter, V any](ctx context.Context, doc T, field string, filter any, opts ...options.Lister[options.DistinctOptions]) ([]V, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return nil, ErrNotConnected
+	}
+	filter, err := tenantFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, err
+	}
+	filter, err = encryptFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ds.Distinct(ctx, doc.C(), field, queryFilter(ctx, doc, filter), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	var values []V
+	if err := (bson.RawValue{Type: bson.TypeArray, Value: raw}).Unmarshal(&values); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return openDistinct(ctx, doc, field, values)
+}
+
+// Exists reports whether any document of doc's collection matches filter, e.g. for
+// uniqueness checks. Counting stops at the first match.
+func Exists[T DocInter](ctx context.Context, doc T, filter any) (bool, error) {
+	n, err := Count(ctx, doc, filter, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+// queryFilter scopes filter like Find and replaces a nil filter with an empty document,
+// which the count and distinct commands require.
+func queryFilter(ctx context.Context, doc DocInter, filter any) any {
+	filter = scopeFilter(ctx, doc, filter)
+	if filter == nil {
+		return bson.D{}
+	}
+	return filter
+}
+
+// rawArray encodes values as a BSON array, as returned by the distinct command.
+func rawArray(values []any) (bson.RawArray, error) {
+	raw, err := bson.Marshal(bson.D{{Key: "values", Value: bson.A(values)}})
+	if err != nil {
+		return nil, err
+	}
+	return bson.Raw(raw).Lookup("values").Array(), nil
+}
+
+func (m *mongoStore) CountDocuments(ctx context.Context, collection string, filter any, opts ...options.Lister[options.CountOptions]) (int64, error) {
+	n, err := m.collection(ctx, collection).CountDocuments(ctx, filter, opts...)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return n, nil
+}
+
+func (m *mongoStore) EstimatedDocumentCount(ctx context.Context, collection string, opts ...options.Lister[options.EstimatedDocumentCountOptions]) (int64, error) {
+	n, err := m.collection(ctx, collection).EstimatedDocumentCount(ctx, opts...)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return n, nil
+}
+
+func (m *mongoStore) Distinct(ctx context.Context, collection string, field string, filter any, opts ...options.Lister[options.DistinctOptions]) (bson.RawArray, error) {
+	raw, err := m.collection(ctx, collection).Distinct(ctx, field, filter, opts...).Raw()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return raw, nil
+}
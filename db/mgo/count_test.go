@@ -0,0 +1,75 @@
+package mgo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestCount(t *testing.T) {
+	defer mgo.SetDatastore(mgo.NewMemoryDatastore())()
+	seedUsers(t)
+	ctx := context.Background()
+
+	n, err := mgo.Count(ctx, &testUser{}, bson.D{{Key: "age", Value: bson.D{{Key: "$gt", Value: 26}}}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	exists, err := mgo.Exists(ctx, &testUser{}, bson.D{{Key: "name", Value: "Alice"}})
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = mgo.Exists(ctx, &testUser{}, bson.D{{Key: "name", Value: "Zoe"}})
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	t.Run("Soft-deleted documents", func(t *testing.T) {
+		product, err := mgo.Save(ctx, &testProduct{Name: "Mug"})
+		assert.NoError(t, err)
+		_, err = mgo.Save(ctx, &testProduct{Name: "Cup"})
+		assert.NoError(t, err)
+		_, err = mgo.DeleteById(ctx, product)
+		assert.NoError(t, err)
+
+		n, err := mgo.Count(ctx, &testProduct{}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		n, err = mgo.EstimatedCount(ctx, &testProduct{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n, "estimates read the collection size")
+	})
+}
+
+func TestDistinct(t *testing.T) {
+	defer mgo.SetDatastore(mgo.NewMemoryDatastore())()
+	seedUsers(t)
+	ctx := context.Background()
+	_, err := mgo.Save(ctx, &testUser{Name: "Alice", Age: 33})
+	assert.NoError(t, err)
+
+	names, err := mgo.Distinct[*testUser, string](ctx, &testUser{}, "name", nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Peter", "Alice", "Bob"}, names)
+
+	ages, err := mgo.Distinct[*testUser, int](ctx, &testUser{}, "age", bson.D{{Key: "name", Value: "Alice"}})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []int{25, 33}, ages)
+
+	t.Run("Encrypted fields", func(t *testing.T) {
+		defer mgo.SetKeyProvider(testKeyRing(t, "k1"))()
+		for _, email := range []string{"ann@example.com", "ann@example.com", "bob@example.com"} {
+			_, err := mgo.Save(ctx, &testCustomer{Email: email})
+			assert.NoError(t, err)
+		}
+
+		emails, err := mgo.Distinct[*testCustomer, string](ctx, &testCustomer{}, "email", nil)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"ann@example.com", "bob@example.com"}, emails)
+
+		_, err = mgo.Distinct[*testCustomer, string](ctx, &testCustomer{}, "address.street", nil)
+		assert.ErrorIs(t, err, mgo.ErrEncryption)
+	})
+}
@@ -2,6 +2,7 @@ package mgo
 
 import (
 	"context"
+	"io"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -12,18 +13,38 @@ import (
 // It allows for mocking the entire package for testing purposes.
 type Datastore interface {
 	Save(ctx context.Context, doc DocInter) (DocInter, error)
+	InsertMany(ctx context.Context, collection string, docs []DocInter) ([]any, error)
 	Find(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error)
 	FindOne(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult
-	UpdateOne(ctx context.Context, collection string, filter bson.D, update bson.D) (int64, error)
-	UpdateMany(ctx context.Context, collection string, filter bson.D, update bson.D) (int64, error)
-	DeleteOne(ctx context.Context, collection string, filter bson.D) (int64, error)
-	DeleteMany(ctx context.Context, collection string, filter bson.D) (int64, error)
+	CountDocuments(ctx context.Context, collection string, filter any, opts ...options.Lister[options.CountOptions]) (int64, error)
+	EstimatedDocumentCount(ctx context.Context, collection string, opts ...options.Lister[options.EstimatedDocumentCountOptions]) (int64, error)
+	Distinct(ctx context.Context, collection string, field string, filter any, opts ...options.Lister[options.DistinctOptions]) (bson.RawArray, error)
+	UpdateOne(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error)
+	UpdateMany(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error)
+	DeleteOne(ctx context.Context, collection string, filter bson.D) (*WriteResult, error)
+	DeleteMany(ctx context.Context, collection string, filter bson.D) (*WriteResult, error)
+	Upsert(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error)
+	ReplaceOne(ctx context.Context, collection string, filter bson.D, doc DocInter) (*WriteResult, error)
+	FindOneAndUpdate(ctx context.Context, collection string, filter any, update bson.D, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult
+	FindOneAndDelete(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOneAndDeleteOptions]) *mongo.SingleResult
 
 	PipeFind(ctx context.Context, collection string, pipeline mongo.Pipeline) (*mongo.Cursor, error)
 	PipeFindOne(ctx context.Context, collection string, pipeline mongo.Pipeline) *mongo.SingleResult
 
-	NewBulkOperation(cname string) BulkOperator
-	getCollection(name string) *mongo.Collection
+	Watch(ctx context.Context, collection string, pipeline mongo.Pipeline, opts ...options.Lister[options.ChangeStreamOptions]) (ChangeStream, error)
+
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+
+	UploadFile(ctx context.Context, bucket, name string, source io.Reader, metadata any) (bson.ObjectID, error)
+	OpenDownloadStream(ctx context.Context, bucket string, fileID any) (FileReader, error)
+	DeleteFile(ctx context.Context, bucket string, fileID any) error
+	FindFiles(ctx context.Context, bucket string, filter any) ([]*File, error)
+
+	NewBulkOperation(cname string, opts ...BulkOption) BulkOperator
+	// getCollection returns the driver collection, for features that need the driver itself.
+	getCollection(name string) (*mongo.Collection, error)
+	// database returns the datastore of another database on the same connection.
+	database(name string) Datastore
 	close(ctx context.Context) error
 }
 
@@ -32,8 +53,12 @@ type BulkOperator interface {
 	InsertOne(doc DocInter) BulkOperator
 	UpdateOne(filter any, update any) BulkOperator
 	UpdateById(id any, update any) BulkOperator
+	UpdateMany(filter any, update any) BulkOperator
+	Upsert(filter any, update any) BulkOperator
 	DeleteOne(filter any) BulkOperator
 	DeleteById(id any) BulkOperator
+	DeleteMany(filter any) BulkOperator
+	ReplaceOne(filter any, replacement DocInter) BulkOperator
 
 	Execute(ctx context.Context) (*mongo.BulkWriteResult, error)
 }
@@ -44,10 +69,38 @@ type mongoStore struct {
 	db *mongo.Database
 }
 
-func (m *mongoStore) getCollection(name string) *mongo.Collection {
+func (m *mongoStore) getCollection(name string) (*mongo.Collection, error) {
+	return m.db.Collection(name), nil
+}
+
+// collection returns the named collection with the overrides set on ctx applied,
+// see WithReadPreference, WithReadConcern and WithWriteConcern.
+func (m *mongoStore) collection(ctx context.Context, name string) *mongo.Collection {
+	if opts := collectionOptions(ctx); opts != nil {
+		return m.db.Collection(name, opts)
+	}
 	return m.db.Collection(name)
 }
 
+// collectionOptions converts the overrides set on ctx, or returns nil if there are none.
+func collectionOptions(ctx context.Context) *options.CollectionOptionsBuilder {
+	o, ok := ctx.Value(callOptionsKey{}).(callOptions)
+	if !ok {
+		return nil
+	}
+	opts := options.Collection()
+	if o.readPref != nil {
+		opts.SetReadPreference(o.readPref)
+	}
+	if o.readConcern != nil {
+		opts.SetReadConcern(o.readConcern)
+	}
+	if o.writeConcern != nil {
+		opts.SetWriteConcern(o.writeConcern)
+	}
+	return opts
+}
+
 func (m *mongoStore) close(ctx context.Context) error {
 	return m.db.Client().Disconnect(ctx)
 }
@@ -8,44 +8,130 @@ import (
 )
 
 // DeleteOne deletes a single document matching the filter.
+// It returns ErrNotFound, along with the result, when no document matched.
+// Models embedding SoftDelete are flagged as deleted instead of being removed.
 // doc: An instance of the document type, used to determine the collection.
-func DeleteOne[T DocInter](ctx context.Context, doc T, filter bson.D) (int64, error) {
-	if dataStore == nil {
-		return 0, ErrNotConnected
+func DeleteOne[T DocInter](ctx context.Context, doc T, filter bson.D) (*WriteResult, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return nil, ErrNotConnected
 	}
-	return dataStore.DeleteOne(ctx, doc.C(), filter)
+	if err := beforeDelete(ctx, doc); err != nil {
+		return nil, err
+	}
+	filter, err := tenantFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, err
+	}
+	filter, err = encryptFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, err
+	}
+	if isSoftDeletable(doc) {
+		return softDelete(ctx, ds, doc, filter, false)
+	}
+	return deleteOne(ctx, ds, doc, filter)
 }
 
 // DeleteMany deletes all documents matching the filter.
+// Models embedding SoftDelete are flagged as deleted instead of being removed.
 // doc: An instance of the document type, used to determine the collection.
-func DeleteMany[T DocInter](ctx context.Context, doc T, filter bson.D) (int64, error) {
-	if dataStore == nil {
-		return 0, ErrNotConnected
+func DeleteMany[T DocInter](ctx context.Context, doc T, filter bson.D) (*WriteResult, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return nil, ErrNotConnected
+	}
+	if err := beforeDelete(ctx, doc); err != nil {
+		return nil, err
+	}
+	filter, err := tenantFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, err
+	}
+	filter, err = encryptFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, err
+	}
+	if isSoftDeletable(doc) {
+		return softDelete(ctx, ds, doc, filter, true)
+	}
+	filter, audit, err := beginAudit(ctx, ds, doc, AuditDelete, filter, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := ds.DeleteMany(ctx, doc.C(), filter)
+	if err == nil {
+		audit.finish(nil)
 	}
-	return dataStore.DeleteMany(ctx, doc.C(), filter)
+	return result, err
 }
 
 // DeleteById deletes a single document identified by the _id of the provided document instance.
 // doc: An instance of the document, from which the _id is extracted for the filter.
-func DeleteById[T DocInter](ctx context.Context, doc T) (int64, error) {
-	if dataStore == nil {
-		return 0, ErrNotConnected
+//
+// Models embedding SoftDelete are flagged as deleted instead of being removed;
+// use HardDelete to remove them physically. It returns ErrNotFound when no
+// document has that _id. Models implementing BeforeDeleter may abort the delete.
+func DeleteById[T DocInter](ctx context.Context, doc T) (*WriteResult, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return nil, ErrNotConnected
+	}
+	if err := beforeDelete(ctx, doc); err != nil {
+		return nil, err
+	}
+	filter, err := tenantFilter(ctx, doc, bson.D{{Key: "_id", Value: doc.GetId()}})
+	if err != nil {
+		return nil, err
+	}
+	if isSoftDeletable(doc) {
+		return softDelete(ctx, ds, doc, filter, false)
+	}
+	return deleteOne(ctx, ds, doc, filter)
+}
+
+// HardDelete physically removes the document identified by the _id of doc,
+// bypassing soft delete.
+func HardDelete[T DocInter](ctx context.Context, doc T) (*WriteResult, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return nil, ErrNotConnected
+	}
+	if err := beforeDelete(ctx, doc); err != nil {
+		return nil, err
+	}
+	filter, err := tenantFilter(ctx, doc, bson.D{{Key: "_id", Value: doc.GetId()}})
+	if err != nil {
+		return nil, err
+	}
+	return deleteOne(ctx, ds, doc, filter)
+}
+
+// deleteOne removes the first document matching filter, recording it in the audit trail.
+func deleteOne(ctx context.Context, ds Datastore, doc DocInter, filter bson.D) (*WriteResult, error) {
+	filter, audit, err := beginAudit(ctx, ds, doc, AuditDelete, filter, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := requireDelete(ds.DeleteOne(ctx, doc.C(), filter))
+	if err == nil {
+		audit.finish(nil)
 	}
-	return dataStore.DeleteOne(ctx, doc.C(), bson.D{{Key: "_id", Value: doc.GetId()}})
+	return result, err
 }
 
-func (m *mongoStore) DeleteMany(ctx context.Context, collection string, filter bson.D) (int64, error) {
-	result, err := m.getCollection(collection).DeleteMany(ctx, filter)
+func (m *mongoStore) DeleteMany(ctx context.Context, collection string, filter bson.D) (*WriteResult, error) {
+	result, err := m.collection(ctx, collection).DeleteMany(ctx, filter)
 	if err != nil {
-		return 0, errors.Join(ErrWriteFailed, err)
+		return nil, errors.Join(ErrWriteFailed, err)
 	}
-	return result.DeletedCount, nil
+	return &WriteResult{DeletedCount: result.DeletedCount}, nil
 }
 
-func (m *mongoStore) DeleteOne(ctx context.Context, collection string, filter bson.D) (int64, error) {
-	result, err := m.getCollection(collection).DeleteOne(ctx, filter)
+func (m *mongoStore) DeleteOne(ctx context.Context, collection string, filter bson.D) (*WriteResult, error) {
+	result, err := m.collection(ctx, collection).DeleteOne(ctx, filter)
 	if err != nil {
-		return 0, errors.Join(ErrWriteFailed, err)
+		return nil, errors.Join(ErrWriteFailed, err)
 	}
-	return result.DeletedCount, nil
+	return &WriteResult{DeletedCount: result.DeletedCount}, nil
 }
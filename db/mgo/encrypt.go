@@ -0,0 +1,809 @@
+package mgo
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// encryptedPrefix marks stored values written by the field encryption.
+// The full format is "vulpes:enc:v1:<key id>:<base64 nonce and ciphertext>".
+const encryptedPrefix = "vulpes:enc:v1:"
+
+// KeyProvider supplies the keys used by field encryption. Keys must be 32 bytes.
+// Key IDs are stored next to every encrypted value, so rotating keys only requires
+// a new current key while the old ones remain available to Key.
+type KeyProvider interface {
+	// CurrentKey returns the ID and the key new values are encrypted with.
+	CurrentKey(ctx context.Context) (id string, key []byte, err error)
+	// Key returns the key with the given ID.
+	Key(ctx context.Context, id string) ([]byte, error)
+}
+
+// KeyLister is implemented by key providers that can enumerate their keys. Queries on
+// deterministic fields then also match values still encrypted with an older key;
+// with other providers they only match values encrypted with the current key.
+type KeyLister interface {
+	// KeyIDs returns the IDs of all keys that values may be encrypted with.
+	KeyIDs(ctx context.Context) ([]string, error)
+}
+
+// keyProvider is the provider used for models with encrypted fields, see SetKeyProvider.
+var keyProvider KeyProvider
+
+// SetKeyProvider sets the provider of the field encryption keys and returns a
+// function restoring the previous one.
+func SetKeyProvider(p KeyProvider) (restore func()) {
+	original := keyProvider
+	keyProvider = p
+	return func() {
+		keyProvider = original
+	}
+}
+
+// KeyRing is a KeyProvider holding its keys in memory, e.g. loaded from a secret store at startup.
+type KeyRing struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewKeyRing returns a KeyRing encrypting with the key named current. The other keys
+// are kept to decrypt values written before a rotation.
+func NewKeyRing(current string, keys map[string][]byte) (*KeyRing, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%w: current key %q not found", ErrEncryption, current)
+	}
+	ring := &KeyRing{current: current, keys: make(map[string][]byte, len(keys))}
+	for id, key := range keys {
+		if err := checkKey(id, key); err != nil {
+			return nil, err
+		}
+		ring.keys[id] = append([]byte(nil), key...)
+	}
+	return ring, nil
+}
+
+func (r *KeyRing) CurrentKey(ctx context.Context) (string, []byte, error) {
+	return r.current, r.keys[r.current], nil
+}
+
+func (r *KeyRing) KeyIDs(ctx context.Context) ([]string, error) {
+	ids := make([]string, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (r *KeyRing) Key(ctx context.Context, id string) ([]byte, error) {
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrEncryption, id)
+	}
+	return key, nil
+}
+
+// checkKey rejects keys of the wrong size and IDs that cannot be stored in the value format.
+func checkKey(id string, key []byte) error {
+	if id == "" || strings.Contains(id, ":") {
+		return fmt.Errorf("%w: invalid key id %q", ErrEncryption, id)
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("%w: key %q must be 32 bytes, got %d", ErrEncryption, id, len(key))
+	}
+	return nil
+}
+
+// encryptedField is a string field tagged with `vulpes:"encrypt"`.
+type encryptedField struct {
+	index []int
+	// path is the dotted name of the field in the stored document, as used in filters.
+	path string
+	// deterministic fields encrypt equal values to equal ciphertexts so they can be queried.
+	deterministic bool
+}
+
+// encryptedFieldCache maps a struct type to its []encryptedField.
+var encryptedFieldCache sync.Map
+
+// encryptedFields returns the encrypted fields of the model type t.
+func encryptedFields(t reflect.Type) []encryptedField {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	if fields, ok := encryptedFieldCache.Load(t); ok {
+		return fields.([]encryptedField)
+	}
+	var fields []encryptedField
+	collectEncrypted(t, nil, "", map[reflect.Type]bool{}, &fields)
+	encryptedFieldCache.Store(t, fields)
+	return fields
+}
+
+// collectEncrypted adds the encrypted fields of t, descending into inline and nested structs.
+func collectEncrypted(t reflect.Type, index []int, prefix string, seen map[reflect.Type]bool, out *[]encryptedField) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, inline, skip := bsonFieldName(f)
+		if skip {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		ft := f.Type
+		if tag := parseTag(f); tag.has("encrypt") {
+			if ft.Kind() == reflect.String || (ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.String) {
+				*out = append(*out, encryptedField{
+					index:         fieldIndex,
+					path:          prefix + name,
+					deterministic: tag.has("deterministic"),
+				})
+			}
+			continue
+		}
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct || ft == typeTime {
+			continue
+		}
+		if inline {
+			collectEncrypted(ft, fieldIndex, prefix, seen, out)
+		} else {
+			collectEncrypted(ft, fieldIndex, prefix+name+".", seen, out)
+		}
+	}
+}
+
+// fieldCipher encrypts and decrypts the values of one operation, loading each key once.
+type fieldCipher struct {
+	ctx      context.Context
+	provider KeyProvider
+	current  string
+	keys     map[string][]byte
+	// ids are the keys queries match against, loaded on first use.
+	ids []string
+}
+
+func newFieldCipher(ctx context.Context) (*fieldCipher, error) {
+	if keyProvider == nil {
+		return nil, fmt.Errorf("%w: no key provider set", ErrEncryption)
+	}
+	return &fieldCipher{ctx: ctx, provider: keyProvider, keys: map[string][]byte{}}, nil
+}
+
+// currentKey returns the ID of the current key, loading it on first use.
+func (c *fieldCipher) currentKey() (string, error) {
+	if c.current != "" {
+		return c.current, nil
+	}
+	id, key, err := c.provider.CurrentKey(c.ctx)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrEncryption, err)
+	}
+	if err := checkKey(id, key); err != nil {
+		return "", err
+	}
+	c.current, c.keys[id] = id, key
+	return id, nil
+}
+
+// keyIDs returns the current key followed by the other keys of a KeyLister provider.
+func (c *fieldCipher) keyIDs() ([]string, error) {
+	if c.ids != nil {
+		return c.ids, nil
+	}
+	current, err := c.currentKey()
+	if err != nil {
+		return nil, err
+	}
+	c.ids = []string{current}
+	lister, ok := c.provider.(KeyLister)
+	if !ok {
+		return c.ids, nil
+	}
+	ids, err := lister.KeyIDs(c.ctx)
+	if err != nil {
+		c.ids = nil
+		return nil, fmt.Errorf("%w: %w", ErrEncryption, err)
+	}
+	for _, id := range ids {
+		if id != current {
+			c.ids = append(c.ids, id)
+		}
+	}
+	return c.ids, nil
+}
+
+func (c *fieldCipher) key(id string) ([]byte, error) {
+	if key, ok := c.keys[id]; ok {
+		return key, nil
+	}
+	key, err := c.provider.Key(c.ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncryption, err)
+	}
+	if err := checkKey(id, key); err != nil {
+		return nil, err
+	}
+	c.keys[id] = key
+	return key, nil
+}
+
+// seal encrypts plaintext with the current key using AES-256-GCM. The field path is
+// authenticated, so a value cannot be copied to another field. Deterministic fields
+// derive the nonce from the plaintext, making equal values encrypt equally.
+func (c *fieldCipher) seal(f encryptedField, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	id, err := c.currentKey()
+	if err != nil {
+		return "", err
+	}
+	return c.sealWith(f, id, plaintext)
+}
+
+// sealWith encrypts plaintext like seal, with the key of the given ID.
+func (c *fieldCipher) sealWith(f encryptedField, id string, plaintext string) (string, error) {
+	key, err := c.key(id)
+	if err != nil {
+		return "", err
+	}
+	aead, macKey, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if f.deterministic {
+		mac := hmac.New(sha256.New, macKey)
+		mac.Write([]byte(f.path))
+		mac.Write([]byte{0})
+		mac.Write([]byte(plaintext))
+		copy(nonce, mac.Sum(nil))
+	} else if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrEncryption, err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(f.path))
+	return encryptedPrefix + id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a stored value. Values without the encryption prefix, such as data
+// written before the field was encrypted, are returned unchanged. stale reports
+// whether the value is not encrypted with the current key.
+func (c *fieldCipher) open(f encryptedField, value string) (plaintext string, stale bool, err error) {
+	rest, ok := strings.CutPrefix(value, encryptedPrefix)
+	if !ok {
+		return value, value != "", nil
+	}
+	id, encoded, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", false, fmt.Errorf("%w: malformed value in %s", ErrEncryption, f.path)
+	}
+	key, err := c.key(id)
+	if err != nil {
+		return "", false, err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false, fmt.Errorf("%w: malformed value in %s: %w", ErrEncryption, f.path, err)
+	}
+	aead, _, err := newAEAD(key)
+	if err != nil {
+		return "", false, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", false, fmt.Errorf("%w: malformed value in %s", ErrEncryption, f.path)
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	opened, err := aead.Open(nil, nonce, ciphertext, []byte(f.path))
+	if err != nil {
+		return "", false, fmt.Errorf("%w: cannot decrypt %s: %w", ErrEncryption, f.path, err)
+	}
+	current, err := c.currentKey()
+	if err != nil {
+		return "", false, err
+	}
+	return string(opened), id != current, nil
+}
+
+// newAEAD derives independent encryption and nonce keys from key.
+func newAEAD(key []byte) (cipher.AEAD, []byte, error) {
+	derive := func(label string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(label))
+		return mac.Sum(nil)
+	}
+	block, err := aes.NewCipher(derive("vulpes encryption key"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrEncryption, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrEncryption, err)
+	}
+	return aead, derive("vulpes nonce key"), nil
+}
+
+// fieldValues returns the settable encrypted fields of doc, skipping fields behind nil pointers.
+func fieldValues(doc any, fields []encryptedField) []reflect.Value {
+	v := reflect.ValueOf(doc)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil
+	}
+	v = v.Elem()
+	values := make([]reflect.Value, len(fields))
+	for i, f := range fields {
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil || (fv.Kind() == reflect.Ptr && fv.IsNil()) {
+			continue
+		}
+		values[i] = fv
+	}
+	return values
+}
+
+// encryptDoc replaces the encrypted fields of doc with their ciphertexts before a write.
+// The returned function puts the plaintexts back. Pointer fields get a new pointer,
+// so strings shared with the caller are never modified.
+func encryptDoc(ctx context.Context, doc any) (restore func(), err error) {
+	restore = func() {}
+	fields := encryptedFields(reflect.TypeOf(doc))
+	if len(fields) == 0 {
+		return restore, nil
+	}
+	c, err := newFieldCipher(ctx)
+	if err != nil {
+		return restore, err
+	}
+	values := fieldValues(doc, fields)
+	originals := make([]reflect.Value, len(values))
+	restore = func() {
+		for i, fv := range values {
+			if originals[i].IsValid() {
+				fv.Set(originals[i])
+			}
+		}
+	}
+	for i, fv := range values {
+		if !fv.IsValid() {
+			continue
+		}
+		originals[i] = reflect.ValueOf(fv.Interface())
+		if fv.Kind() == reflect.Ptr {
+			sealed, err := c.seal(fields[i], fv.Elem().String())
+			if err != nil {
+				restore()
+				return func() {}, err
+			}
+			fv.Set(reflect.ValueOf(&sealed))
+			continue
+		}
+		sealed, err := c.seal(fields[i], fv.String())
+		if err != nil {
+			restore()
+			return func() {}, err
+		}
+		fv.SetString(sealed)
+	}
+	return restore, nil
+}
+
+// decryptDoc replaces the ciphertexts in the encrypted fields of a loaded doc with their
+// plaintexts. stale reports whether any value is not encrypted with the current key.
+func decryptDoc(ctx context.Context, doc any) (stale bool, err error) {
+	fields := encryptedFields(reflect.TypeOf(doc))
+	if len(fields) == 0 {
+		return false, nil
+	}
+	c, err := newFieldCipher(ctx)
+	if err != nil {
+		return false, err
+	}
+	for i, fv := range fieldValues(doc, fields) {
+		if !fv.IsValid() {
+			continue
+		}
+		target := fv
+		if fv.Kind() == reflect.Ptr {
+			target = fv.Elem()
+		}
+		plaintext, old, err := c.open(fields[i], target.String())
+		if err != nil {
+			return false, err
+		}
+		if fv.Kind() == reflect.Ptr {
+			fv.Set(reflect.ValueOf(&plaintext))
+		} else {
+			target.SetString(plaintext)
+		}
+		stale = stale || old
+	}
+	return stale, nil
+}
+
+// decryptDocs is decryptDoc for a slice of loaded documents.
+func decryptDocs[T any](ctx context.Context, docs []T) error {
+	if len(docs) == 0 || len(encryptedFields(reflect.TypeOf(docs[0]))) == 0 {
+		return nil
+	}
+	for _, doc := range docs {
+		if _, err := decryptDoc(ctx, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openDistinct decrypts the distinct values of path when it is an encrypted field of doc.
+// Equal plaintexts encrypted with different keys are merged.
+func openDistinct[V any](ctx context.Context, doc any, path string, values []V) ([]V, error) {
+	var field *encryptedField
+	for _, f := range encryptedFields(reflect.TypeOf(doc)) {
+		if f.path == path {
+			field = &f
+			break
+		}
+	}
+	if field == nil {
+		return values, nil
+	}
+	if !field.deterministic {
+		return nil, fmt.Errorf("%w: %s is randomly encrypted and has no distinct values", ErrEncryption, path)
+	}
+	c, err := newFieldCipher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(values))
+	out := make([]V, 0, len(values))
+	for _, v := range values {
+		value, ok := any(v).(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: distinct values of %s must be decoded as strings", ErrEncryption, path)
+		}
+		plaintext, _, err := c.open(*field, value)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[plaintext] {
+			seen[plaintext] = true
+			out = append(out, any(plaintext).(V))
+		}
+	}
+	return out, nil
+}
+
+// encryptFilter encrypts the conditions on deterministic fields of doc in filter.
+// Equality, $eq, $ne, $in and $nin are supported, also inside $and, $or and $nor.
+// Values are encrypted with every key of a KeyLister provider, so equality becomes
+// $in and $ne becomes $nin over the ciphertexts.
+// Conditions on randomly encrypted fields cannot match and are rejected.
+// bson.D and bson.M filters are copied; other filter types are returned unchanged.
+func encryptFilter[F any](ctx context.Context, doc any, filter F) (F, error) {
+	fields := encryptedFields(reflect.TypeOf(doc))
+	if len(fields) == 0 {
+		return filter, nil
+	}
+	byPath := make(map[string]encryptedField, len(fields))
+	for _, f := range fields {
+		byPath[f.path] = f
+	}
+	c, err := newFieldCipher(ctx)
+	if err != nil {
+		return filter, err
+	}
+	out, err := c.filter(byPath, filter)
+	if err != nil {
+		return filter, err
+	}
+	result, _ := out.(F)
+	return result, nil
+}
+
+func (c *fieldCipher) filter(fields map[string]encryptedField, filter any) (any, error) {
+	switch f := filter.(type) {
+	case bson.D:
+		out := make(bson.D, len(f))
+		for i, e := range f {
+			v, err := c.condition(fields, e.Key, e.Value)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = bson.E{Key: e.Key, Value: v}
+		}
+		return out, nil
+	case bson.M:
+		out := make(bson.M, len(f))
+		for k, value := range f {
+			v, err := c.condition(fields, k, value)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = v
+		}
+		return out, nil
+	default:
+		return filter, nil
+	}
+}
+
+func (c *fieldCipher) condition(fields map[string]encryptedField, key string, value any) (any, error) {
+	switch key {
+	case "$and", "$or", "$nor":
+		return c.each(value, func(v any) (any, error) { return c.filter(fields, v) })
+	}
+	f, ok := fields[key]
+	if !ok {
+		return value, nil
+	}
+	if !f.deterministic {
+		return nil, fmt.Errorf("%w: field %s is not deterministic and cannot be queried", ErrEncryption, f.path)
+	}
+	var operators bson.D
+	switch v := value.(type) {
+	case bson.D:
+		operators = v
+	case bson.M:
+		for op, operand := range v {
+			operators = append(operators, bson.E{Key: op, Value: operand})
+		}
+	default:
+		values, err := c.sealQueryValues(f, value)
+		if err != nil || len(values) > 1 {
+			return bson.D{{Key: "$in", Value: values}}, err
+		}
+		return values[0], nil
+	}
+	out := make(bson.D, 0, len(operators))
+	for _, e := range operators {
+		op, v := e.Key, e.Value
+		var err error
+		switch op {
+		case "$eq", "$ne":
+			var values bson.A
+			values, err = c.sealQueryValues(f, v)
+			if len(values) == 1 {
+				v = values[0]
+			} else if op == "$eq" {
+				op, v = "$in", values
+			} else {
+				op, v = "$nin", values
+			}
+		case "$in", "$nin":
+			v, err = c.sealQueryList(f, v)
+		case "$exists", "$type":
+		default:
+			err = fmt.Errorf("%w: operator %s is not supported on encrypted field %s", ErrEncryption, op, f.path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hasKey(out, op) {
+			return nil, fmt.Errorf("%w: operators on encrypted field %s overlap once encrypted, combine them into one $in or $nin", ErrEncryption, f.path)
+		}
+		out = append(out, bson.E{Key: op, Value: v})
+	}
+	return out, nil
+}
+
+// sealQueryValues encrypts a value compared with a deterministic field with every key
+// returned by keyIDs. Values that are not encrypted, like nil, are returned once.
+func (c *fieldCipher) sealQueryValues(f encryptedField, value any) (bson.A, error) {
+	sealed, err := c.sealQueryValue(f, value)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, ok := value.(string)
+	if p, isPtr := value.(*string); isPtr && p != nil {
+		plaintext, ok = *p, true
+	}
+	if !ok || plaintext == "" {
+		return bson.A{sealed}, nil
+	}
+	ids, err := c.keyIDs()
+	if err != nil {
+		return nil, err
+	}
+	values := bson.A{sealed}
+	for _, id := range ids[1:] {
+		v, err := c.sealWith(f, id, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// sealQueryList encrypts the array operand of $in or $nin with sealQueryValues.
+func (c *fieldCipher) sealQueryList(f encryptedField, value any) (bson.A, error) {
+	lists, err := c.each(value, func(v any) (any, error) { return c.sealQueryValues(f, v) })
+	if err != nil {
+		return nil, err
+	}
+	out := bson.A{}
+	for _, values := range lists.(bson.A) {
+		out = append(out, values.(bson.A)...)
+	}
+	return out, nil
+}
+
+// sealQueryValue encrypts a value compared with an encrypted field.
+func (c *fieldCipher) sealQueryValue(f encryptedField, value any) (any, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return c.seal(f, v)
+	case *string:
+		if v == nil {
+			return nil, nil
+		}
+		return c.seal(f, *v)
+	default:
+		return nil, fmt.Errorf("%w: field %s can only be compared with strings, got %T", ErrEncryption, f.path, value)
+	}
+}
+
+// each applies fn to every element of the slice value and returns the results as a bson.A.
+func (c *fieldCipher) each(value any, fn func(any) (any, error)) (any, error) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%w: expected an array, got %T", ErrEncryption, value)
+	}
+	out := make(bson.A, rv.Len())
+	for i := range out {
+		v, err := fn(rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// encryptUpdate encrypts the values assigned to encrypted fields of doc by the $set and
+// $setOnInsert stages of update. The original update is not modified.
+func encryptUpdate(ctx context.Context, doc any, update bson.D) (bson.D, error) {
+	fields := encryptedFields(reflect.TypeOf(doc))
+	if len(fields) == 0 {
+		return update, nil
+	}
+	byPath := make(map[string]encryptedField, len(fields))
+	for _, f := range fields {
+		byPath[f.path] = f
+	}
+	c, err := newFieldCipher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(bson.D, len(update))
+	for i, e := range update {
+		out[i] = e
+		if e.Key != "$set" && e.Key != "$setOnInsert" {
+			continue
+		}
+		switch set := e.Value.(type) {
+		case bson.D:
+			ns := make(bson.D, len(set))
+			for j, se := range set {
+				v, err := c.sealAssigned(byPath, se.Key, se.Value)
+				if err != nil {
+					return nil, err
+				}
+				ns[j] = bson.E{Key: se.Key, Value: v}
+			}
+			out[i].Value = ns
+		case bson.M:
+			nm := make(bson.M, len(set))
+			for k, value := range set {
+				v, err := c.sealAssigned(byPath, k, value)
+				if err != nil {
+					return nil, err
+				}
+				nm[k] = v
+			}
+			out[i].Value = nm
+		}
+	}
+	return out, nil
+}
+
+func (c *fieldCipher) sealAssigned(fields map[string]encryptedField, key string, value any) (any, error) {
+	f, ok := fields[key]
+	if !ok {
+		return value, nil
+	}
+	return c.sealQueryValue(f, value)
+}
+
+// RotateEncryption re-encrypts the encrypted fields of the documents of doc's collection
+// matching filter with the current key, e.g. after KeyProvider started returning a new
+// key, so old keys can be retired. Values stored before the model encrypted them are
+// encrypted as well. Documents already using the current key are not written. filter
+// is passed through unchanged and may be nil; soft-deleted documents are included.
+// It returns the number of rewritten documents.
+func RotateEncryption[T DocInter](ctx context.Context, doc T, filter any) (int64, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return 0, ErrNotConnected
+	}
+	if len(encryptedFields(reflect.TypeOf(doc))) == 0 {
+		return 0, nil
+	}
+	filter, err := tenantFilter(ctx, doc, filter)
+	if err != nil {
+		return 0, err
+	}
+	if filter == nil {
+		filter = bson.D{}
+	}
+	cursor, err := ds.Find(ctx, doc.C(), filter)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	defer func() { _ = cursor.Close(ctx) }()
+
+	var rotated int64
+	for cursor.Next(ctx) {
+		var current T
+		if err := cursor.Decode(&current); err != nil {
+			return rotated, fmt.Errorf("%w: %w", ErrReadFailed, err)
+		}
+		stale, err := decryptDoc(ctx, current)
+		if err != nil {
+			return rotated, err
+		}
+		if !stale {
+			continue
+		}
+		if _, err := encryptDoc(ctx, current); err != nil {
+			return rotated, err
+		}
+		if _, err := requireMatch(ds.ReplaceOne(ctx, doc.C(), bson.D{{Key: "_id", Value: current.GetId()}}, current)); err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	if err := cursor.Err(); err != nil {
+		return rotated, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return rotated, nil
+}
+
+// encryptWrite applies encryptFilter and encryptUpdate to the filter and update of a write.
+func encryptWrite(ctx context.Context, doc any, filter, update bson.D) (bson.D, bson.D, error) {
+	filter, err := encryptFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	update, err = encryptUpdate(ctx, doc, update)
+	if err != nil {
+		return nil, nil, err
+	}
+	return filter, update, nil
+}
@@ -0,0 +1,245 @@
+package mgo_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// testCustomer stores its contact details encrypted.
+type testCustomer struct {
+	ID      bson.ObjectID `bson:"_id,omitempty"`
+	Name    string        `bson:"name"`
+	Email   string        `bson:"email" vulpes:"encrypt,deterministic"`
+	Phone   *string       `bson:"phone,omitempty" vulpes:"encrypt"`
+	Address struct {
+		Street string `bson:"street" vulpes:"encrypt"`
+	} `bson:"address"`
+}
+
+func (c *testCustomer) C() string                   { return "customers" }
+func (c *testCustomer) Indexes() []mongo.IndexModel { return nil }
+func (c *testCustomer) Validate() error             { return nil }
+func (c *testCustomer) GetId() any                  { return c.ID }
+func (c *testCustomer) SetId(id any)                { c.ID = id.(bson.ObjectID) }
+
+func testKeyRing(t *testing.T, current string) *mgo.KeyRing {
+	t.Helper()
+	ring, err := mgo.NewKeyRing(current, map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	})
+	assert.NoError(t, err)
+	return ring
+}
+
+// rawCustomer is a stored testCustomer, decoded without decryption.
+type rawCustomer struct {
+	Name    string `bson:"name"`
+	Email   string `bson:"email"`
+	Phone   string `bson:"phone"`
+	Address struct {
+		Street string `bson:"street"`
+	} `bson:"address"`
+}
+
+func rawCustomers(t *testing.T, store mgo.Datastore) []rawCustomer {
+	t.Helper()
+	cursor, err := store.Find(context.Background(), "customers", bson.D{})
+	assert.NoError(t, err)
+	var docs []rawCustomer
+	assert.NoError(t, cursor.All(context.Background(), &docs))
+	return docs
+}
+
+func TestFieldEncryption(t *testing.T) {
+	store := mgo.NewMemoryDatastore()
+	defer mgo.SetDatastore(store)()
+	defer mgo.SetKeyProvider(testKeyRing(t, "k1"))()
+	ctx := context.Background()
+
+	phone := "+886 912 345 678"
+	customer := &testCustomer{Name: "Ann", Email: "ann@example.com", Phone: &phone}
+	customer.Address.Street = "1 Main St"
+	_, err := mgo.Save(ctx, customer)
+	assert.NoError(t, err)
+	_, err = mgo.Save(ctx, &testCustomer{Name: "Bob", Email: "bob@example.com"})
+	assert.NoError(t, err)
+
+	t.Run("Caller keeps the plaintext", func(t *testing.T) {
+		assert.Equal(t, "ann@example.com", customer.Email)
+		assert.Equal(t, "+886 912 345 678", *customer.Phone)
+		assert.Equal(t, "1 Main St", customer.Address.Street)
+	})
+
+	t.Run("Stores ciphertexts", func(t *testing.T) {
+		raw := rawCustomers(t, store)[0]
+		assert.Equal(t, "Ann", raw.Name)
+		for _, v := range []string{raw.Email, raw.Phone, raw.Address.Street} {
+			assert.True(t, strings.HasPrefix(v, "vulpes:enc:v1:k1:"), v)
+		}
+	})
+
+	t.Run("Decrypts reads", func(t *testing.T) {
+		found := &testCustomer{ID: customer.ID}
+		assert.NoError(t, mgo.FindById(ctx, found))
+		assert.Equal(t, "ann@example.com", found.Email)
+		assert.Equal(t, phone, *found.Phone)
+		assert.Equal(t, "1 Main St", found.Address.Street)
+	})
+
+	t.Run("Queries deterministic fields", func(t *testing.T) {
+		found, err := mgo.Find(ctx, &testCustomer{}, bson.D{{Key: "email", Value: "bob@example.com"}})
+		assert.NoError(t, err)
+		assert.Len(t, found, 1)
+		assert.Equal(t, "Bob", found[0].Name)
+
+		found, err = mgo.Find(ctx, &testCustomer{}, bson.M{"$or": bson.A{
+			bson.M{"email": bson.M{"$in": []string{"ann@example.com", "bob@example.com"}}},
+		}})
+		assert.NoError(t, err)
+		assert.Len(t, found, 2)
+	})
+
+	t.Run("Rejects queries on randomized fields", func(t *testing.T) {
+		_, err := mgo.Find(ctx, &testCustomer{}, bson.D{{Key: "phone", Value: phone}})
+		assert.ErrorIs(t, err, mgo.ErrEncryption)
+
+		_, err = mgo.Find(ctx, &testCustomer{}, bson.D{{Key: "email", Value: bson.D{{Key: "$regex", Value: "^ann"}}}})
+		assert.ErrorIs(t, err, mgo.ErrEncryption)
+	})
+
+	t.Run("Encrypts updates", func(t *testing.T) {
+		_, err := mgo.UpdateOne(ctx, &testCustomer{},
+			bson.D{{Key: "email", Value: "bob@example.com"}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "email", Value: "robert@example.com"}}}})
+		assert.NoError(t, err)
+
+		found := &testCustomer{}
+		assert.NoError(t, mgo.FindOne(ctx, found, bson.D{{Key: "email", Value: "robert@example.com"}}))
+		assert.Equal(t, "Bob", found.Name)
+	})
+
+	t.Run("Bulk operations", func(t *testing.T) {
+		cid := &testCustomer{Name: "Cid", Email: "cid@example.com"}
+		bulk, err := mgo.NewBulkOperation("customers", mgo.WithModel(&testCustomer{}))
+		assert.NoError(t, err)
+		_, err = bulk.InsertOne(cid).
+			UpdateOne(bson.D{{Key: "email", Value: "cid@example.com"}}, bson.D{{Key: "$set", Value: bson.D{{Key: "email", Value: "c@example.com"}}}}).
+			Execute(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "cid@example.com", cid.Email, "the caller keeps the plaintext")
+		for _, raw := range rawCustomers(t, store) {
+			assert.True(t, strings.HasPrefix(raw.Email, "vulpes:enc:v1:k1:"), raw.Email)
+		}
+
+		bulk, err = mgo.NewBulkOperation("customers", mgo.WithModel(&testCustomer{}))
+		assert.NoError(t, err)
+		result, err := bulk.DeleteMany(bson.D{{Key: "email", Value: "c@example.com"}}).Execute(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), result.DeletedCount)
+
+		bulk, err = mgo.NewBulkOperation("customers", mgo.WithModel(&testCustomer{}))
+		assert.NoError(t, err)
+		_, err = bulk.UpdateMany(bson.D{}, mongo.Pipeline{}).Execute(ctx)
+		assert.ErrorIs(t, err, mgo.ErrEncryption)
+	})
+
+	t.Run("Missing key provider", func(t *testing.T) {
+		restore := mgo.SetKeyProvider(nil)
+		defer restore()
+		_, err := mgo.Save(ctx, &testCustomer{Email: "x@example.com"})
+		assert.ErrorIs(t, err, mgo.ErrEncryption)
+	})
+}
+
+// testContact validates the plaintext of its encrypted email.
+type testContact struct {
+	ID    bson.ObjectID `bson:"_id,omitempty"`
+	Email string        `bson:"email" vulpes:"encrypt"`
+}
+
+func (c *testContact) C() string                   { return "contacts" }
+func (c *testContact) Indexes() []mongo.IndexModel { return nil }
+func (c *testContact) GetId() any                  { return c.ID }
+func (c *testContact) SetId(id any)                { c.ID = id.(bson.ObjectID) }
+func (c *testContact) Validate() error {
+	if !strings.Contains(c.Email, "@") {
+		return errors.New("bad email " + c.Email)
+	}
+	return nil
+}
+
+func TestEncryptionValidatesPlaintext(t *testing.T) {
+	defer mgo.SetDatastore(mgo.NewMemoryDatastore())()
+	defer mgo.SetKeyProvider(testKeyRing(t, "k1"))()
+	ctx := context.Background()
+
+	contact, err := mgo.Save(ctx, &testContact{Email: "ann@example.com"})
+	assert.NoError(t, err)
+	_, err = mgo.InsertMany(ctx, []*testContact{{Email: "bob@example.com"}, {Email: "cat@example.com"}})
+	assert.NoError(t, err)
+	contact.Email = "ann@example.org"
+	_, err = mgo.ReplaceById(ctx, contact)
+	assert.NoError(t, err)
+
+	_, err = mgo.Save(ctx, &testContact{Email: "nobody"})
+	assert.ErrorIs(t, err, mgo.ErrInvalidDocument)
+	assert.ErrorContains(t, err, "bad email nobody")
+}
+
+func TestRotateEncryption(t *testing.T) {
+	store := mgo.NewMemoryDatastore()
+	defer mgo.SetDatastore(store)()
+	restore := mgo.SetKeyProvider(testKeyRing(t, "k1"))
+	ctx := context.Background()
+
+	_, err := mgo.Save(ctx, &testCustomer{Name: "Ann", Email: "ann@example.com"})
+	assert.NoError(t, err)
+	// Written through the datastore directly, like data stored before the field was encrypted.
+	_, err = store.Save(ctx, &testCustomer{Name: "Leo", Email: "leo@example.com"})
+	assert.NoError(t, err)
+	restore()
+
+	defer mgo.SetKeyProvider(testKeyRing(t, "k2"))()
+	found, err := mgo.Find(ctx, &testCustomer{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ann@example.com", found[0].Email, "old keys still decrypt")
+
+	ann := &testCustomer{}
+	assert.NoError(t, mgo.FindOne(ctx, ann, bson.D{{Key: "email", Value: "ann@example.com"}}), "queries match values of old keys")
+	n, err := mgo.Count(ctx, &testCustomer{}, bson.D{{Key: "email", Value: bson.D{{Key: "$ne", Value: "ann@example.com"}}}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	_, err = mgo.Save(ctx, &testCustomer{Name: "Cid", Email: "cid@example.com"})
+	assert.NoError(t, err)
+
+	rotated, err := mgo.RotateEncryption(ctx, &testCustomer{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), rotated, "documents already using k2 are not rewritten")
+	for _, raw := range rawCustomers(t, store) {
+		assert.True(t, strings.HasPrefix(raw.Email, "vulpes:enc:v1:k2:"), raw.Email)
+	}
+
+	found, err = mgo.Find(ctx, &testCustomer{}, bson.D{{Key: "email", Value: bson.D{
+		{Key: "$in", Value: bson.A{"ann@example.com", "leo@example.com"}},
+	}}})
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+}
+
+func TestNewKeyRing(t *testing.T) {
+	_, err := mgo.NewKeyRing("k1", map[string][]byte{"k1": []byte("short")})
+	assert.ErrorIs(t, err, mgo.ErrEncryption)
+	_, err = mgo.NewKeyRing("missing", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	assert.ErrorIs(t, err, mgo.ErrEncryption)
+}
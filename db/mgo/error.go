@@ -5,6 +5,7 @@ package mgo
 import (
 	"errors"
 
+	"go.mongodb.org/mongo-driver/v2/mongo"
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -28,6 +29,19 @@ var (
 	ErrWriteFailed = errors.New("mongodb write failed")
 	// ErrReadFailed is returned when a read operation fails.
 	ErrReadFailed = errors.New("mongodb read failed")
+	// ErrMigrationFailed is returned when a schema migration cannot be planned or executed.
+	ErrMigrationFailed = errors.New("mongodb migration failed")
+	// ErrMigrationLocked is returned when another runner currently holds the migration lock.
+	ErrMigrationLocked = errors.New("mongodb migration locked")
+	// ErrNotFound is returned when a single-document read, update or delete matched no document.
+	ErrNotFound = errors.New("mongodb document not found")
+	// ErrDuplicateKey is returned when a write violates a unique index.
+	ErrDuplicateKey = errors.New("mongodb duplicate key")
+	// ErrEncryption is returned when an encrypted field cannot be encrypted, decrypted or queried.
+	ErrEncryption = errors.New("mongodb field encryption failed")
+	// ErrTenantDenied is returned when an operation on a tenant model has no tenant or
+	// would reach the documents of another tenant.
+	ErrTenantDenied = errors.New("mongodb tenant access denied")
 
 	StatusMongoDBInvalidDocument      = status.New(codes.InvalidArgument, "mongodb invalid document")
 	StatusMongoDBNotConnected         = status.New(codes.Aborted, "mongodb not connected")
@@ -37,6 +51,12 @@ var (
 	StatusMongoDBListCollectionFailed = status.New(codes.Aborted, "mongodb list collection failed")
 	StatusMongoDBWriteFailed          = status.New(codes.Internal, "mongodb write failed")
 	StatusMongoDBReadFailed           = status.New(codes.Internal, "mongodb read failed")
+	StatusMongoDBMigrationFailed      = status.New(codes.Internal, "mongodb migration failed")
+	StatusMongoDBMigrationLocked      = status.New(codes.Aborted, "mongodb migration locked")
+	StatusMongoDBNotFound             = status.New(codes.NotFound, "mongodb document not found")
+	StatusMongoDBDuplicateKey         = status.New(codes.AlreadyExists, "mongodb duplicate key")
+	StatusMongoDBEncryption           = status.New(codes.Internal, "mongodb field encryption failed")
+	StatusMongoDBTenantDenied         = status.New(codes.PermissionDenied, "mongodb tenant access denied")
 )
 
 func ToStatus(err error) *status.Status {
@@ -58,6 +78,18 @@ func ToStatus(err error) *status.Status {
 		baseSt = StatusMongoDBCreateIndexFailed
 	case errors.Is(err, ErrListCollectionFailed):
 		baseSt = StatusMongoDBListCollectionFailed
+	case errors.Is(err, ErrMigrationFailed):
+		baseSt = StatusMongoDBMigrationFailed
+	case errors.Is(err, ErrMigrationLocked):
+		baseSt = StatusMongoDBMigrationLocked
+	case errors.Is(err, ErrNotFound):
+		baseSt = StatusMongoDBNotFound
+	case errors.Is(err, ErrDuplicateKey), mongo.IsDuplicateKeyError(err):
+		baseSt = StatusMongoDBDuplicateKey
+	case errors.Is(err, ErrEncryption):
+		baseSt = StatusMongoDBEncryption
+	case errors.Is(err, ErrTenantDenied):
+		baseSt = StatusMongoDBTenantDenied
 	case errors.Is(err, ErrWriteFailed):
 		baseSt = StatusMongoDBWriteFailed
 	case errors.Is(err, ErrReadFailed):
@@ -0,0 +1,92 @@
+package mgo
+
+import "go.mongodb.org/mongo-driver/v2/bson"
+
+// andFilter returns a copy of filter that additionally requires cond.
+// bson.D and bson.M filters are copied and extended, falling back to $and
+// when the key is already constrained; any other filter type is combined using $and.
+func andFilter(filter any, cond bson.E) any {
+	switch f := filter.(type) {
+	case nil:
+		return bson.D{cond}
+	case bson.D:
+		for _, e := range f {
+			if e.Key == cond.Key {
+				return bson.D{{Key: "$and", Value: bson.A{f, bson.D{cond}}}}
+			}
+		}
+		out := make(bson.D, 0, len(f)+1)
+		out = append(out, f...)
+		return append(out, cond)
+	case bson.M:
+		if _, ok := f[cond.Key]; ok {
+			return bson.D{{Key: "$and", Value: bson.A{f, bson.D{cond}}}}
+		}
+		out := make(bson.M, len(f)+1)
+		for k, v := range f {
+			out[k] = v
+		}
+		out[cond.Key] = cond.Value
+		return out
+	default:
+		return bson.D{{Key: "$and", Value: bson.A{filter, bson.D{cond}}}}
+	}
+}
+
+// mergeSet adds fields to the $set stage of update, creating it if needed.
+// Fields already present in $set are left untouched so callers keep control,
+// and a $set of any other type than bson.D or bson.M is left as is.
+// The original update is not modified.
+func mergeSet(update bson.D, fields bson.D) bson.D {
+	return mergeOperator(update, "$set", fields)
+}
+
+// mergeOperator adds fields to the given update operator stage, see mergeSet.
+func mergeOperator(update bson.D, op string, fields bson.D) bson.D {
+	out := make(bson.D, 0, len(update)+1)
+	found := false
+	for _, e := range update {
+		if e.Key != op {
+			out = append(out, e)
+			continue
+		}
+		found = true
+		switch set := e.Value.(type) {
+		case bson.D:
+			ns := make(bson.D, 0, len(set)+len(fields))
+			ns = append(ns, set...)
+			for _, f := range fields {
+				if !hasKey(set, f.Key) {
+					ns = append(ns, f)
+				}
+			}
+			e.Value = ns
+		case bson.M:
+			nm := make(bson.M, len(set)+len(fields))
+			for k, v := range set {
+				nm[k] = v
+			}
+			for _, f := range fields {
+				if _, ok := nm[f.Key]; !ok {
+					nm[f.Key] = f.Value
+				}
+			}
+			e.Value = nm
+		}
+		out = append(out, e)
+	}
+	if !found {
+		out = append(out, bson.E{Key: op, Value: fields})
+	}
+	return out
+}
+
+// hasKey reports whether d contains the key.
+func hasKey(d bson.D, key string) bool {
+	for _, e := range d {
+		if e.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -9,11 +9,23 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
+// Find returns all documents of doc's collection matching the filter.
+// Soft-deleted documents are excluded unless ctx is wrapped with WithDeleted.
+// Models implementing AfterFinder have AfterFind run on every returned document.
 func Find[T DocInter](ctx context.Context, doc T, filter any, opts ...options.Lister[options.FindOptions]) ([]T, error) {
-	if dataStore == nil {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
 		return nil, ErrNotConnected
 	}
-	result, err := dataStore.Find(ctx, doc.C(), filter, opts...)
+	filter, err := tenantFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, err
+	}
+	filter, err = encryptFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, err
+	}
+	result, err := ds.Find(ctx, doc.C(), scopeFilter(ctx, doc, filter), opts...)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
 	}
@@ -22,29 +34,52 @@ func Find[T DocInter](ctx context.Context, doc T, filter any, opts ...options.Li
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
 	}
+	if err := decryptDocs(ctx, ret); err != nil {
+		return nil, err
+	}
+	if err := afterFind(ctx, ret...); err != nil {
+		return nil, err
+	}
 	return ret, nil
 }
 
+// FindOne decodes the first document matching the filter into doc.
+// It returns ErrNotFound when no document matched.
+// Soft-deleted documents are excluded unless ctx is wrapped with WithDeleted.
+// Models implementing AfterFinder have AfterFind run on doc.
 func FindOne[T DocInter](ctx context.Context, doc T, filter any, opts ...options.Lister[options.FindOneOptions]) error {
-	if dataStore == nil {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
 		return ErrNotConnected
 	}
-	err := dataStore.FindOne(ctx, doc.C(), filter, opts...).Decode(&doc)
+	filter, err := tenantFilter(ctx, doc, filter)
 	if err != nil {
-		return fmt.Errorf("%w: %w", ErrReadFailed, err)
+		return err
+	}
+	filter, err = encryptFilter(ctx, doc, filter)
+	if err != nil {
+		return err
+	}
+	err = ds.FindOne(ctx, doc.C(), scopeFilter(ctx, doc, filter), opts...).Decode(&doc)
+	if err != nil {
+		return readError(err)
+	}
+	if _, err = decryptDoc(ctx, doc); err != nil {
+		return err
 	}
-	return nil
+	return afterFind(ctx, doc)
 }
 
 func FindById[T DocInter](ctx context.Context, doc T) error {
-	if dataStore == nil {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
 		return ErrNotConnected
 	}
 	return FindOne(ctx, doc, bson.M{"_id": doc.GetId()})
 }
 
 func (m *mongoStore) Find(ctx context.Context, collectionName string, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
-	collection := m.getCollection(collectionName)
+	collection := m.collection(ctx, collectionName)
 	cursor, err := collection.Find(ctx, filter, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
@@ -53,6 +88,6 @@ func (m *mongoStore) Find(ctx context.Context, collectionName string, filter any
 }
 
 func (m *mongoStore) FindOne(ctx context.Context, collectionName string, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
-	collection := m.getCollection(collectionName)
+	collection := m.collection(ctx, collectionName)
 	return collection.FindOne(ctx, filter, opts...)
 }
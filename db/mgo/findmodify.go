@@ -0,0 +1,139 @@
+package mgo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// FindOneAndUpdate atomically updates the first document matching filter and decodes it into doc.
+// doc receives the document after the update; pass
+// options.FindOneAndUpdate().SetReturnDocument(options.Before) to receive it as it was.
+// Soft-deleted documents are excluded unless ctx is wrapped with WithDeleted.
+//
+// Models embedding Timestamps get `updatedAt` refreshed, and `createdAt` set when an upsert inserts.
+func FindOneAndUpdate[T DocInter](ctx context.Context, doc T, filter any, update bson.D, opts ...options.Lister[options.FindOneAndUpdateOptions]) error {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return ErrNotConnected
+	}
+	opts = append([]options.Lister[options.FindOneAndUpdateOptions]{
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	}, opts...)
+	filter, err := tenantFilter(ctx, doc, filter)
+	if err != nil {
+		return err
+	}
+	filter, err = encryptFilter(ctx, doc, filter)
+	if err != nil {
+		return err
+	}
+	update, err = beforeUpdate(ctx, doc, update)
+	if err != nil {
+		return err
+	}
+	if err := checkTenantUpdate(ctx, doc, update); err != nil {
+		return err
+	}
+	update, err = encryptUpdate(ctx, doc, stampUpsert(doc, update, nowFunc()))
+	if err != nil {
+		return err
+	}
+	filter, audit, err := beginAudit(ctx, ds, doc, AuditUpdate, scopeFilter(ctx, doc, filter), false, mergeOptions(opts).Sort)
+	if err != nil {
+		return err
+	}
+	err = ds.FindOneAndUpdate(ctx, doc.C(), filter, update, opts...).Decode(&doc)
+	if err != nil {
+		return readError(err)
+	}
+	audit.finish(doc.GetId())
+	if _, err = decryptDoc(ctx, doc); err != nil {
+		return err
+	}
+	return afterFind(ctx, doc)
+}
+
+// FindOneAndDelete atomically deletes the first document matching filter and decodes it into doc.
+// Models embedding SoftDelete are flagged as deleted instead, like DeleteById, and doc
+// receives the flagged document.
+func FindOneAndDelete[T DocInter](ctx context.Context, doc T, filter any, opts ...options.Lister[options.FindOneAndDeleteOptions]) error {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return ErrNotConnected
+	}
+	if err := beforeDelete(ctx, doc); err != nil {
+		return err
+	}
+	filter, err := tenantFilter(ctx, doc, filter)
+	if err != nil {
+		return err
+	}
+	filter, err = encryptFilter(ctx, doc, filter)
+	if err != nil {
+		return err
+	}
+	filter, audit, err := beginAudit(ctx, ds, doc, AuditDelete, scopeFilter(ctx, doc, filter), false, mergeOptions(opts).Sort)
+	if err != nil {
+		return err
+	}
+	var result *mongo.SingleResult
+	if isSoftDeletable(doc) {
+		now := nowFunc()
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: FieldIsDeleted, Value: true},
+			{Key: FieldDeletedAt, Value: now},
+		}}}
+		result = ds.FindOneAndUpdate(ctx, doc.C(), filter, stampUpdate(doc, update, now), softDeleteOptions(opts))
+	} else {
+		result = ds.FindOneAndDelete(ctx, doc.C(), filter, opts...)
+	}
+	if err := result.Decode(&doc); err != nil {
+		return readError(err)
+	}
+	audit.finish(nil)
+	if _, err = decryptDoc(ctx, doc); err != nil {
+		return err
+	}
+	return afterFind(ctx, doc)
+}
+
+// softDeleteOptions carries the find-and-delete options over to the update that flags the document.
+func softDeleteOptions(opts []options.Lister[options.FindOneAndDeleteOptions]) *options.FindOneAndUpdateOptionsBuilder {
+	del := mergeOptions(opts)
+	upd := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if del.Sort != nil {
+		upd.SetSort(del.Sort)
+	}
+	if del.Projection != nil {
+		upd.SetProjection(del.Projection)
+	}
+	if del.Collation != nil {
+		upd.SetCollation(del.Collation)
+	}
+	if del.Hint != nil {
+		upd.SetHint(del.Hint)
+	}
+	return upd
+}
+
+func (m *mongoStore) FindOneAndUpdate(ctx context.Context, collection string, filter any, update bson.D, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult {
+	return m.collection(ctx, collection).FindOneAndUpdate(ctx, filter, update, opts...)
+}
+
+func (m *mongoStore) FindOneAndDelete(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOneAndDeleteOptions]) *mongo.SingleResult {
+	return m.collection(ctx, collection).FindOneAndDelete(ctx, filter, opts...)
+}
+
+// mergeOptions applies opts to a single options struct.
+func mergeOptions[T any](opts []options.Lister[T]) *T {
+	merged := new(T)
+	for _, o := range opts {
+		for _, set := range o.List() {
+			_ = set(merged)
+		}
+	}
+	return merged
+}
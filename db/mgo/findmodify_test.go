@@ -0,0 +1,172 @@
+package mgo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestFindOneAndUpdate(t *testing.T) {
+	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+	defer restore()
+	seedUsers(t)
+	ctx := context.Background()
+	inc := bson.D{{Key: "$inc", Value: bson.D{{Key: "age", Value: 1}}}}
+
+	t.Run("Returns the updated document", func(t *testing.T) {
+		user := &testUser{}
+		err := mgo.FindOneAndUpdate(ctx, user, bson.D{{Key: "name", Value: "Alice"}}, inc)
+		assert.NoError(t, err)
+		assert.Equal(t, 26, user.Age)
+	})
+
+	t.Run("Returns the document before the update", func(t *testing.T) {
+		user := &testUser{}
+		err := mgo.FindOneAndUpdate(ctx, user, bson.D{{Key: "name", Value: "Alice"}}, inc,
+			options.FindOneAndUpdate().SetReturnDocument(options.Before))
+		assert.NoError(t, err)
+		assert.Equal(t, 26, user.Age)
+	})
+
+	t.Run("Picks the first in sort order", func(t *testing.T) {
+		user := &testUser{}
+		err := mgo.FindOneAndUpdate(ctx, user, nil, inc,
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "age", Value: -1}}))
+		assert.NoError(t, err)
+		assert.Equal(t, "Bob", user.Name)
+	})
+
+	t.Run("No match", func(t *testing.T) {
+		err := mgo.FindOneAndUpdate(ctx, &testUser{}, bson.D{{Key: "name", Value: "Nobody"}}, inc)
+		assert.ErrorIs(t, err, mgo.ErrNotFound)
+		assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	})
+}
+
+func TestFindOneAndDelete(t *testing.T) {
+	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+	defer restore()
+	seedUsers(t)
+	ctx := context.Background()
+
+	t.Run("Hard delete", func(t *testing.T) {
+		user := &testUser{}
+		err := mgo.FindOneAndDelete(ctx, user, nil, options.FindOneAndDelete().SetSort(bson.D{{Key: "age", Value: 1}}))
+		assert.NoError(t, err)
+		assert.Equal(t, "Alice", user.Name)
+
+		remaining, err := mgo.Find(ctx, &testUser{}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Peter", "Bob"}, names(remaining))
+	})
+
+	t.Run("Soft delete", func(t *testing.T) {
+		_, err := mgo.Save(ctx, &testArticle{Title: "draft"})
+		assert.NoError(t, err)
+
+		article := &testArticle{}
+		err = mgo.FindOneAndDelete(ctx, article, bson.D{{Key: "title", Value: "draft"}})
+		assert.NoError(t, err)
+		assert.True(t, article.IsDeleted)
+
+		err = mgo.FindOne(ctx, &testArticle{}, bson.D{{Key: "title", Value: "draft"}})
+		assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+		err = mgo.FindOne(mgo.WithDeleted(ctx), &testArticle{}, bson.D{{Key: "title", Value: "draft"}})
+		assert.NoError(t, err)
+	})
+}
+
+func TestUpsert(t *testing.T) {
+	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+	defer restore()
+	ctx := context.Background()
+	filter := bson.D{{Key: "title", Value: "hello"}}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "views", Value: 1}}}}
+
+	result, err := mgo.Upsert(ctx, &testArticle{}, filter, update)
+	assert.NoError(t, err)
+	assert.NotNil(t, result.UpsertedID)
+	assert.Zero(t, result.MatchedCount)
+
+	result, err = mgo.Upsert(ctx, &testArticle{}, filter, update)
+	assert.NoError(t, err)
+	assert.Nil(t, result.UpsertedID)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+
+	article := &testArticle{}
+	assert.NoError(t, mgo.FindOne(ctx, article, filter))
+	assert.False(t, article.CreatedAt.IsZero(), "createdAt set on insert")
+	assert.True(t, article.UpdatedAt.After(article.CreatedAt) || article.UpdatedAt.Equal(article.CreatedAt))
+
+	articles, err := mgo.Find(ctx, &testArticle{}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, articles, 1)
+}
+
+func TestReplaceById(t *testing.T) {
+	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+	defer restore()
+	ctx := context.Background()
+
+	saved, err := mgo.Save(ctx, &testUser{Name: "Peter", Age: 30})
+	assert.NoError(t, err)
+
+	saved.Name, saved.Age = "Pete", 31
+	result, err := mgo.ReplaceById(ctx, saved)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+
+	found := &testUser{ID: saved.ID}
+	assert.NoError(t, mgo.FindById(ctx, found))
+	assert.Equal(t, "Pete", found.Name)
+	assert.Equal(t, 31, found.Age)
+}
+
+// validatedUser rejects an empty name.
+type validatedUser struct {
+	testUser `bson:",inline"`
+}
+
+func (u *validatedUser) Validate() error {
+	if u.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestInsertMany(t *testing.T) {
+	t.Run("Assigns ids", func(t *testing.T) {
+		mockDB := &mgo.MockDatastore{OnInsertMany: mgo.NewOnInsertManyMock()}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		users, err := mgo.InsertMany(context.Background(), []*testArticle{{Title: "a"}, {Title: "b"}})
+		assert.NoError(t, err)
+		assert.Len(t, users, 2)
+		assert.False(t, users[0].ID.IsZero())
+		assert.False(t, users[1].CreatedAt.IsZero())
+	})
+
+	t.Run("Validates every document first", func(t *testing.T) {
+		mockDB := &mgo.MockDatastore{
+			OnInsertMany: func(ctx context.Context, collection string, docs []mgo.DocInter) ([]any, error) {
+				t.Fatal("nothing must be written")
+				return nil, nil
+			},
+		}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		docs := []*validatedUser{{testUser{Name: "ok"}}, {}}
+		_, err := mgo.InsertMany(context.Background(), docs)
+		assert.ErrorIs(t, err, mgo.ErrInvalidDocument)
+		assert.Contains(t, err.Error(), "document 1")
+	})
+}
@@ -0,0 +1,115 @@
+package mgo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arwoosa/vulpes/db/mgo/types"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// earthRadiusMeters is the equatorial radius MongoDB uses to convert distances to radians.
+const earthRadiusMeters = 6378100.0
+
+// With2dsphere adds a 2dsphere index on each of the given GeoJSON fields,
+// as required by Near, FindNear and the $geoNear stage.
+func With2dsphere(fields ...string) CollectOption {
+	return func(c *collectDef) {
+		for _, field := range fields {
+			c.indexes = append(c.indexes, mongo.IndexModel{
+				Keys: bson.D{{Key: field, Value: "2dsphere"}},
+			})
+		}
+	}
+}
+
+// Near returns a filter condition matching documents whose field lies within
+// maxMeters of point, sorted nearest first. minMeters excludes closer documents;
+// zero leaves either bound unset.
+//
+//	filter := bson.D{mgo.Near("location", types.NewLocationPoint(121.56, 25.03), 1000, 0)}
+func Near(field string, point *types.Location, maxMeters, minMeters float64) bson.E {
+	near := bson.D{{Key: "$geometry", Value: point}}
+	if maxMeters > 0 {
+		near = append(near, bson.E{Key: "$maxDistance", Value: maxMeters})
+	}
+	if minMeters > 0 {
+		near = append(near, bson.E{Key: "$minDistance", Value: minMeters})
+	}
+	return bson.E{Key: field, Value: bson.D{{Key: "$near", Value: near}}}
+}
+
+// GeoWithinBox returns a filter condition matching documents whose field lies in the
+// rectangle spanned by the [longitude, latitude] corners bottomLeft and upperRight.
+func GeoWithinBox(field string, bottomLeft, upperRight []float64) bson.E {
+	return geoWithin(field, "$box", bson.A{bottomLeft, upperRight})
+}
+
+// GeoWithinPolygon returns a filter condition matching documents whose field lies entirely in polygon.
+func GeoWithinPolygon(field string, polygon *types.Polygon) bson.E {
+	return geoWithin(field, "$geometry", polygon)
+}
+
+// GeoWithinCenterSphere returns a filter condition matching documents whose field lies
+// within radiusMeters of center on the sphere. Unlike Near, results are not sorted.
+func GeoWithinCenterSphere(field string, center *types.Location, radiusMeters float64) bson.E {
+	return geoWithin(field, "$centerSphere", bson.A{center.Coordinates, radiusMeters / earthRadiusMeters})
+}
+
+func geoWithin(field, shape string, value any) bson.E {
+	return bson.E{Key: field, Value: bson.D{{Key: "$geoWithin", Value: bson.D{{Key: shape, Value: value}}}}}
+}
+
+// GeoIntersects returns a filter condition matching documents whose field intersects geometry.
+func GeoIntersects(field string, geometry types.Geometry) bson.E {
+	return bson.E{Key: field, Value: bson.D{{Key: "$geoIntersects", Value: bson.D{{Key: "$geometry", Value: geometry}}}}}
+}
+
+// FindNear returns the documents of doc's collection ordered by distance from point,
+// nearest first, using a $geoNear stage. The distance in meters is written to
+// distanceField, so a model field such as
+//
+//	Distance float64 `bson:"distance,omitempty"`
+//
+// receives it when distanceField is "distance". Soft-deleted documents are excluded unless
+// ctx is wrapped with WithDeleted; WithGeoQuery adds further conditions.
+func FindNear[T DocInter](ctx context.Context, doc T, point *types.Location, distanceField string, opts ...GeoNearOption) ([]T, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return nil, ErrNotConnected
+	}
+	if err := point.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDocument, err)
+	}
+	spec := geoNearSpec(point, distanceField, opts)
+	var query any
+	for _, e := range spec {
+		if e.Key == "query" {
+			query = e.Value
+		}
+	}
+	query, err := tenantFilter(ctx, doc, query)
+	if err != nil {
+		return nil, err
+	}
+	if scoped := scopeFilter(ctx, doc, query); scoped != nil {
+		WithGeoQuery(scoped)(&spec)
+	}
+	cursor, err := ds.PipeFind(ctx, doc.C(), NewPipeline(bson.D{{Key: "$geoNear", Value: spec}}).Build())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	var result []T
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	if err := decryptDocs(ctx, result); err != nil {
+		return nil, err
+	}
+	if err := afterFind(ctx, result...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package mgo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+	"github.com/arwoosa/vulpes/db/mgo/types"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// testPlace stores a location and receives the distance computed by $geoNear.
+type testPlace struct {
+	ID       bson.ObjectID   `bson:"_id,omitempty"`
+	Name     string          `bson:"name"`
+	Location *types.Location `bson:"location"`
+	Distance float64         `bson:"distance,omitempty"`
+}
+
+func (p *testPlace) C() string                   { return "places" }
+func (p *testPlace) Indexes() []mongo.IndexModel { return nil }
+func (p *testPlace) Validate() error             { return nil }
+func (p *testPlace) GetId() any                  { return p.ID }
+func (p *testPlace) SetId(id any)                { p.ID = id.(bson.ObjectID) }
+
+func TestGeoJSONValidation(t *testing.T) {
+	square := [][]float64{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}
+
+	_, err := types.NewPolygon(square)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"Open ring", func() error { _, err := types.NewPolygon(square[:4]); return err }()},
+		{"Short ring", func() error { _, err := types.NewPolygon([][]float64{{0, 0}, {1, 1}, {0, 0}}); return err }()},
+		{"Longitude out of range", func() error { _, err := types.NewLineString([]float64{181, 0}, []float64{0, 0}); return err }()},
+		{"Latitude out of range", func() error { _, err := types.NewMultiPoint([]float64{0, -91}); return err }()},
+		{"Single position line", func() error { _, err := types.NewLineString([]float64{0, 0}); return err }()},
+		{"Point", types.NewLocationPoint(0, 100).Validate()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, tt.err, types.ErrInvalidGeoJSON)
+		})
+	}
+}
+
+func TestGeoQueries(t *testing.T) {
+	point := types.NewLocationPoint(121.5, 25)
+
+	assert.Equal(t, bson.E{Key: "location", Value: bson.D{{Key: "$near", Value: bson.D{
+		{Key: "$geometry", Value: point},
+		{Key: "$maxDistance", Value: 1000.0},
+	}}}}, mgo.Near("location", point, 1000, 0))
+
+	within := mgo.GeoWithinCenterSphere("location", point, 6378100)
+	assert.Equal(t, bson.D{{Key: "$geoWithin", Value: bson.D{
+		{Key: "$centerSphere", Value: bson.A{[]float64{121.5, 25}, 1.0}},
+	}}}, within.Value)
+
+	box := mgo.GeoWithinBox("location", []float64{0, 0}, []float64{1, 1})
+	assert.Equal(t, bson.D{{Key: "$geoWithin", Value: bson.D{
+		{Key: "$box", Value: bson.A{[]float64{0, 0}, []float64{1, 1}}},
+	}}}, box.Value)
+
+	line, err := types.NewLineString([]float64{0, 0}, []float64{1, 1})
+	assert.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "$geoIntersects", Value: bson.D{{Key: "$geometry", Value: line}}}},
+		mgo.GeoIntersects("route", line).Value)
+
+	def := mgo.NewCollectDef("places", func() []mongo.IndexModel { return nil }, mgo.With2dsphere("location"))
+	assert.Equal(t, bson.D{{Key: "location", Value: "2dsphere"}}, def.Indexes()[0].Keys)
+}
+
+func TestFindNear(t *testing.T) {
+	point := types.NewLocationPoint(121.5, 25)
+
+	t.Run("Decodes distances", func(t *testing.T) {
+		var pipeline mongo.Pipeline
+		mockDB := &mgo.MockDatastore{
+			OnPipeFind: func(ctx context.Context, collection string, p mongo.Pipeline) (*mongo.Cursor, error) {
+				assert.Equal(t, "places", collection)
+				pipeline = p
+				return mgo.NewOnPipeFindMock(
+					bson.M{"name": "Cafe", "distance": 12.5},
+					bson.M{"name": "Park", "distance": 80.0},
+				)(ctx, collection, p)
+			},
+		}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		places, err := mgo.FindNear(context.Background(), &testPlace{}, point, "distance", mgo.WithGeoMaxDistance(100))
+		assert.NoError(t, err)
+		assert.Len(t, places, 2)
+		assert.Equal(t, 12.5, places[0].Distance)
+		assert.Equal(t, bson.D{
+			{Key: "near", Value: point},
+			{Key: "distanceField", Value: "distance"},
+			{Key: "spherical", Value: true},
+			{Key: "maxDistance", Value: 100.0},
+		}, pipeline[0][0].Value)
+	})
+
+	t.Run("Excludes soft-deleted documents", func(t *testing.T) {
+		var spec bson.D
+		mockDB := &mgo.MockDatastore{
+			OnPipeFind: func(ctx context.Context, collection string, p mongo.Pipeline) (*mongo.Cursor, error) {
+				spec = p[0][0].Value.(bson.D)
+				return mgo.NewOnPipeFindMock()(ctx, collection, p)
+			},
+		}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		_, err := mgo.FindNear(context.Background(), &testArticle{}, point, "distance",
+			mgo.WithGeoQuery(bson.D{{Key: "title", Value: "news"}}))
+		assert.NoError(t, err)
+		assert.Equal(t, bson.E{Key: "query", Value: bson.D{
+			{Key: "title", Value: "news"},
+			{Key: mgo.FieldIsDeleted, Value: bson.D{{Key: "$ne", Value: true}}},
+		}}, spec[3])
+	})
+
+	t.Run("Invalid point", func(t *testing.T) {
+		restore := mgo.SetDatastore(&mgo.MockDatastore{})
+		defer restore()
+
+		_, err := mgo.FindNear(context.Background(), &testPlace{}, types.NewLocationPoint(200, 0), "distance")
+		assert.ErrorIs(t, err, mgo.ErrInvalidDocument)
+	})
+}
@@ -0,0 +1,260 @@
+package mgo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// DefaultBucket is the GridFS bucket used when an empty bucket name is given.
+const DefaultBucket = "fs"
+
+// File describes a file stored in a GridFS bucket.
+type File struct {
+	ID         any       `bson:"_id"`
+	Name       string    `bson:"filename"`
+	Length     int64     `bson:"length"`
+	ChunkSize  int32     `bson:"chunkSize"`
+	UploadDate time.Time `bson:"uploadDate"`
+	// Metadata holds the metadata given to Upload; decode it with bson.Unmarshal.
+	Metadata bson.Raw `bson:"metadata,omitempty"`
+}
+
+// FileReader streams the content of a stored file.
+type FileReader interface {
+	io.ReadCloser
+	// File describes the file being read.
+	File() *File
+	// Skip advances the stream by up to n bytes without returning them.
+	Skip(n int64) (int64, error)
+}
+
+// DownloadOption configures OpenDownloadStream.
+type DownloadOption func(*downloadRange)
+
+type downloadRange struct {
+	offset, length int64
+}
+
+// WithRange reads length bytes starting at offset, e.g. to serve HTTP range requests.
+// A length of 0 reads to the end of the file.
+func WithRange(offset, length int64) DownloadOption {
+	return func(r *downloadRange) {
+		r.offset = offset
+		r.length = length
+	}
+}
+
+// Upload streams source into the GridFS bucket as a file called name and returns its _id.
+// metadata, if not nil, is stored with the file and can be queried with ListFiles.
+// An empty bucket name means DefaultBucket.
+func Upload(ctx context.Context, bucket, name string, source io.Reader, metadata any) (bson.ObjectID, error) {
+	if dataStore == nil {
+		return bson.ObjectID{}, ErrNotConnected
+	}
+	id, err := dataStore.UploadFile(ctx, bucketName(bucket), name, source, metadata)
+	if err != nil {
+		return bson.ObjectID{}, fmt.Errorf("%w: %w", ErrWriteFailed, err)
+	}
+	return id, nil
+}
+
+// Download writes the content of the file with the given _id to w and returns the number
+// of bytes written. It returns ErrNotFound when the bucket has no such file.
+func Download(ctx context.Context, bucket string, fileID any, w io.Writer) (int64, error) {
+	r, err := OpenDownloadStream(ctx, bucket, fileID)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return n, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return n, nil
+}
+
+// OpenDownloadStream opens the file with the given _id for reading. The caller must close
+// the returned reader. With WithRange only part of the file is read; File still
+// describes the whole file. It returns ErrNotFound when the bucket has no such file.
+func OpenDownloadStream(ctx context.Context, bucket string, fileID any, opts ...DownloadOption) (FileReader, error) {
+	if dataStore == nil {
+		return nil, ErrNotConnected
+	}
+	var rng downloadRange
+	for _, opt := range opts {
+		opt(&rng)
+	}
+	if rng.offset < 0 || rng.length < 0 {
+		return nil, fmt.Errorf("%w: invalid range %d+%d", ErrInvalidDocument, rng.offset, rng.length)
+	}
+	r, err := dataStore.OpenDownloadStream(ctx, bucketName(bucket), fileID)
+	if err != nil {
+		return nil, fileError(err)
+	}
+	if rng.offset > 0 {
+		if _, err := r.Skip(rng.offset); err != nil {
+			r.Close()
+			return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+		}
+	}
+	if rng.length > 0 {
+		return &rangeReader{FileReader: r, remaining: &io.LimitedReader{R: r, N: rng.length}}, nil
+	}
+	return r, nil
+}
+
+// DeleteFile removes the file with the given _id and its content from the bucket.
+// It returns ErrNotFound when the bucket has no such file.
+func DeleteFile(ctx context.Context, bucket string, fileID any) error {
+	if dataStore == nil {
+		return ErrNotConnected
+	}
+	if err := dataStore.DeleteFile(ctx, bucketName(bucket), fileID); err != nil {
+		return fileError(err)
+	}
+	return nil
+}
+
+// ListFiles returns the files of the bucket matching filter, which applies to the
+// stored File fields; conditions on metadata use the "metadata." prefix:
+//
+//	files, err := mgo.ListFiles(ctx, "uploads", bson.D{{Key: "metadata.owner", Value: userID}})
+//
+// A nil filter lists all files.
+func ListFiles(ctx context.Context, bucket string, filter any) ([]*File, error) {
+	if dataStore == nil {
+		return nil, ErrNotConnected
+	}
+	if filter == nil {
+		filter = bson.D{}
+	}
+	files, err := dataStore.FindFiles(ctx, bucketName(bucket), filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return files, nil
+}
+
+func bucketName(bucket string) string {
+	if bucket == "" {
+		return DefaultBucket
+	}
+	return bucket
+}
+
+// fileError classifies an error of a single-file operation like readError.
+func fileError(err error) error {
+	if errors.Is(err, mongo.ErrFileNotFound) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return fmt.Errorf("%w: %w", ErrReadFailed, err)
+}
+
+// rangeReader limits a FileReader to a range of its file.
+type rangeReader struct {
+	FileReader
+	remaining *io.LimitedReader
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	return r.remaining.Read(p)
+}
+
+func (r *rangeReader) Skip(n int64) (int64, error) {
+	skipped, err := r.FileReader.Skip(min(n, r.remaining.N))
+	r.remaining.N -= skipped
+	return skipped, err
+}
+
+func (m *mongoStore) bucket(ctx context.Context, name string) *mongo.GridFSBucket {
+	opts := options.GridFSBucket().SetName(name)
+	if o, ok := ctx.Value(callOptionsKey{}).(callOptions); ok {
+		if o.readPref != nil {
+			opts.SetReadPreference(o.readPref)
+		}
+		if o.readConcern != nil {
+			opts.SetReadConcern(o.readConcern)
+		}
+		if o.writeConcern != nil {
+			opts.SetWriteConcern(o.writeConcern)
+		}
+	}
+	return m.db.GridFSBucket(opts)
+}
+
+func (m *mongoStore) UploadFile(ctx context.Context, bucket, name string, source io.Reader, metadata any) (bson.ObjectID, error) {
+	opts := options.GridFSUpload()
+	if metadata != nil {
+		opts.SetMetadata(metadata)
+	}
+	return m.bucket(ctx, bucket).UploadFromStream(ctx, name, source, opts)
+}
+
+func (m *mongoStore) OpenDownloadStream(ctx context.Context, bucket string, fileID any) (FileReader, error) {
+	stream, err := m.bucket(ctx, bucket).OpenDownloadStream(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	return &gridFSReader{GridFSDownloadStream: stream}, nil
+}
+
+func (m *mongoStore) DeleteFile(ctx context.Context, bucket string, fileID any) error {
+	return m.bucket(ctx, bucket).Delete(ctx, fileID)
+}
+
+func (m *mongoStore) FindFiles(ctx context.Context, bucket string, filter any) ([]*File, error) {
+	cursor, err := m.bucket(ctx, bucket).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var files []*File
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// gridFSReader adapts the driver's download stream to FileReader.
+type gridFSReader struct {
+	*mongo.GridFSDownloadStream
+}
+
+func (r *gridFSReader) File() *File {
+	f := r.GetFile()
+	return &File{
+		ID:         f.ID,
+		Name:       f.Name,
+		Length:     f.Length,
+		ChunkSize:  f.ChunkSize,
+		UploadDate: f.UploadDate,
+		Metadata:   f.Metadata,
+	}
+}
+
+// bytesFileReader serves a file held in memory.
+type bytesFileReader struct {
+	*bytes.Reader
+	file *File
+}
+
+func newBytesFileReader(file *File, content []byte) *bytesFileReader {
+	return &bytesFileReader{Reader: bytes.NewReader(content), file: file}
+}
+
+func (r *bytesFileReader) File() *File { return r.file }
+
+func (r *bytesFileReader) Close() error { return nil }
+
+func (r *bytesFileReader) Skip(n int64) (int64, error) {
+	n = min(max(n, 0), int64(r.Len()))
+	_, err := r.Seek(n, io.SeekCurrent)
+	return n, err
+}
@@ -0,0 +1,58 @@
+package mgo_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestGridFS(t *testing.T) {
+	defer mgo.SetDatastore(mgo.NewMemoryDatastore())()
+	ctx := context.Background()
+
+	id, err := mgo.Upload(ctx, "avatars", "ann.png", strings.NewReader("0123456789"), bson.M{"owner": "ann"})
+	assert.NoError(t, err)
+	_, err = mgo.Upload(ctx, "avatars", "bob.png", strings.NewReader("bob"), bson.M{"owner": "bob"})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	n, err := mgo.Download(ctx, "avatars", id, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), n)
+	assert.Equal(t, "0123456789", buf.String())
+
+	t.Run("Range", func(t *testing.T) {
+		r, err := mgo.OpenDownloadStream(ctx, "avatars", id, mgo.WithRange(3, 4))
+		assert.NoError(t, err)
+		defer r.Close()
+		content, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "3456", string(content))
+		assert.Equal(t, "ann.png", r.File().Name)
+		assert.Equal(t, int64(10), r.File().Length, "File describes the whole file")
+	})
+
+	t.Run("List by metadata", func(t *testing.T) {
+		files, err := mgo.ListFiles(ctx, "avatars", bson.D{{Key: "metadata.owner", Value: "ann"}})
+		assert.NoError(t, err)
+		if assert.Len(t, files, 1) {
+			assert.Equal(t, id, files[0].ID)
+			assert.Equal(t, "ann", files[0].Metadata.Lookup("owner").StringValue())
+		}
+		files, err = mgo.ListFiles(ctx, "", nil)
+		assert.NoError(t, err)
+		assert.Empty(t, files, "buckets are separate")
+	})
+
+	assert.NoError(t, mgo.DeleteFile(ctx, "avatars", id))
+	assert.ErrorIs(t, mgo.DeleteFile(ctx, "avatars", id), mgo.ErrNotFound)
+	_, err = mgo.Download(ctx, "avatars", id, io.Discard)
+	assert.ErrorIs(t, err, mgo.ErrNotFound)
+}
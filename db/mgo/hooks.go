@@ -0,0 +1,93 @@
+package mgo
+
+import (
+	"context"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// BeforeInserter is implemented by models that prepare themselves before being inserted,
+// e.g. to generate a slug. It runs on plaintext fields, before timestamps, validation and
+// encryption, for Save, InsertMany and the InsertOne operations of a bulk write.
+// An error aborts the insert.
+type BeforeInserter interface {
+	BeforeInsert(ctx context.Context) error
+}
+
+// AfterInserter is implemented by models reacting to their own insert, e.g. to
+// denormalize themselves into other collections. The document carries its new _id.
+// An error is returned to the caller, but the document stays inserted.
+type AfterInserter interface {
+	AfterInsert(ctx context.Context) error
+}
+
+// BeforeUpdater is implemented by models that inspect or extend updates applied to them.
+// It returns the update to apply, usually update itself with further fields in its $set
+// stage. It runs for UpdateById, UpdateOne, UpdateMany, Upsert, FindOneAndUpdate and
+// the update operations of a bulk write bound to the model with WithModel.
+// An error aborts the update.
+type BeforeUpdater interface {
+	BeforeUpdate(ctx context.Context, update bson.D) (bson.D, error)
+}
+
+// AfterFinder is implemented by models completing themselves once loaded, e.g. to fill
+// derived fields. It runs on every document returned by Find, FindOne, FindById,
+// FindOneAndUpdate, FindOneAndDelete and FindNear, after decryption.
+// An error fails the read.
+type AfterFinder interface {
+	AfterFind(ctx context.Context) error
+}
+
+// BeforeDeleter is implemented by models guarding their deletion. It runs for DeleteById,
+// HardDelete, DeleteOne, DeleteMany, FindOneAndDelete and the delete operations of a bulk
+// write bound to the model with WithModel. An error aborts the delete.
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+// isNilDoc reports whether doc is nil or a nil pointer, on which no hook can run.
+func isNilDoc(doc any) bool {
+	v := reflect.ValueOf(doc)
+	return !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil())
+}
+
+func beforeInsert(ctx context.Context, doc any) error {
+	if h, ok := doc.(BeforeInserter); ok && !isNilDoc(doc) {
+		return h.BeforeInsert(ctx)
+	}
+	return nil
+}
+
+func afterInsert(ctx context.Context, doc any) error {
+	if h, ok := doc.(AfterInserter); ok && !isNilDoc(doc) {
+		return h.AfterInsert(ctx)
+	}
+	return nil
+}
+
+func beforeUpdate(ctx context.Context, doc any, update bson.D) (bson.D, error) {
+	if h, ok := doc.(BeforeUpdater); ok && !isNilDoc(doc) {
+		return h.BeforeUpdate(ctx, update)
+	}
+	return update, nil
+}
+
+func beforeDelete(ctx context.Context, doc any) error {
+	if h, ok := doc.(BeforeDeleter); ok && !isNilDoc(doc) {
+		return h.BeforeDelete(ctx)
+	}
+	return nil
+}
+
+// afterFind runs AfterFind on every loaded document.
+func afterFind[T any](ctx context.Context, docs ...T) error {
+	for _, doc := range docs {
+		if h, ok := any(doc).(AfterFinder); ok && !isNilDoc(doc) {
+			if err := h.AfterFind(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
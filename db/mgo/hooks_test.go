@@ -0,0 +1,142 @@
+package mgo_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var errPostLocked = errors.New("post is locked")
+
+// testPost keeps its slug in sync with its title through lifecycle hooks.
+type testPost struct {
+	ID     bson.ObjectID `bson:"_id,omitempty"`
+	Title  string        `bson:"title"`
+	Slug   string        `bson:"slug"`
+	Locked bool          `bson:"locked"`
+	// URL is derived once loaded, inserted is set once written.
+	URL      string `bson:"-"`
+	inserted bool
+}
+
+func (p *testPost) C() string                   { return "posts" }
+func (p *testPost) Indexes() []mongo.IndexModel { return nil }
+func (p *testPost) Validate() error {
+	if p.Slug == "" {
+		return errors.New("slug is required")
+	}
+	return nil
+}
+func (p *testPost) GetId() any   { return p.ID }
+func (p *testPost) SetId(id any) { p.ID = id.(bson.ObjectID) }
+
+func slugify(title string) string {
+	return strings.ToLower(strings.ReplaceAll(title, " ", "-"))
+}
+
+func (p *testPost) BeforeInsert(ctx context.Context) error {
+	p.Slug = slugify(p.Title)
+	return nil
+}
+
+func (p *testPost) AfterInsert(ctx context.Context) error {
+	p.inserted = true
+	return nil
+}
+
+func (p *testPost) BeforeUpdate(ctx context.Context, update bson.D) (bson.D, error) {
+	for i, stage := range update {
+		if stage.Key != "$set" {
+			continue
+		}
+		set := stage.Value.(bson.D)
+		for _, e := range set {
+			if e.Key == "title" {
+				update[i].Value = append(set, bson.E{Key: "slug", Value: slugify(e.Value.(string))})
+			}
+		}
+	}
+	return update, nil
+}
+
+func (p *testPost) AfterFind(ctx context.Context) error {
+	p.URL = "/posts/" + p.Slug
+	return nil
+}
+
+func (p *testPost) BeforeDelete(ctx context.Context) error {
+	if p.Locked {
+		return errPostLocked
+	}
+	return nil
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	store := mgo.NewMemoryDatastore()
+	defer mgo.SetDatastore(store)()
+	ctx := context.Background()
+
+	post, err := mgo.Save(ctx, &testPost{Title: "Hello World"})
+	assert.NoError(t, err, "BeforeInsert runs before validation")
+	assert.Equal(t, "hello-world", post.Slug)
+	assert.True(t, post.inserted)
+
+	t.Run("After find", func(t *testing.T) {
+		found := &testPost{ID: post.ID}
+		assert.NoError(t, mgo.FindById(ctx, found))
+		assert.Equal(t, "/posts/hello-world", found.URL)
+
+		all, err := mgo.Find(ctx, &testPost{}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "/posts/hello-world", all[0].URL)
+	})
+
+	t.Run("Before update", func(t *testing.T) {
+		_, err := mgo.UpdateById(ctx, post, bson.D{{Key: "$set", Value: bson.D{{Key: "title", Value: "Goodbye World"}}}})
+		assert.NoError(t, err)
+		found := &testPost{ID: post.ID}
+		assert.NoError(t, mgo.FindById(ctx, found))
+		assert.Equal(t, "goodbye-world", found.Slug)
+	})
+
+	t.Run("Before delete", func(t *testing.T) {
+		_, err := mgo.DeleteById(ctx, &testPost{ID: post.ID, Locked: true})
+		assert.ErrorIs(t, err, errPostLocked)
+		assert.NoError(t, mgo.FindById(ctx, &testPost{ID: post.ID}))
+
+		_, err = mgo.DeleteById(ctx, &testPost{ID: post.ID})
+		assert.NoError(t, err)
+	})
+}
+
+func TestBulkLifecycleHooks(t *testing.T) {
+	store := mgo.NewMemoryDatastore()
+	defer mgo.SetDatastore(store)()
+	ctx := context.Background()
+
+	first := &testPost{ID: bson.NewObjectID(), Title: "First Post"}
+	bulk, err := mgo.NewBulkOperation("posts", mgo.WithModel(&testPost{}))
+	assert.NoError(t, err)
+	_, err = bulk.InsertOne(first).
+		InsertOne(&testPost{ID: bson.NewObjectID(), Title: "Second Post"}).
+		UpdateById(first.ID, bson.M{"$set": bson.D{{Key: "title", Value: "Latest Post"}}}).
+		Execute(ctx)
+	assert.NoError(t, err)
+	assert.True(t, first.inserted)
+
+	found := &testPost{ID: first.ID}
+	assert.NoError(t, mgo.FindById(ctx, found))
+	assert.Equal(t, "latest-post", found.Slug)
+
+	bulk, err = mgo.NewBulkOperation("posts", mgo.WithModel(&testPost{Locked: true}))
+	assert.NoError(t, err)
+	_, err = bulk.DeleteById(first.ID).Execute(ctx)
+	assert.ErrorIs(t, err, errPostLocked)
+}
@@ -6,8 +6,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
+	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 // Index defines the interface for a collection's schema, including its name and index specifications.
@@ -19,6 +22,50 @@ type Index interface {
 	Indexes() []mongo.IndexModel
 }
 
+// CollectionSpecifier is an optional interface for Index definitions that also
+// declare collection-level options. SyncIndexes reconciles these options in reconcile mode.
+type CollectionSpecifier interface {
+	CollectionOptions() *CollectionOptions
+}
+
+// CollectionOptions declares collection-level settings managed by SyncIndexes.
+type CollectionOptions struct {
+	// Validator is a query document, such as a $jsonSchema, enforced by MongoDB on writes.
+	Validator any
+	// ValidationLevel is "off", "strict" or "moderate"; empty keeps the server default.
+	ValidationLevel string
+	// ValidationAction is "error" or "warn"; empty keeps the server default.
+	ValidationAction string
+	// Capped makes the collection a capped collection of SizeInBytes,
+	// optionally limited to MaxDocuments.
+	Capped       bool
+	SizeInBytes  int64
+	MaxDocuments int64
+	// TimeSeries makes the collection a time-series collection. It can only be set when
+	// the collection is created.
+	TimeSeries *TimeSeriesOptions
+	// Clustered stores the documents ordered by _id instead of in a separate index. It can
+	// only be set when the collection is created.
+	Clustered bool
+	// ExpireAfter removes documents of a time-series collection once their time field,
+	// or of a clustered collection once their _id, is older; zero keeps them.
+	ExpireAfter time.Duration
+	// Collation is the default collation of the collection's queries and indexes. It can
+	// only be set when the collection is created.
+	Collation *options.Collation
+}
+
+// TimeSeriesOptions describes the layout of a time-series collection.
+type TimeSeriesOptions struct {
+	// TimeField is the field holding the date of each measurement.
+	TimeField string
+	// MetaField is the optional field identifying the source of a series, e.g. a device.
+	MetaField string
+	// Granularity is "seconds", "minutes" or "hours", matching the interval between
+	// measurements of a series; empty keeps the server default.
+	Granularity string
+}
+
 // indexes holds all registered Index definitions for the application.
 var indexes = []Index{}
 
@@ -27,6 +74,95 @@ var indexes = []Index{}
 type collectDef struct {
 	collectionName string
 	indexes        []mongo.IndexModel
+	options        *CollectionOptions
+}
+
+// CollectOption configures a collection definition created by NewCollectDef.
+type CollectOption func(*collectDef)
+
+// WithValidator sets a validator document, e.g. bson.M{"$jsonSchema": ...}, for the collection.
+func WithValidator(validator any) CollectOption {
+	return func(c *collectDef) {
+		c.collectionOptions().Validator = validator
+	}
+}
+
+// WithValidation sets the validationLevel ("off", "strict", "moderate")
+// and validationAction ("error", "warn") used together with the validator.
+func WithValidation(level, action string) CollectOption {
+	return func(c *collectDef) {
+		c.collectionOptions().ValidationLevel = level
+		c.collectionOptions().ValidationAction = action
+	}
+}
+
+// WithCapped makes the collection capped at sizeInBytes, and at maxDocuments if greater than zero.
+func WithCapped(sizeInBytes, maxDocuments int64) CollectOption {
+	return func(c *collectDef) {
+		opts := c.collectionOptions()
+		opts.Capped = true
+		opts.SizeInBytes = sizeInBytes
+		opts.MaxDocuments = maxDocuments
+	}
+}
+
+// WithTTL adds a TTL index expiring documents ttl after the date stored in field.
+func WithTTL(field string, ttl time.Duration) CollectOption {
+	return func(c *collectDef) {
+		c.indexes = append(c.indexes, mongo.IndexModel{
+			Keys:    bson.D{{Key: field, Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(ttl / time.Second)),
+		})
+	}
+}
+
+// WithTimeSeries makes the collection a time-series collection storing measurements dated
+// by timeField, grouped by the optional metaField at the given granularity ("seconds",
+// "minutes" or "hours"; empty keeps the server default).
+func WithTimeSeries(timeField, metaField, granularity string) CollectOption {
+	return func(c *collectDef) {
+		c.collectionOptions().TimeSeries = &TimeSeriesOptions{
+			TimeField:   timeField,
+			MetaField:   metaField,
+			Granularity: granularity,
+		}
+	}
+}
+
+// WithClustered makes the collection a clustered collection ordered by _id.
+func WithClustered() CollectOption {
+	return func(c *collectDef) {
+		c.collectionOptions().Clustered = true
+	}
+}
+
+// WithExpireAfter removes documents of a time-series or clustered collection ttl after
+// their time field or _id. Use WithTTL for other collections.
+func WithExpireAfter(ttl time.Duration) CollectOption {
+	return func(c *collectDef) {
+		c.collectionOptions().ExpireAfter = ttl
+	}
+}
+
+// WithCollation sets the default collation of the collection, e.g.
+// &options.Collation{Locale: "en", Strength: 2} for case-insensitive matching.
+func WithCollation(collation *options.Collation) CollectOption {
+	return func(c *collectDef) {
+		c.collectionOptions().Collation = collation
+	}
+}
+
+// collectionOptions returns the collection options, allocating them on first use.
+func (c *collectDef) collectionOptions() *CollectionOptions {
+	if c.options == nil {
+		c.options = &CollectionOptions{}
+	}
+	return c.options
+}
+
+// CollectionOptions returns the declared collection options, or nil if there are none.
+func (c *collectDef) CollectionOptions() *CollectionOptions {
+	return c.options
 }
 
 // C returns the collection name.
@@ -41,11 +177,16 @@ func (c *collectDef) Indexes() []mongo.IndexModel {
 
 // NewCollectDef creates a new collection definition that satisfies the Index interface.
 // This is a helper function to simplify the creation of index definitions.
-func NewCollectDef(name string, f func() []mongo.IndexModel) Index {
-	return &collectDef{
+// Optional CollectOption values declare collection-level settings such as validators.
+func NewCollectDef(name string, f func() []mongo.IndexModel, opts ...CollectOption) Index {
+	c := &collectDef{
 		collectionName: name,
 		indexes:        f(),
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // RegisterIndex adds a new Index definition to the global registry.
@@ -54,28 +195,65 @@ func RegisterIndex(index Index) {
 	indexes = append(indexes, index)
 }
 
+// registeredModel returns the model registered with RegisterIndex for the collection,
+// or nil when there is none.
+func registeredModel(collection string) DocInter {
+	for _, index := range indexes {
+		if doc, ok := index.(DocInter); ok && index.C() == collection {
+			return doc
+		}
+	}
+	return nil
+}
+
 // SyncIndexes ensures that all registered indexes are present in the database.
 // It iterates through all registered models and applies their index definitions.
 // The underlying MongoDB driver's CreateMany command is idempotent: it will only
 // create indexes that do not already exist and will not change existing ones.
 // This is a safe and effective way to keep code-defined schemas and the database in sync.
-func SyncIndexes(ctx context.Context) error {
+// Missing collections with declared CollectionOptions, such as time-series or capped
+// collections, are created with them first.
+//
+// With WithReconcile or WithDryRun, SyncIndexes instead diffs the database against
+// the definitions and creates, drops or rebuilds indexes and collection options to match,
+// see PlanSync. Indexes bound to a named datastore with DatastoreBinder are synced there.
+// Models implementing TenantDatabase are synced in the database of the tenant of ctx, so
+// call it once per tenant with WithTenant when a tenant is provisioned.
+func SyncIndexes(ctx context.Context, opts ...SyncOption) error {
 	if dataStore == nil {
 		return ErrNotConnected
 	}
+	cfg := newSyncConfig(opts)
+	if cfg.reconcile {
+		return reconcile(ctx, cfg)
+	}
 
 	// Iterate over all programmatically registered index definitions.
 	for _, index := range indexes {
+		// Create the collection with its declared options, which indexes would otherwise
+		// create implicitly without them, and apply the validator.
+		if err := syncCollection(ctx, index); err != nil {
+			return err
+		}
+
 		// Skip if there are no indexes to create for this model.
 		if len(index.Indexes()) == 0 {
 			continue
 		}
 
 		// Get the index view for the collection.
-		indexView := dataStore.getCollection(index.C()).Indexes()
+		ds := storeIn(ctx, index)
+		if ds == nil {
+			return fmt.Errorf("collection '%s': %w", index.C(), ErrNotConnected)
+		}
+		coll, err := ds.getCollection(index.C())
+		if err != nil {
+			return fmt.Errorf("failed to create indexes for collection '%s': %w", index.C(), errors.Join(ErrCreateIndexFailed, err))
+		}
+		indexView := coll.Indexes()
 
 		// Create the defined indexes. This command is idempotent.
-		_, err := indexView.CreateMany(ctx, index.Indexes())
+		_, err = indexView.CreateMany(ctx, index.Indexes())
 		if err != nil {
 			// Wrap the error for better context.
 			return fmt.Errorf("failed to create indexes for collection '%s': %w", index.C(), errors.Join(ErrCreateIndexFailed, err))
@@ -84,3 +262,45 @@ func SyncIndexes(ctx context.Context) error {
 
 	return nil
 }
+
+// syncCollection applies the declared collection options in the default (non-reconcile)
+// sync mode: the collection is created with them when missing, otherwise only the
+// validator is updated with collMod.
+func syncCollection(ctx context.Context, index Index) error {
+	cs, ok := index.(CollectionSpecifier)
+	if !ok || cs.CollectionOptions() == nil {
+		return nil
+	}
+	opts := cs.CollectionOptions()
+	ds := storeIn(ctx, index)
+	if ds == nil {
+		return fmt.Errorf("collection '%s': %w", index.C(), ErrNotConnected)
+	}
+	coll, err := ds.getCollection(index.C())
+	if err != nil {
+		return fmt.Errorf("failed to sync collection '%s': %w", index.C(), errors.Join(ErrCreateIndexFailed, err))
+	}
+	db := coll.Database()
+	_, exists, err := collectionInfo(ctx, db, index.C())
+	if err != nil {
+		return err
+	}
+	switch {
+	case !exists:
+		if err := db.CreateCollection(ctx, index.C(), createCollectionOptions(opts)); err != nil {
+			return fmt.Errorf("failed to create collection '%s': %w", index.C(), errors.Join(ErrCreateIndexFailed, err))
+		}
+	case opts.Validator != nil:
+		cmd := bson.D{{Key: "collMod", Value: index.C()}, {Key: "validator", Value: opts.Validator}}
+		if opts.ValidationLevel != "" {
+			cmd = append(cmd, bson.E{Key: "validationLevel", Value: opts.ValidationLevel})
+		}
+		if opts.ValidationAction != "" {
+			cmd = append(cmd, bson.E{Key: "validationAction", Value: opts.ValidationAction})
+		}
+		if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+			return fmt.Errorf("failed to apply validator for collection '%s': %w", index.C(), errors.Join(ErrCreateIndexFailed, err))
+		}
+	}
+	return nil
+}
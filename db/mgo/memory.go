@@ -0,0 +1,1646 @@
+package mgo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// errUnsupported is wrapped by errors for queries the in-memory datastore cannot evaluate.
+var errUnsupported = errors.New("not supported by the memory datastore")
+
+// memoryStore is a Datastore that keeps documents in memory, one slice of bson.D per collection.
+// Stored documents are never modified in place: updates replace them with a changed copy.
+type memoryStore struct {
+	mu          sync.Mutex
+	collections map[string][]bson.D
+	// databases holds the stores returned by database.
+	databases map[string]*memoryStore
+}
+
+// NewMemoryDatastore returns a Datastore that stores documents in memory and evaluates
+// queries itself, so unit tests can check query correctness without a server:
+//
+//	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+//	defer restore()
+//
+// Supported are the query operators $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists,
+// $regex, $size, $not, $and, $or and $nor on dotted paths; the update operators $set,
+// $setOnInsert, $unset, $inc and $push, including upserts; sort, skip, limit and top-level
+// projections; and the pipeline stages $match, $sort, $skip, $limit, $project, $count,
+// $unwind and $facet.
+// Unique indexes of the registered Index definitions are enforced.
+// GridFS files are kept whole in the "<bucket>.files" collection, with no chunks.
+//
+// Transactions roll back on error but are not isolated from concurrent callers.
+// Change streams and features that need the driver's collection, such as SyncIndexes
+// and Migrate, are not available.
+func NewMemoryDatastore() Datastore {
+	return &memoryStore{collections: map[string][]bson.D{}}
+}
+
+func (s *memoryStore) Save(ctx context.Context, doc DocInter) (DocInter, error) {
+	if err := checkNilDoc(doc); err != nil {
+		return nil, err
+	}
+	id, err := s.insert(doc.C(), doc)
+	if err != nil {
+		return doc, fmt.Errorf("%w: %w", ErrWriteFailed, err)
+	}
+	doc.SetId(id)
+	return doc, nil
+}
+
+func (s *memoryStore) Find(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
+	fo := &options.FindOptions{}
+	for _, o := range opts {
+		for _, set := range o.List() {
+			if err := set(fo); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+			}
+		}
+	}
+	var skip, limit int64
+	if fo.Skip != nil {
+		skip = *fo.Skip
+	}
+	if fo.Limit != nil {
+		limit = max(*fo.Limit, -*fo.Limit)
+	}
+	docs, err := s.query(collection, filter, fo.Sort, skip, limit, fo.Projection)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return mongo.NewCursorFromDocuments(toAny(docs), nil, nil)
+}
+
+func (s *memoryStore) FindOne(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
+	fo := &options.FindOneOptions{}
+	for _, o := range opts {
+		for _, set := range o.List() {
+			if err := set(fo); err != nil {
+				return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+			}
+		}
+	}
+	var skip int64
+	if fo.Skip != nil {
+		skip = *fo.Skip
+	}
+	docs, err := s.query(collection, filter, fo.Sort, skip, 1, fo.Projection)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	if len(docs) == 0 {
+		return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+	}
+	return mongo.NewSingleResultFromDocument(docs[0], nil, nil)
+}
+
+func (s *memoryStore) CountDocuments(ctx context.Context, collection string, filter any, opts ...options.Lister[options.CountOptions]) (int64, error) {
+	co := &options.CountOptions{}
+	for _, o := range opts {
+		for _, set := range o.List() {
+			if err := set(co); err != nil {
+				return 0, fmt.Errorf("%w: %w", ErrReadFailed, err)
+			}
+		}
+	}
+	var skip, limit int64
+	if co.Skip != nil {
+		skip = *co.Skip
+	}
+	if co.Limit != nil {
+		limit = *co.Limit
+	}
+	docs, err := s.query(collection, filter, nil, skip, limit, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return int64(len(docs)), nil
+}
+
+// EstimatedDocumentCount returns the number of documents in collection.
+func (s *memoryStore) EstimatedDocumentCount(ctx context.Context, collection string, opts ...options.Lister[options.EstimatedDocumentCountOptions]) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.collections[collection])), nil
+}
+
+// Distinct collects the values of field in the documents matching filter. Like the
+// server, array values contribute their elements.
+func (s *memoryStore) Distinct(ctx context.Context, collection string, field string, filter any, opts ...options.Lister[options.DistinctOptions]) (bson.RawArray, error) {
+	docs, err := s.query(collection, filter, nil, 0, 0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	var values []any
+	add := func(v any) {
+		for _, seen := range values {
+			if c, ok := compareValues(seen, v); (ok && c == 0) || (!ok && reflect.DeepEqual(seen, v)) {
+				return
+			}
+		}
+		values = append(values, v)
+	}
+	for _, d := range docs {
+		for _, v := range lookupPath(d, field) {
+			if items, ok := v.(bson.A); ok {
+				for _, item := range items {
+					add(item)
+				}
+				continue
+			}
+			add(v)
+		}
+	}
+	raw, err := rawArray(values)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return raw, nil
+}
+
+func (s *memoryStore) UpdateOne(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error) {
+	res, err := s.modify(collection, filter, update, nil, false, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWriteFailed, err)
+	}
+	return res.writeResult(), nil
+}
+
+func (s *memoryStore) UpdateMany(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error) {
+	res, err := s.modify(collection, filter, update, nil, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWriteFailed, err)
+	}
+	return res.writeResult(), nil
+}
+
+func (s *memoryStore) DeleteOne(ctx context.Context, collection string, filter bson.D) (*WriteResult, error) {
+	deleted, err := s.delete(collection, filter, nil, false)
+	if err != nil {
+		return nil, errors.Join(ErrWriteFailed, err)
+	}
+	return &WriteResult{DeletedCount: int64(len(deleted))}, nil
+}
+
+func (s *memoryStore) DeleteMany(ctx context.Context, collection string, filter bson.D) (*WriteResult, error) {
+	deleted, err := s.delete(collection, filter, nil, true)
+	if err != nil {
+		return nil, errors.Join(ErrWriteFailed, err)
+	}
+	return &WriteResult{DeletedCount: int64(len(deleted))}, nil
+}
+
+func (s *memoryStore) InsertMany(ctx context.Context, collection string, docs []DocInter) ([]any, error) {
+	for i, doc := range docs {
+		if err := checkNilDoc(doc); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+	ids := make([]any, 0, len(docs))
+	for _, doc := range docs {
+		id, err := s.insert(collection, doc)
+		if err != nil {
+			return ids, fmt.Errorf("%w: %w", ErrWriteFailed, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *memoryStore) Upsert(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error) {
+	res, err := s.modify(collection, filter, update, nil, false, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWriteFailed, err)
+	}
+	return res.writeResult(), nil
+}
+
+func (s *memoryStore) ReplaceOne(ctx context.Context, collection string, filter bson.D, doc DocInter) (*WriteResult, error) {
+	if err := checkNilDoc(doc); err != nil {
+		return nil, err
+	}
+	res, err := s.replace(collection, filter, doc, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWriteFailed, err)
+	}
+	return res.writeResult(), nil
+}
+
+func (s *memoryStore) FindOneAndUpdate(ctx context.Context, collection string, filter any, update bson.D, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult {
+	fo := &options.FindOneAndUpdateOptions{}
+	for _, o := range opts {
+		for _, set := range o.List() {
+			if err := set(fo); err != nil {
+				return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+			}
+		}
+	}
+	res, err := s.modify(collection, filter, update, fo.Sort, false, isTrue(fo.Upsert))
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	doc := res.before
+	if fo.ReturnDocument != nil && *fo.ReturnDocument == options.After {
+		doc = res.after
+	}
+	return singleResult(doc, fo.Projection)
+}
+
+func (s *memoryStore) FindOneAndDelete(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOneAndDeleteOptions]) *mongo.SingleResult {
+	fo := &options.FindOneAndDeleteOptions{}
+	for _, o := range opts {
+		for _, set := range o.List() {
+			if err := set(fo); err != nil {
+				return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+			}
+		}
+	}
+	deleted, err := s.delete(collection, filter, fo.Sort, false)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	if len(deleted) == 0 {
+		return singleResult(nil, nil)
+	}
+	return singleResult(deleted[0], fo.Projection)
+}
+
+func (s *memoryStore) PipeFind(ctx context.Context, collection string, pipeline mongo.Pipeline) (*mongo.Cursor, error) {
+	docs, err := s.aggregate(collection, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return mongo.NewCursorFromDocuments(toAny(docs), nil, nil)
+}
+
+func (s *memoryStore) PipeFindOne(ctx context.Context, collection string, pipeline mongo.Pipeline) *mongo.SingleResult {
+	docs, err := s.aggregate(collection, pipeline)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	if len(docs) == 0 {
+		return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+	}
+	return mongo.NewSingleResultFromDocument(docs[0], nil, nil)
+}
+
+func (s *memoryStore) Watch(ctx context.Context, collection string, pipeline mongo.Pipeline, opts ...options.Lister[options.ChangeStreamOptions]) (ChangeStream, error) {
+	return nil, fmt.Errorf("change streams are %w", errUnsupported)
+}
+
+// Transaction runs fn and restores the previous contents of all collections,
+// including those of other databases, if it fails.
+func (s *memoryStore) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	snapshot := s.snapshot()
+	if err := fn(ctx); err != nil {
+		s.restore(snapshot)
+		return err
+	}
+	return nil
+}
+
+// memorySnapshot holds the collections of a memoryStore and of its databases.
+type memorySnapshot struct {
+	collections map[string][]bson.D
+	databases   map[string]memorySnapshot
+}
+
+func (s *memoryStore) snapshot() memorySnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := memorySnapshot{
+		collections: make(map[string][]bson.D, len(s.collections)),
+		databases:   make(map[string]memorySnapshot, len(s.databases)),
+	}
+	for name, docs := range s.collections {
+		snap.collections[name] = append([]bson.D(nil), docs...)
+	}
+	for name, db := range s.databases {
+		snap.databases[name] = db.snapshot()
+	}
+	return snap
+}
+
+// restore puts back the collections of snap. Databases created after it was taken are emptied.
+func (s *memoryStore) restore(snap memorySnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collections = snap.collections
+	for name, db := range s.databases {
+		if dbSnap, ok := snap.databases[name]; ok {
+			db.restore(dbSnap)
+		} else {
+			db.restore(memorySnapshot{collections: map[string][]bson.D{}})
+		}
+	}
+}
+
+func (s *memoryStore) NewBulkOperation(cname string, opts ...BulkOption) BulkOperator {
+	b := &bulkOperation{
+		cname:      cname,
+		operations: make([]mongo.WriteModel, 0),
+		write: func(ctx context.Context, models []mongo.WriteModel, ordered bool) (*mongo.BulkWriteResult, error) {
+			return s.bulkWrite(cname, models, ordered)
+		},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func (s *memoryStore) database(name string) Datastore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.databases == nil {
+		s.databases = map[string]*memoryStore{}
+	}
+	db, ok := s.databases[name]
+	if !ok {
+		db = &memoryStore{collections: map[string][]bson.D{}}
+		s.databases[name] = db
+	}
+	return db
+}
+
+// getCollection fails: index management, migrations and resume tokens need a MongoDB server.
+func (s *memoryStore) getCollection(name string) (*mongo.Collection, error) {
+	return nil, fmt.Errorf("driver access to collection '%s' is %w", name, errUnsupported)
+}
+
+func (s *memoryStore) close(ctx context.Context) error {
+	return nil
+}
+
+// insert stores doc, generating an ObjectID when it has no _id, and returns the _id.
+func (s *memoryStore) insert(collection string, doc any) (any, error) {
+	d, err := normalizeDoc(doc)
+	if err != nil {
+		return nil, err
+	}
+	d, id := withID(d)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkUnique(collection, d, -1); err != nil {
+		return nil, err
+	}
+	s.collections[collection] = append(s.collections[collection], d)
+	return id, nil
+}
+
+// query returns copies of the matching documents after sort, skip, limit and projection.
+func (s *memoryStore) query(collection string, filter, sortSpec any, skip, limit int64, projection any) ([]bson.D, error) {
+	f, err := normalizeDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	docs, err := filterDocs(s.collections[collection], f)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if sortSpec != nil {
+		spec, err := normalizeDoc(sortSpec)
+		if err != nil {
+			return nil, err
+		}
+		sortDocs(docs, spec)
+	}
+	docs = window(docs, skip, limit)
+	if projection != nil {
+		spec, err := normalizeDoc(projection)
+		if err != nil {
+			return nil, err
+		}
+		for i, d := range docs {
+			docs[i] = project(d, spec)
+		}
+	}
+	return docs, nil
+}
+
+// modifyResult describes the outcome of modify. before and after hold the first
+// affected document; before is nil when the document was inserted by an upsert.
+type modifyResult struct {
+	matched    int64
+	modified   int64
+	upsertedID any
+	before     bson.D
+	after      bson.D
+}
+
+func (r modifyResult) writeResult() *WriteResult {
+	return &WriteResult{MatchedCount: r.matched, ModifiedCount: r.modified, UpsertedID: r.upsertedID}
+}
+
+// modify applies update to the first matching document in sortSpec order, or to all of them.
+// With upsert, a document built from the equality conditions of filter is inserted when none matches.
+func (s *memoryStore) modify(collection string, filter, update, sortSpec any, many, upsert bool) (modifyResult, error) {
+	var res modifyResult
+	f, u, spec, err := normalizeArgs(filter, update, sortSpec)
+	if err != nil {
+		return res, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	docs := s.collections[collection]
+	positions, err := matchingPositions(docs, f, spec)
+	if err != nil {
+		return res, err
+	}
+	if !many && len(positions) > 1 {
+		positions = positions[:1]
+	}
+	for _, i := range positions {
+		res.matched++
+		updated, err := applyUpdate(docs[i], u, false)
+		if err != nil {
+			return res, err
+		}
+		if res.before == nil {
+			res.before, res.after = docs[i], updated
+		}
+		if equalValue(docs[i], updated) {
+			continue
+		}
+		if err := s.checkUnique(collection, updated, i); err != nil {
+			return res, err
+		}
+		docs[i] = updated
+		res.modified++
+	}
+	if res.matched > 0 || !upsert {
+		return res, nil
+	}
+
+	inserted, err := applyUpdate(upsertBase(f), u, true)
+	if err != nil {
+		return res, err
+	}
+	inserted, res.upsertedID = withID(inserted)
+	if err := s.checkUnique(collection, inserted, -1); err != nil {
+		return res, err
+	}
+	s.collections[collection] = append(docs, inserted)
+	res.after = inserted
+	return res, nil
+}
+
+// replace substitutes the first matching document with replacement, keeping its _id.
+// With upsert, replacement is inserted when none matches.
+func (s *memoryStore) replace(collection string, filter, replacement any, upsert bool) (modifyResult, error) {
+	var res modifyResult
+	f, r, _, err := normalizeArgs(filter, replacement, nil)
+	if err != nil {
+		return res, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	docs := s.collections[collection]
+	positions, err := matchingPositions(docs, f, nil)
+	if err != nil {
+		return res, err
+	}
+	if len(positions) == 0 {
+		if !upsert {
+			return res, nil
+		}
+		if id, ok := lookupExact(f, "_id"); ok {
+			if _, hasID := lookupExact(r, "_id"); !hasID {
+				r = append(bson.D{{Key: "_id", Value: id}}, r...)
+			}
+		}
+		r, res.upsertedID = withID(r)
+		if err := s.checkUnique(collection, r, -1); err != nil {
+			return res, err
+		}
+		s.collections[collection] = append(docs, r)
+		res.after = r
+		return res, nil
+	}
+
+	i := positions[0]
+	id, _ := lookupExact(docs[i], "_id")
+	replaced := append(bson.D{{Key: "_id", Value: id}}, unsetPath(r, "_id")...)
+	res.matched, res.before, res.after = 1, docs[i], replaced
+	if equalValue(docs[i], replaced) {
+		return res, nil
+	}
+	if err := s.checkUnique(collection, replaced, i); err != nil {
+		return res, err
+	}
+	docs[i] = replaced
+	res.modified = 1
+	return res, nil
+}
+
+// delete removes the first matching document in sortSpec order, or all of them,
+// and returns the removed documents.
+func (s *memoryStore) delete(collection string, filter, sortSpec any, many bool) ([]bson.D, error) {
+	f, _, spec, err := normalizeArgs(filter, nil, sortSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	docs := s.collections[collection]
+	positions, err := matchingPositions(docs, f, spec)
+	if err != nil {
+		return nil, err
+	}
+	if !many && len(positions) > 1 {
+		positions = positions[:1]
+	}
+	removed := make(map[int]bool, len(positions))
+	deleted := make([]bson.D, 0, len(positions))
+	for _, i := range positions {
+		removed[i] = true
+		deleted = append(deleted, docs[i])
+	}
+	kept := make([]bson.D, 0, len(docs)-len(positions))
+	for i, d := range docs {
+		if !removed[i] {
+			kept = append(kept, d)
+		}
+	}
+	s.collections[collection] = kept
+	return deleted, nil
+}
+
+// aggregate evaluates the supported pipeline stages.
+func (s *memoryStore) aggregate(collection string, pipeline mongo.Pipeline) ([]bson.D, error) {
+	s.mu.Lock()
+	docs := append([]bson.D(nil), s.collections[collection]...)
+	s.mu.Unlock()
+
+	stages := make(bson.A, len(pipeline))
+	for i, stage := range pipeline {
+		stages[i] = stage
+	}
+	return runPipeline(docs, stages)
+}
+
+// runPipeline applies the aggregation stages to docs.
+func runPipeline(docs []bson.D, stages bson.A) ([]bson.D, error) {
+	for _, raw := range stages {
+		stage, err := normalizeDoc(raw)
+		if err != nil {
+			return nil, err
+		}
+		if len(stage) != 1 {
+			return nil, fmt.Errorf("pipeline stage must have exactly one field, got %d", len(stage))
+		}
+		arg := stage[0].Value
+		switch stage[0].Key {
+		case "$match":
+			f, _ := arg.(bson.D)
+			if docs, err = filterDocs(docs, f); err != nil {
+				return nil, err
+			}
+		case "$sort":
+			spec, _ := arg.(bson.D)
+			sortDocs(docs, spec)
+		case "$skip":
+			n, _ := toFloat(arg)
+			docs = window(docs, int64(n), 0)
+		case "$limit":
+			n, _ := toFloat(arg)
+			docs = window(docs, 0, int64(n))
+		case "$project":
+			spec, _ := arg.(bson.D)
+			for i, d := range docs {
+				docs[i] = project(d, spec)
+			}
+		case "$count":
+			field, _ := arg.(string)
+			docs = []bson.D{{{Key: field, Value: int32(len(docs))}}}
+		case "$unwind":
+			if docs, err = unwind(docs, arg); err != nil {
+				return nil, err
+			}
+		case "$facet":
+			facets, _ := arg.(bson.D)
+			out := make(bson.D, 0, len(facets))
+			for _, f := range facets {
+				sub, _ := f.Value.(bson.A)
+				result, err := runPipeline(append([]bson.D(nil), docs...), sub)
+				if err != nil {
+					return nil, err
+				}
+				items := make(bson.A, len(result))
+				for i, d := range result {
+					items[i] = d
+				}
+				out = append(out, bson.E{Key: f.Key, Value: items})
+			}
+			docs = []bson.D{out}
+		default:
+			return nil, fmt.Errorf("pipeline stage %s is %w", stage[0].Key, errUnsupported)
+		}
+	}
+	return docs, nil
+}
+
+// unwind emits one document per element of the array at the $unwind path.
+func unwind(docs []bson.D, arg any) ([]bson.D, error) {
+	var path string
+	preserve := false
+	switch a := arg.(type) {
+	case string:
+		path = a
+	case bson.D:
+		for _, e := range a {
+			switch e.Key {
+			case "path":
+				path, _ = e.Value.(string)
+			case "preserveNullAndEmptyArrays":
+				preserve = truthy(e.Value)
+			default:
+				return nil, fmt.Errorf("$unwind option %s is %w", e.Key, errUnsupported)
+			}
+		}
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("$unwind path must start with $, got %q", path)
+	}
+	field := path[1:]
+	var out []bson.D
+	for _, d := range docs {
+		v, ok := lookupExact(d, field)
+		arr, isArray := v.(bson.A)
+		switch {
+		case isArray && len(arr) > 0:
+			for _, item := range arr {
+				c, err := setPath(cloneValue(d).(bson.D), field, item)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, c)
+			}
+		case ok && v != nil && !isArray:
+			out = append(out, d)
+		case preserve && isArray:
+			out = append(out, unsetPath(d, field))
+		case preserve:
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// bulkWrite executes the write models in order. Like the server, it reports write errors
+// such as duplicate keys in a mongo.BulkWriteException and, when ordered, stops at the first.
+// Other errors stop the write immediately.
+func (s *memoryStore) bulkWrite(collection string, models []mongo.WriteModel, ordered bool) (*mongo.BulkWriteResult, error) {
+	result := &mongo.BulkWriteResult{UpsertedIDs: map[int64]any{}, Acknowledged: true}
+	var bwe mongo.BulkWriteException
+	for i, model := range models {
+		var res modifyResult
+		var deleted []bson.D
+		var err error
+		switch m := model.(type) {
+		case *mongo.InsertOneModel:
+			if _, err = s.insert(collection, m.Document); err == nil {
+				result.InsertedCount++
+			}
+		case *mongo.UpdateOneModel:
+			res, err = s.modify(collection, m.Filter, m.Update, m.Sort, false, isTrue(m.Upsert))
+		case *mongo.UpdateManyModel:
+			res, err = s.modify(collection, m.Filter, m.Update, nil, true, isTrue(m.Upsert))
+		case *mongo.ReplaceOneModel:
+			res, err = s.replace(collection, m.Filter, m.Replacement, isTrue(m.Upsert))
+		case *mongo.DeleteOneModel:
+			deleted, err = s.delete(collection, m.Filter, nil, false)
+		case *mongo.DeleteManyModel:
+			deleted, err = s.delete(collection, m.Filter, nil, true)
+		default:
+			err = fmt.Errorf("write model %T is %w", model, errUnsupported)
+		}
+		result.MatchedCount += res.matched
+		result.ModifiedCount += res.modified
+		result.DeletedCount += int64(len(deleted))
+		if res.upsertedID != nil {
+			result.UpsertedCount++
+			result.UpsertedIDs[int64(i)] = res.upsertedID
+		}
+		var we mongo.WriteException
+		if errors.As(err, &we) && len(we.WriteErrors) > 0 {
+			writeErr := we.WriteErrors[0]
+			writeErr.Index = i
+			bwe.WriteErrors = append(bwe.WriteErrors, mongo.BulkWriteError{WriteError: writeErr, Request: model})
+			if ordered {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+	if len(bwe.WriteErrors) > 0 {
+		return result, bwe
+	}
+	return result, nil
+}
+
+// checkUnique reports a duplicate key error if d collides with another document on _id
+// or on a unique index registered for collection. skip is the position of d itself, or -1.
+func (s *memoryStore) checkUnique(collection string, d bson.D, skip int) error {
+	keys := []bson.D{{{Key: "_id", Value: int32(1)}}}
+	for _, idx := range indexes {
+		if idx.C() != collection {
+			continue
+		}
+		for _, model := range idx.Indexes() {
+			spec, err := desiredIndexSpec(model)
+			if err == nil && spec.Options["unique"] == true {
+				keys = append(keys, spec.Keys)
+			}
+		}
+	}
+	for _, key := range keys {
+		for i, other := range s.collections[collection] {
+			if i == skip {
+				continue
+			}
+			if sameIndexKey(d, other, key) {
+				return duplicateKeyError(collection, key)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeArgs normalizes the filter, update or replacement, and sort arguments of a write.
+func normalizeArgs(filter, doc, sortSpec any) (f, d, spec bson.D, err error) {
+	if f, err = normalizeDoc(filter); err != nil {
+		return
+	}
+	if d, err = normalizeDoc(doc); err != nil {
+		return
+	}
+	if sortSpec != nil {
+		spec, err = normalizeDoc(sortSpec)
+	}
+	return
+}
+
+// matchingPositions returns the positions of the documents matching filter, in spec order if given.
+func matchingPositions(docs []bson.D, filter, spec bson.D) ([]int, error) {
+	var positions []int
+	for i, d := range docs {
+		ok, err := matchDoc(d, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			positions = append(positions, i)
+		}
+	}
+	if len(spec) > 0 {
+		sort.SliceStable(positions, func(a, b int) bool {
+			return docLess(docs[positions[a]], docs[positions[b]], spec)
+		})
+	}
+	return positions, nil
+}
+
+// upsertBase builds the document an upsert starts from: the equality conditions of filter.
+func upsertBase(filter bson.D) bson.D {
+	base := bson.D{}
+	for _, e := range filter {
+		if e.Key == "$and" {
+			clauses, _ := e.Value.(bson.A)
+			for _, c := range clauses {
+				if clause, ok := c.(bson.D); ok {
+					for _, f := range upsertBase(clause) {
+						base, _ = setPath(base, f.Key, f.Value)
+					}
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(e.Key, "$") {
+			continue
+		}
+		value := e.Value
+		if ops, ok := operatorDoc(value); ok {
+			if len(ops) != 1 || ops[0].Key != "$eq" {
+				continue
+			}
+			value = ops[0].Value
+		}
+		base, _ = setPath(base, e.Key, value)
+	}
+	return base
+}
+
+// withID returns d with an _id, generating an ObjectID in front when it has none, and the _id.
+func withID(d bson.D) (bson.D, any) {
+	if id, ok := lookupExact(d, "_id"); ok {
+		return d, id
+	}
+	id := bson.NewObjectID()
+	return append(bson.D{{Key: "_id", Value: id}}, d...), id
+}
+
+// singleResult wraps an optional document, applying projection, as the driver returns it.
+func singleResult(doc bson.D, projection any) *mongo.SingleResult {
+	if doc == nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+	}
+	if projection != nil {
+		spec, err := normalizeDoc(projection)
+		if err != nil {
+			return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+		}
+		doc = project(doc, spec)
+	}
+	return mongo.NewSingleResultFromDocument(doc, nil, nil)
+}
+
+func isTrue(b *bool) bool {
+	return b != nil && *b
+}
+
+// sameIndexKey reports whether a and b have equal values for all fields of key.
+// Missing fields are indexed as null, as in MongoDB.
+func sameIndexKey(a, b, key bson.D) bool {
+	for _, k := range key {
+		av, _ := lookupExact(a, k.Key)
+		bv, _ := lookupExact(b, k.Key)
+		if !equalValue(av, bv) {
+			return false
+		}
+	}
+	return true
+}
+
+// duplicateKeyError builds the error the server returns, so that mongo.IsDuplicateKeyError recognises it.
+func duplicateKeyError(collection string, key bson.D) error {
+	fields := make([]string, len(key))
+	for i, k := range key {
+		fields[i] = k.Key
+	}
+	return mongo.WriteException{WriteErrors: []mongo.WriteError{{
+		Code:    11000,
+		Message: fmt.Sprintf("E11000 duplicate key error collection: %s index: %s", collection, strings.Join(fields, "_")),
+	}}}
+}
+
+// normalizeDoc converts v to a bson.D holding the types the driver decodes, e.g.
+// bson.DateTime instead of time.Time, so that values compare consistently. nil yields an empty document.
+func normalizeDoc(v any) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func toAny(docs []bson.D) []any {
+	out := make([]any, len(docs))
+	for i, d := range docs {
+		out[i] = d
+	}
+	return out
+}
+
+// filterDocs returns the documents matching filter.
+func filterDocs(docs []bson.D, filter bson.D) ([]bson.D, error) {
+	out := make([]bson.D, 0, len(docs))
+	for _, d := range docs {
+		ok, err := matchDoc(d, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// window applies skip and limit; a zero limit means no limit.
+func window(docs []bson.D, skip, limit int64) []bson.D {
+	if skip >= int64(len(docs)) {
+		return []bson.D{}
+	}
+	docs = docs[skip:]
+	if limit > 0 && limit < int64(len(docs)) {
+		docs = docs[:limit]
+	}
+	return docs
+}
+
+// matchDoc evaluates a query filter against d.
+func matchDoc(d bson.D, filter bson.D) (bool, error) {
+	for _, e := range filter {
+		var ok bool
+		var err error
+		switch e.Key {
+		case "$and", "$or", "$nor":
+			ok, err = matchLogical(d, e.Key, e.Value)
+		default:
+			if strings.HasPrefix(e.Key, "$") {
+				return false, fmt.Errorf("query operator %s is %w", e.Key, errUnsupported)
+			}
+			ok, err = matchField(lookupPath(d, e.Key), e.Value)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(d bson.D, op string, arg any) (bool, error) {
+	clauses, ok := arg.(bson.A)
+	if !ok || len(clauses) == 0 {
+		return false, fmt.Errorf("%s requires a non-empty array", op)
+	}
+	for _, c := range clauses {
+		clause, _ := c.(bson.D)
+		ok, err := matchDoc(d, clause)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case op == "$and" && !ok:
+			return false, nil
+		case op == "$or" && ok:
+			return true, nil
+		case op == "$nor" && ok:
+			return false, nil
+		}
+	}
+	return op != "$or", nil
+}
+
+// matchField evaluates a field condition, either a value or an operator document,
+// against the values found at the field's path.
+func matchField(values []any, cond any) (bool, error) {
+	ops, ok := operatorDoc(cond)
+	if !ok {
+		return matchEq(values, cond), nil
+	}
+	for _, op := range ops {
+		ok, err := matchOperator(values, op.Key, op.Value, ops)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// operatorDoc returns cond as a document when all its keys are query operators.
+func operatorDoc(cond any) (bson.D, bool) {
+	d, ok := cond.(bson.D)
+	if !ok || len(d) == 0 {
+		return nil, false
+	}
+	for _, e := range d {
+		if !strings.HasPrefix(e.Key, "$") {
+			return nil, false
+		}
+	}
+	return d, true
+}
+
+func matchOperator(values []any, op string, arg any, ops bson.D) (bool, error) {
+	switch op {
+	case "$eq":
+		return matchEq(values, arg), nil
+	case "$ne":
+		return !matchEq(values, arg), nil
+	case "$in", "$nin":
+		list, ok := arg.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("%s requires an array", op)
+		}
+		found := false
+		for _, v := range list {
+			if matchEq(values, v) {
+				found = true
+				break
+			}
+		}
+		return found == (op == "$in"), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, v := range expand(values) {
+			c, ok := compareValues(v, arg)
+			if !ok {
+				continue
+			}
+			if (op == "$gt" && c > 0) || (op == "$gte" && c >= 0) || (op == "$lt" && c < 0) || (op == "$lte" && c <= 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$exists":
+		want, _ := arg.(bool)
+		return (len(values) > 0) == want, nil
+	case "$size":
+		n, ok := toFloat(arg)
+		if !ok {
+			return false, errors.New("$size requires a number")
+		}
+		for _, v := range values {
+			if a, ok := v.(bson.A); ok && len(a) == int(n) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$regex":
+		return matchRegex(values, arg, ops)
+	case "$options":
+		// Read together with $regex.
+		return true, nil
+	case "$not":
+		ok, err := matchField(values, arg)
+		return !ok, err
+	}
+	return false, fmt.Errorf("query operator %s is %w", op, errUnsupported)
+}
+
+func matchRegex(values []any, arg any, ops bson.D) (bool, error) {
+	var pattern, flags string
+	switch r := arg.(type) {
+	case string:
+		pattern = r
+	case bson.Regex:
+		pattern, flags = r.Pattern, r.Options
+	default:
+		return false, errors.New("$regex requires a string")
+	}
+	for _, op := range ops {
+		if op.Key == "$options" {
+			flags, _ = op.Value.(string)
+		}
+	}
+	var goFlags string
+	for _, f := range flags {
+		if strings.ContainsRune("imsU", f) {
+			goFlags += string(f)
+		}
+	}
+	if goFlags != "" {
+		pattern = "(?" + goFlags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range expand(values) {
+		if s, ok := v.(string); ok && re.MatchString(s) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchEq reports whether any value, or any element of an array value, equals want.
+// A null condition also matches missing fields.
+func matchEq(values []any, want any) bool {
+	if len(values) == 0 {
+		return want == nil
+	}
+	for _, v := range values {
+		if equalValue(v, want) {
+			return true
+		}
+		if a, ok := v.(bson.A); ok {
+			for _, item := range a {
+				if equalValue(item, want) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// expand flattens array values into their elements.
+func expand(values []any) []any {
+	out := make([]any, 0, len(values))
+	for _, v := range values {
+		if a, ok := v.(bson.A); ok {
+			out = append(out, a...)
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// lookupPath returns the values at a dotted path, descending into every element of
+// arrays found on the way, as MongoDB queries do. It returns nil for missing fields.
+func lookupPath(v any, path string) []any {
+	return lookupParts(v, strings.Split(path, "."))
+}
+
+func lookupParts(v any, parts []string) []any {
+	if len(parts) == 0 {
+		return []any{v}
+	}
+	switch x := v.(type) {
+	case bson.D:
+		for _, e := range x {
+			if e.Key == parts[0] {
+				return lookupParts(e.Value, parts[1:])
+			}
+		}
+	case bson.A:
+		if i, err := strconv.Atoi(parts[0]); err == nil {
+			if i >= 0 && i < len(x) {
+				return lookupParts(x[i], parts[1:])
+			}
+			return nil
+		}
+		var out []any
+		for _, item := range x {
+			out = append(out, lookupParts(item, parts)...)
+		}
+		return out
+	}
+	return nil
+}
+
+// lookupExact returns the value at a dotted path without descending into arrays
+// except by numeric index.
+func lookupExact(d bson.D, path string) (any, bool) {
+	var v any = d
+	for _, part := range strings.Split(path, ".") {
+		switch x := v.(type) {
+		case bson.D:
+			found := false
+			for _, e := range x {
+				if e.Key == part {
+					v, found = e.Value, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		case bson.A:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(x) {
+				return nil, false
+			}
+			v = x[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// applyUpdate returns a copy of d with the update operators applied.
+// $setOnInsert only applies when insert is set.
+func applyUpdate(d bson.D, update bson.D, insert bool) (bson.D, error) {
+	out := cloneValue(d).(bson.D)
+	for _, op := range update {
+		fields, ok := op.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("update operator %s requires a document", op.Key)
+		}
+		for _, f := range fields {
+			var err error
+			switch op.Key {
+			case "$set":
+				out, err = setPath(out, f.Key, f.Value)
+			case "$unset":
+				out = unsetPath(out, f.Key)
+			case "$inc":
+				current, _ := lookupExact(out, f.Key)
+				var sum any
+				if sum, err = addNumbers(current, f.Value); err == nil {
+					out, err = setPath(out, f.Key, sum)
+				}
+			case "$push":
+				current, exists := lookupExact(out, f.Key)
+				list, isArray := current.(bson.A)
+				if exists && !isArray {
+					return nil, fmt.Errorf("$push target %s is not an array", f.Key)
+				}
+				items := bson.A{f.Value}
+				if each, ok := f.Value.(bson.D); ok && len(each) > 0 && each[0].Key == "$each" {
+					items, _ = each[0].Value.(bson.A)
+				}
+				out, err = setPath(out, f.Key, append(append(bson.A{}, list...), items...))
+			case "$setOnInsert":
+				if insert {
+					out, err = setPath(out, f.Key, f.Value)
+				}
+			default:
+				if strings.HasPrefix(op.Key, "$") {
+					return nil, fmt.Errorf("update operator %s is %w", op.Key, errUnsupported)
+				}
+				return nil, errors.New("update document must contain only update operators")
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+// setPath sets the value at a dotted path, creating intermediate documents.
+func setPath(d bson.D, path string, value any) (bson.D, error) {
+	v, err := setParts(d, strings.Split(path, "."), value)
+	if err != nil {
+		return nil, err
+	}
+	return v.(bson.D), nil
+}
+
+func setParts(container any, parts []string, value any) (any, error) {
+	if len(parts) == 0 {
+		return value, nil
+	}
+	switch x := container.(type) {
+	case bson.D:
+		for i, e := range x {
+			if e.Key == parts[0] {
+				v, err := setParts(e.Value, parts[1:], value)
+				if err != nil {
+					return nil, err
+				}
+				x[i].Value = v
+				return x, nil
+			}
+		}
+		v, err := setParts(bson.D{}, parts[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		return append(x, bson.E{Key: parts[0], Value: v}), nil
+	case bson.A:
+		i, err := strconv.Atoi(parts[0])
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("cannot set field %s in an array", parts[0])
+		}
+		for len(x) <= i {
+			x = append(x, nil)
+		}
+		v, err := setParts(x[i], parts[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		x[i] = v
+		return x, nil
+	case nil:
+		return setParts(bson.D{}, parts, value)
+	}
+	return nil, fmt.Errorf("cannot set field %s in a %T", parts[0], container)
+}
+
+// unsetPath removes the field at a dotted path, if present.
+func unsetPath(d bson.D, path string) bson.D {
+	parts := strings.Split(path, ".")
+	out := make(bson.D, 0, len(d))
+	for _, e := range d {
+		if e.Key != parts[0] {
+			out = append(out, e)
+			continue
+		}
+		if len(parts) == 1 {
+			continue
+		}
+		if child, ok := e.Value.(bson.D); ok {
+			e.Value = unsetPath(child, strings.Join(parts[1:], "."))
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// addNumbers implements $inc: a missing field counts as zero, integers stay integers.
+func addNumbers(current, delta any) (any, error) {
+	if current == nil {
+		return delta, nil
+	}
+	switch c := current.(type) {
+	case int32:
+		if d, ok := delta.(int32); ok {
+			return c + d, nil
+		}
+		if d, ok := delta.(int64); ok {
+			return int64(c) + d, nil
+		}
+	case int64:
+		if d, ok := delta.(int32); ok {
+			return c + int64(d), nil
+		}
+		if d, ok := delta.(int64); ok {
+			return c + d, nil
+		}
+	}
+	a, ok1 := toFloat(current)
+	b, ok2 := toFloat(delta)
+	if !ok1 || !ok2 {
+		return nil, errors.New("$inc requires numeric values")
+	}
+	return a + b, nil
+}
+
+func cloneValue(v any) any {
+	switch x := v.(type) {
+	case bson.D:
+		out := make(bson.D, len(x))
+		for i, e := range x {
+			out[i] = bson.E{Key: e.Key, Value: cloneValue(e.Value)}
+		}
+		return out
+	case bson.A:
+		out := make(bson.A, len(x))
+		for i, e := range x {
+			out[i] = cloneValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+// project applies an inclusion or exclusion projection on top-level fields.
+// _id is included unless excluded explicitly.
+func project(d bson.D, spec bson.D) bson.D {
+	include, keepID := false, true
+	fields := map[string]bool{}
+	for _, e := range spec {
+		on := truthy(e.Value)
+		if e.Key == "_id" {
+			keepID = on
+			continue
+		}
+		fields[e.Key] = on
+		include = include || on
+	}
+	out := bson.D{}
+	for _, e := range d {
+		switch {
+		case e.Key == "_id":
+			if keepID {
+				out = append(out, e)
+			}
+		case include && fields[e.Key]:
+			out = append(out, e)
+		case !include:
+			if _, excluded := fields[e.Key]; !excluded {
+				out = append(out, e)
+			}
+		}
+	}
+	return out
+}
+
+func truthy(v any) bool {
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	n, ok := toFloat(v)
+	return !ok || n != 0
+}
+
+// sortDocs sorts docs in place by the sort specification, using MongoDB's type order
+// for values of different types.
+func sortDocs(docs []bson.D, spec bson.D) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		return docLess(docs[i], docs[j], spec)
+	})
+}
+
+// docLess reports whether a sorts before b according to spec.
+func docLess(a, b bson.D, spec bson.D) bool {
+	for _, k := range spec {
+		dir, _ := toFloat(k.Value)
+		av, _ := lookupExact(a, k.Key)
+		bv, _ := lookupExact(b, k.Key)
+		c := sortCompare(av, bv)
+		if c == 0 {
+			continue
+		}
+		if dir < 0 {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
+
+func sortCompare(a, b any) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	if c, ok := compareValues(a, b); ok {
+		return c
+	}
+	return 0
+}
+
+// typeRank follows MongoDB's comparison order of BSON types.
+func typeRank(v any) int {
+	if _, ok := toFloat(v); ok {
+		return 2
+	}
+	switch v.(type) {
+	case nil:
+		return 1
+	case string:
+		return 3
+	case bson.D:
+		return 4
+	case bson.A:
+		return 5
+	case bson.Binary:
+		return 6
+	case bson.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case bson.DateTime:
+		return 9
+	}
+	return 10
+}
+
+// compareValues orders two values of comparable types; ok is false otherwise.
+func compareValues(a, b any) (int, bool) {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case bson.DateTime:
+		if y, ok := b.(bson.DateTime); ok {
+			return compareInt(int64(x), int64(y)), true
+		}
+	case bson.ObjectID:
+		if y, ok := b.(bson.ObjectID); ok {
+			return bytes.Compare(x[:], y[:]), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case !x:
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// filesCollection is the collection holding the files of a GridFS bucket.
+func filesCollection(bucket string) string {
+	return bucket + ".files"
+}
+
+// memoryFile is a stored file; unlike GridFS, the content is kept in the file document.
+type memoryFile struct {
+	File    `bson:",inline"`
+	Content []byte `bson:"content"`
+}
+
+// UploadFile reads source completely and stores it with the file document.
+func (s *memoryStore) UploadFile(ctx context.Context, bucket, name string, source io.Reader, metadata any) (bson.ObjectID, error) {
+	content, err := io.ReadAll(source)
+	if err != nil {
+		return bson.ObjectID{}, err
+	}
+	id := bson.NewObjectID()
+	doc := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "length", Value: int64(len(content))},
+		{Key: "chunkSize", Value: int32(255 * 1024)},
+		{Key: "uploadDate", Value: nowFunc()},
+		{Key: "filename", Value: name},
+	}
+	if metadata != nil {
+		doc = append(doc, bson.E{Key: "metadata", Value: metadata})
+	}
+	doc = append(doc, bson.E{Key: "content", Value: content})
+	if _, err := s.insert(filesCollection(bucket), doc); err != nil {
+		return bson.ObjectID{}, err
+	}
+	return id, nil
+}
+
+func (s *memoryStore) OpenDownloadStream(ctx context.Context, bucket string, fileID any) (FileReader, error) {
+	docs, err := s.query(filesCollection(bucket), bson.D{{Key: "_id", Value: fileID}}, nil, 0, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, mongo.ErrFileNotFound
+	}
+	var f memoryFile
+	if err := decodeDoc(docs[0], &f); err != nil {
+		return nil, err
+	}
+	return newBytesFileReader(&f.File, f.Content), nil
+}
+
+func (s *memoryStore) DeleteFile(ctx context.Context, bucket string, fileID any) error {
+	deleted, err := s.delete(filesCollection(bucket), bson.D{{Key: "_id", Value: fileID}}, nil, false)
+	if err != nil {
+		return err
+	}
+	if len(deleted) == 0 {
+		return mongo.ErrFileNotFound
+	}
+	return nil
+}
+
+func (s *memoryStore) FindFiles(ctx context.Context, bucket string, filter any) ([]*File, error) {
+	docs, err := s.query(filesCollection(bucket), filter, nil, 0, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*File, len(docs))
+	for i, d := range docs {
+		files[i] = &File{}
+		if err := decodeDoc(d, files[i]); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// decodeDoc decodes the stored document d into v.
+func decodeDoc(d bson.D, v any) error {
+	raw, err := bson.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, v)
+}
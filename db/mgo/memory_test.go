@@ -0,0 +1,259 @@
+package mgo_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// testAccount has a unique index on email.
+type testAccount struct {
+	ID    bson.ObjectID `bson:"_id,omitempty"`
+	Email string        `bson:"email"`
+	Tags  []string      `bson:"tags"`
+	Score int           `bson:"score"`
+}
+
+func (a *testAccount) C() string { return "memory_accounts" }
+func (a *testAccount) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)}}
+}
+func (a *testAccount) Validate() error { return nil }
+func (a *testAccount) GetId() any      { return a.ID }
+func (a *testAccount) SetId(id any)    { a.ID = id.(bson.ObjectID) }
+
+func init() {
+	mgo.RegisterIndex(&testAccount{})
+}
+
+func seedUsers(t *testing.T) {
+	t.Helper()
+	for _, u := range []*testUser{{Name: "Peter", Age: 30}, {Name: "Alice", Age: 25}, {Name: "Bob", Age: 41}} {
+		_, err := mgo.Save(context.Background(), u)
+		assert.NoError(t, err)
+	}
+}
+
+func names(users []*testUser) []string {
+	out := make([]string, len(users))
+	for i, u := range users {
+		out[i] = u.Name
+	}
+	return out
+}
+
+func TestMemoryDatastoreFind(t *testing.T) {
+	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+	defer restore()
+	seedUsers(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		filter any
+		want   []string
+	}{
+		{"Equality", bson.D{{Key: "name", Value: "Alice"}}, []string{"Alice"}},
+		{"Range", bson.D{{Key: "age", Value: bson.D{{Key: "$gt", Value: 25}, {Key: "$lte", Value: 41}}}}, []string{"Peter", "Bob"}},
+		{"In", bson.M{"name": bson.M{"$in": bson.A{"Bob", "Alice"}}}, []string{"Alice", "Bob"}},
+		{"Or", bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "age", Value: 25}},
+			bson.D{{Key: "name", Value: "Bob"}},
+		}}}, []string{"Alice", "Bob"}},
+		{"Exists", bson.D{{Key: "email", Value: bson.D{{Key: "$exists", Value: false}}}}, []string{"Peter", "Alice", "Bob"}},
+		{"No filter", nil, []string{"Peter", "Alice", "Bob"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := mgo.Find(ctx, &testUser{}, tt.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, names(result))
+		})
+	}
+
+	t.Run("Sort, skip and limit", func(t *testing.T) {
+		opts := options.Find().SetSort(bson.D{{Key: "age", Value: -1}}).SetSkip(1).SetLimit(1)
+		result, err := mgo.Find(ctx, &testUser{}, nil, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Peter"}, names(result))
+	})
+
+	t.Run("Unsupported operator", func(t *testing.T) {
+		_, err := mgo.Find(ctx, &testUser{}, bson.D{{Key: "$where", Value: "true"}})
+		assert.ErrorIs(t, err, mgo.ErrReadFailed)
+	})
+}
+
+func TestMemoryDatastoreUpdate(t *testing.T) {
+	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+	defer restore()
+	ctx := context.Background()
+
+	account, err := mgo.Save(ctx, &testAccount{Email: "a@example.com", Tags: []string{"new"}})
+	assert.NoError(t, err)
+
+	res, err := mgo.UpdateById(ctx, account, bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "score", Value: 5}}},
+		{Key: "$push", Value: bson.D{{Key: "tags", Value: "vip"}}},
+		{Key: "$set", Value: bson.D{{Key: "profile.city", Value: "Taipei"}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), res.ModifiedCount)
+
+	result, err := mgo.Find(ctx, &testAccount{}, bson.D{{Key: "tags", Value: "vip"}, {Key: "profile.city", Value: "Taipei"}})
+	assert.NoError(t, err)
+	assert.Len(t, result, 1)
+	assert.Equal(t, 5, result[0].Score)
+	assert.Equal(t, []string{"new", "vip"}, result[0].Tags)
+
+	res, err = mgo.UpdateMany(ctx, &testAccount{}, bson.D{}, bson.D{{Key: "$unset", Value: bson.D{{Key: "profile", Value: ""}}}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), res.ModifiedCount)
+	result, err = mgo.Find(ctx, &testAccount{}, bson.D{{Key: "profile", Value: bson.D{{Key: "$exists", Value: true}}}})
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+}
+
+func TestMemoryDatastoreUniqueIndex(t *testing.T) {
+	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+	defer restore()
+	ctx := context.Background()
+
+	_, err := mgo.Save(ctx, &testAccount{Email: "a@example.com"})
+	assert.NoError(t, err)
+	second, err := mgo.Save(ctx, &testAccount{Email: "b@example.com"})
+	assert.NoError(t, err)
+
+	_, err = mgo.Save(ctx, &testAccount{Email: "a@example.com"})
+	assert.ErrorIs(t, err, mgo.ErrWriteFailed)
+	assert.ErrorIs(t, err, mgo.ErrDuplicateKey)
+	assert.True(t, mongo.IsDuplicateKeyError(err))
+	assert.Equal(t, 1, strings.Count(err.Error(), mgo.ErrWriteFailed.Error()))
+
+	_, err = mgo.UpdateById(ctx, second, bson.D{{Key: "$set", Value: bson.D{{Key: "email", Value: "a@example.com"}}}})
+	assert.ErrorIs(t, err, mgo.ErrDuplicateKey)
+	assert.True(t, mongo.IsDuplicateKeyError(err))
+}
+
+func TestMemoryDatastoreDeleteAndTransaction(t *testing.T) {
+	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+	defer restore()
+	seedUsers(t)
+	ctx := context.Background()
+
+	errAbort := errors.New("abort")
+	err := mgo.WithTransaction(ctx, func(ctx context.Context) error {
+		res, err := mgo.DeleteMany(ctx, &testUser{}, bson.D{{Key: "age", Value: bson.D{{Key: "$lt", Value: 35}}}})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), res.DeletedCount)
+		return errAbort
+	})
+	assert.Equal(t, errAbort, err)
+
+	result, err := mgo.Find(ctx, &testUser{}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, result, 3, "rolled back")
+
+	res, err := mgo.DeleteOne(ctx, &testUser{}, bson.D{{Key: "name", Value: "Bob"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), res.DeletedCount)
+}
+
+func TestMemoryDatastoreTransactionOtherDatabase(t *testing.T) {
+	defer mgo.SetDatastore(mgo.NewMemoryDatastore())()
+	ctx := mgo.WithTenant(context.Background(), "a")
+	_, err := mgo.Save(ctx, &testLedger{Memo: "opening"})
+	assert.NoError(t, err)
+
+	errAbort := errors.New("abort")
+	err = mgo.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := mgo.Save(ctx, &testLedger{Memo: "refund"})
+		assert.NoError(t, err)
+		_, err = mgo.Save(mgo.WithTenant(ctx, "b"), &testLedger{Memo: "opening"})
+		assert.NoError(t, err)
+		return errAbort
+	})
+	assert.Equal(t, errAbort, err)
+
+	n, err := mgo.Count(ctx, &testLedger{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n, "rolled back")
+	n, err = mgo.Count(mgo.WithTenant(ctx, "b"), &testLedger{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n, "rolled back")
+}
+
+func TestMemoryDatastoreDriverFeatures(t *testing.T) {
+	defer mgo.SetDatastore(mgo.NewMemoryDatastore())()
+	ctx := context.Background()
+
+	_, err := mgo.Migrate(ctx)
+	assert.ErrorIs(t, err, mgo.ErrMigrationFailed)
+	_, err = mgo.Rollback(ctx, 0)
+	assert.ErrorIs(t, err, mgo.ErrMigrationFailed)
+	assert.ErrorIs(t, mgo.SyncIndexes(ctx), mgo.ErrCreateIndexFailed)
+	assert.Error(t, mgo.SyncIndexes(ctx, mgo.WithReconcile()))
+	assert.Error(t, mgo.NewMongoResumeTokenStore("resume_tokens").Save(ctx, "indexer", nil))
+}
+
+// testAdults aggregates users of at least a given age, sorted by name.
+type testAdults struct {
+	Name string `bson:"name"`
+	Age  int    `bson:"age"`
+}
+
+func (a *testAdults) C() string                   { return "users" }
+func (a *testAdults) Indexes() []mongo.IndexModel { return nil }
+
+func (a *testAdults) GetPipeline(q bson.M) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "age", Value: bson.D{{Key: "$gte", Value: q["minAge"]}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "name", Value: 1}}}},
+		{{Key: "$limit", Value: 2}},
+	}
+}
+
+func TestMemoryDatastorePipeline(t *testing.T) {
+	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+	defer restore()
+	seedUsers(t)
+
+	result, err := mgo.PipeFind(context.Background(), &testAdults{}, bson.M{"minAge": 25})
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "Alice", result[0].Name)
+	assert.Equal(t, "Bob", result[1].Name)
+}
+
+func TestMemoryDatastoreBulk(t *testing.T) {
+	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+	defer restore()
+	seedUsers(t)
+	ctx := context.Background()
+
+	bulk, err := mgo.NewBulkOperation("users")
+	assert.NoError(t, err)
+	result, err := bulk.
+		InsertOne(&testUser{Name: "Carol", Age: 52}).
+		UpdateOne(bson.D{{Key: "name", Value: "Bob"}}, bson.D{{Key: "$inc", Value: bson.D{{Key: "age", Value: 1}}}}).
+		DeleteOne(bson.D{{Key: "name", Value: "Peter"}}).
+		Execute(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.InsertedCount)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+	assert.Equal(t, int64(1), result.DeletedCount)
+
+	users, err := mgo.Find(ctx, &testUser{}, bson.D{{Key: "age", Value: bson.D{{Key: "$gte", Value: 30}}}},
+		options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Bob", "Carol"}, names(users))
+	assert.Equal(t, 42, users[0].Age)
+}
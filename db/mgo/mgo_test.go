@@ -141,25 +141,25 @@ func TestUpdateOne(t *testing.T) {
 		// Arrange
 		filter := bson.D{{Key: "name", Value: "old_name"}}
 		update := bson.D{{Key: "$set", Value: bson.D{{Key: "name", Value: "new_name"}}}}
-		expectedModifiedCount := int64(1)
+		expectedResult := &mgo.WriteResult{MatchedCount: 1, ModifiedCount: 1}
 
 		mockDB := &mgo.MockDatastore{
-			OnUpdateOne: func(ctx context.Context, collection string, f bson.D, u bson.D) (int64, error) {
+			OnUpdateOne: func(ctx context.Context, collection string, f bson.D, u bson.D) (*mgo.WriteResult, error) {
 				assert.Equal(t, "users", collection)
 				assert.Equal(t, filter, f)
 				assert.Equal(t, update, u)
-				return expectedModifiedCount, nil
+				return expectedResult, nil
 			},
 		}
 		restore := mgo.SetDatastore(mockDB)
 		defer restore()
 
 		// Act
-		modifiedCount, err := mgo.UpdateOne(context.Background(), &testUser{}, filter, update)
+		result, err := mgo.UpdateOne(context.Background(), &testUser{}, filter, update)
 
 		// Assert
 		assert.NoError(t, err)
-		assert.Equal(t, expectedModifiedCount, modifiedCount)
+		assert.Equal(t, expectedResult, result)
 	})
 
 	t.Run("Error from Datastore", func(t *testing.T) {
@@ -169,18 +169,18 @@ func TestUpdateOne(t *testing.T) {
 		expectedErr := errors.New("datastore update failed")
 
 		mockDB := &mgo.MockDatastore{
-			OnUpdateOne: func(ctx context.Context, collection string, f bson.D, u bson.D) (int64, error) {
-				return 0, expectedErr
+			OnUpdateOne: func(ctx context.Context, collection string, f bson.D, u bson.D) (*mgo.WriteResult, error) {
+				return nil, expectedErr
 			},
 		}
 		restore := mgo.SetDatastore(mockDB)
 		defer restore()
 
 		// Act
-		modifiedCount, err := mgo.UpdateOne(context.Background(), &testUser{}, filter, update)
+		result, err := mgo.UpdateOne(context.Background(), &testUser{}, filter, update)
 
 		// Assert
-		assert.Zero(t, modifiedCount)
+		assert.Nil(t, result)
 		assert.Error(t, err)
 		assert.ErrorIs(t, err, expectedErr)
 	})
@@ -192,25 +192,25 @@ func TestUpdateById(t *testing.T) {
 		userID := bson.NewObjectID()
 		user := &testUser{ID: userID}
 		update := bson.D{{Key: "$set", Value: bson.D{{Key: "name", Value: "new_name"}}}}
-		expectedModifiedCount := int64(1)
+		expectedResult := &mgo.WriteResult{MatchedCount: 1, ModifiedCount: 1}
 
 		mockDB := &mgo.MockDatastore{
-			OnUpdateOne: func(ctx context.Context, collection string, f bson.D, u bson.D) (int64, error) {
+			OnUpdateOne: func(ctx context.Context, collection string, f bson.D, u bson.D) (*mgo.WriteResult, error) {
 				assert.Equal(t, "users", collection)
 				assert.Equal(t, bson.D{{Key: "_id", Value: userID}}, f)
 				assert.Equal(t, update, u)
-				return expectedModifiedCount, nil
+				return expectedResult, nil
 			},
 		}
 		restore := mgo.SetDatastore(mockDB)
 		defer restore()
 
 		// Act
-		modifiedCount, err := mgo.UpdateById(context.Background(), user, update)
+		result, err := mgo.UpdateById(context.Background(), user, update)
 
 		// Assert
 		assert.NoError(t, err)
-		assert.Equal(t, expectedModifiedCount, modifiedCount)
+		assert.Equal(t, expectedResult, result)
 	})
 
 	t.Run("Error from Datastore", func(t *testing.T) {
@@ -221,18 +221,18 @@ func TestUpdateById(t *testing.T) {
 		expectedErr := errors.New("datastore update by id failed")
 
 		mockDB := &mgo.MockDatastore{
-			OnUpdateOne: func(ctx context.Context, collection string, f bson.D, u bson.D) (int64, error) {
-				return 0, expectedErr
+			OnUpdateOne: func(ctx context.Context, collection string, f bson.D, u bson.D) (*mgo.WriteResult, error) {
+				return nil, expectedErr
 			},
 		}
 		restore := mgo.SetDatastore(mockDB)
 		defer restore()
 
 		// Act
-		modifiedCount, err := mgo.UpdateById(context.Background(), user, update)
+		result, err := mgo.UpdateById(context.Background(), user, update)
 
 		// Assert
-		assert.Zero(t, modifiedCount)
+		assert.Nil(t, result)
 		assert.Error(t, err)
 		assert.ErrorIs(t, err, expectedErr)
 	})
@@ -404,24 +404,24 @@ func TestDeleteOne(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		// Arrange
 		filter := bson.D{{Key: "name", Value: "Peter"}}
-		expectedDeletedCount := int64(1)
+		expectedResult := &mgo.WriteResult{DeletedCount: 1}
 
 		mockDB := &mgo.MockDatastore{
-			OnDeleteOne: func(ctx context.Context, collection string, f bson.D) (int64, error) {
+			OnDeleteOne: func(ctx context.Context, collection string, f bson.D) (*mgo.WriteResult, error) {
 				assert.Equal(t, "users", collection)
 				assert.Equal(t, filter, f)
-				return expectedDeletedCount, nil
+				return expectedResult, nil
 			},
 		}
 		restore := mgo.SetDatastore(mockDB)
 		defer restore()
 
 		// Act
-		deletedCount, err := mgo.DeleteOne(context.Background(), &testUser{}, filter)
+		result, err := mgo.DeleteOne(context.Background(), &testUser{}, filter)
 
 		// Assert
 		assert.NoError(t, err)
-		assert.Equal(t, expectedDeletedCount, deletedCount)
+		assert.Equal(t, expectedResult, result)
 	})
 
 	t.Run("Error from Datastore", func(t *testing.T) {
@@ -430,18 +430,18 @@ func TestDeleteOne(t *testing.T) {
 		expectedErr := errors.New("datastore delete failed")
 
 		mockDB := &mgo.MockDatastore{
-			OnDeleteOne: func(ctx context.Context, collection string, f bson.D) (int64, error) {
-				return 0, expectedErr
+			OnDeleteOne: func(ctx context.Context, collection string, f bson.D) (*mgo.WriteResult, error) {
+				return nil, expectedErr
 			},
 		}
 		restore := mgo.SetDatastore(mockDB)
 		defer restore()
 
 		// Act
-		deletedCount, err := mgo.DeleteOne(context.Background(), &testUser{}, filter)
+		result, err := mgo.DeleteOne(context.Background(), &testUser{}, filter)
 
 		// Assert
-		assert.Zero(t, deletedCount)
+		assert.Nil(t, result)
 		assert.Error(t, err)
 		assert.ErrorIs(t, err, expectedErr)
 	})
@@ -452,24 +452,24 @@ func TestDeleteById(t *testing.T) {
 		// Arrange
 		userID := bson.NewObjectID()
 		user := &testUser{ID: userID}
-		expectedDeletedCount := int64(1)
+		expectedResult := &mgo.WriteResult{DeletedCount: 1}
 
 		mockDB := &mgo.MockDatastore{
-			OnDeleteOne: func(ctx context.Context, collection string, f bson.D) (int64, error) {
+			OnDeleteOne: func(ctx context.Context, collection string, f bson.D) (*mgo.WriteResult, error) {
 				assert.Equal(t, "users", collection)
 				assert.Equal(t, bson.D{{Key: "_id", Value: userID}}, f)
-				return expectedDeletedCount, nil
+				return expectedResult, nil
 			},
 		}
 		restore := mgo.SetDatastore(mockDB)
 		defer restore()
 
 		// Act
-		deletedCount, err := mgo.DeleteById(context.Background(), user)
+		result, err := mgo.DeleteById(context.Background(), user)
 
 		// Assert
 		assert.NoError(t, err)
-		assert.Equal(t, expectedDeletedCount, deletedCount)
+		assert.Equal(t, expectedResult, result)
 	})
 
 	t.Run("Error from Datastore", func(t *testing.T) {
@@ -479,18 +479,18 @@ func TestDeleteById(t *testing.T) {
 		expectedErr := errors.New("datastore delete by id failed")
 
 		mockDB := &mgo.MockDatastore{
-			OnDeleteOne: func(ctx context.Context, collection string, f bson.D) (int64, error) {
-				return 0, expectedErr
+			OnDeleteOne: func(ctx context.Context, collection string, f bson.D) (*mgo.WriteResult, error) {
+				return nil, expectedErr
 			},
 		}
 		restore := mgo.SetDatastore(mockDB)
 		defer restore()
 
 		// Act
-		deletedCount, err := mgo.DeleteById(context.Background(), user)
+		result, err := mgo.DeleteById(context.Background(), user)
 
 		// Assert
-		assert.Zero(t, deletedCount)
+		assert.Nil(t, result)
 		assert.Error(t, err)
 		assert.ErrorIs(t, err, expectedErr)
 	})
@@ -500,24 +500,24 @@ func TestDeleteMany(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		// Arrange
 		filter := bson.D{{Key: "age", Value: 30}}
-		expectedDeletedCount := int64(2)
+		expectedResult := &mgo.WriteResult{DeletedCount: 2}
 
 		mockDB := &mgo.MockDatastore{
-			OnDeleteMany: func(ctx context.Context, collection string, f bson.D) (int64, error) {
+			OnDeleteMany: func(ctx context.Context, collection string, f bson.D) (*mgo.WriteResult, error) {
 				assert.Equal(t, "users", collection)
 				assert.Equal(t, filter, f)
-				return expectedDeletedCount, nil
+				return expectedResult, nil
 			},
 		}
 		restore := mgo.SetDatastore(mockDB)
 		defer restore()
 
 		// Act
-		deletedCount, err := mgo.DeleteMany(context.Background(), &testUser{}, filter)
+		result, err := mgo.DeleteMany(context.Background(), &testUser{}, filter)
 
 		// Assert
 		assert.NoError(t, err)
-		assert.Equal(t, expectedDeletedCount, deletedCount)
+		assert.Equal(t, expectedResult, result)
 	})
 
 	t.Run("Error from Datastore", func(t *testing.T) {
@@ -526,18 +526,18 @@ func TestDeleteMany(t *testing.T) {
 		expectedErr := errors.New("datastore delete many failed")
 
 		mockDB := &mgo.MockDatastore{
-			OnDeleteMany: func(ctx context.Context, collection string, f bson.D) (int64, error) {
-				return 0, expectedErr
+			OnDeleteMany: func(ctx context.Context, collection string, f bson.D) (*mgo.WriteResult, error) {
+				return nil, expectedErr
 			},
 		}
 		restore := mgo.SetDatastore(mockDB)
 		defer restore()
 
 		// Act
-		deletedCount, err := mgo.DeleteMany(context.Background(), &testUser{}, filter)
+		result, err := mgo.DeleteMany(context.Background(), &testUser{}, filter)
 
 		// Assert
-		assert.Zero(t, deletedCount)
+		assert.Nil(t, result)
 		assert.Error(t, err)
 		assert.ErrorIs(t, err, expectedErr)
 	})
@@ -0,0 +1,390 @@
+package mgo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/arwoosa/vulpes/log"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// migrationCollection stores one record per applied migration.
+	migrationCollection = "_migrations"
+	// migrationLockCollection holds the lock that serializes concurrent runners.
+	migrationLockCollection = "_migrations_lock"
+	// migrationLockId is the _id of the single lock document.
+	migrationLockId = "lock"
+	// defaultMigrationLockTTL is how long a lock is honoured before another runner may take it over.
+	defaultMigrationLockTTL = 10 * time.Minute
+)
+
+// MigrationFunc performs one direction of a migration against the database.
+type MigrationFunc func(ctx context.Context, db *mongo.Database) error
+
+// Migration describes a versioned data migration.
+type Migration struct {
+	// Version orders migrations; it must be unique and positive.
+	Version int64
+	// Name is a short human-readable description.
+	Name string
+	// Up applies the migration.
+	Up MigrationFunc
+	// Down reverts the migration. A nil Down makes the migration irreversible.
+	Down MigrationFunc
+}
+
+// migrationRecord is the document stored in the _migrations collection.
+type migrationRecord struct {
+	Version   int64     `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+// migrations holds all registered migrations for the application.
+var migrations = []*Migration{}
+
+// RegisterMigration adds a migration to the global registry.
+// This is typically called from the init() function of a migrations package.
+// It panics on a non-positive or duplicate version, or a nil up function,
+// since these are programming errors.
+func RegisterMigration(version int64, name string, up, down MigrationFunc) {
+	if version <= 0 {
+		panic(fmt.Sprintf("mgo: migration %q has non-positive version %d", name, version))
+	}
+	if up == nil {
+		panic(fmt.Sprintf("mgo: migration %d (%s) has no up function", version, name))
+	}
+	for _, m := range migrations {
+		if m.Version == version {
+			panic(fmt.Sprintf("mgo: migration version %d registered twice (%s, %s)", version, m.Name, name))
+		}
+	}
+	migrations = append(migrations, &Migration{Version: version, Name: name, Up: up, Down: down})
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+}
+
+// MigrateOption configures a migration run.
+type MigrateOption func(*migrateConfig)
+
+type migrateConfig struct {
+	dryRun      bool
+	transaction bool
+	lockTTL     time.Duration
+	target      int64
+}
+
+// WithMigrationDryRun reports the migrations that would run without executing them
+// or taking the lock.
+func WithMigrationDryRun() MigrateOption {
+	return func(c *migrateConfig) {
+		c.dryRun = true
+	}
+}
+
+// WithMigrationTransaction runs each migration and its bookkeeping in a transaction
+// when the deployment supports it (replica set or sharded cluster).
+// On a standalone server the migrations run without a transaction.
+func WithMigrationTransaction() MigrateOption {
+	return func(c *migrateConfig) {
+		c.transaction = true
+	}
+}
+
+// WithMigrationLockTTL sets how long the migration lock is held before it is
+// considered stale and may be taken over by another runner. A running migration
+// renews the lock every third of the TTL.
+func WithMigrationLockTTL(d time.Duration) MigrateOption {
+	return func(c *migrateConfig) {
+		c.lockTTL = d
+	}
+}
+
+// WithTargetVersion stops Migrate after the given version instead of applying all pending migrations.
+func WithTargetVersion(version int64) MigrateOption {
+	return func(c *migrateConfig) {
+		c.target = version
+	}
+}
+
+func newMigrateConfig(opts []MigrateOption) *migrateConfig {
+	cfg := &migrateConfig{lockTTL: defaultMigrationLockTTL}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Migrate applies all pending registered migrations in version order and records
+// each of them in the _migrations collection. A lock ensures only one replica
+// migrates at a time; other callers get ErrMigrationLocked.
+// It returns the migrations that were applied, or would be applied in dry-run mode.
+func Migrate(ctx context.Context, opts ...MigrateOption) ([]Migration, error) {
+	if dataStore == nil {
+		return nil, ErrNotConnected
+	}
+	cfg := newMigrateConfig(opts)
+	coll, err := dataStore.getCollection(migrationCollection)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMigrationFailed, err)
+	}
+	db := coll.Database()
+
+	return withMigrationLock(ctx, db, cfg, func(ctx context.Context) ([]Migration, error) {
+		applied, err := appliedMigrations(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		plan := pendingMigrations(migrations, applied, cfg.target)
+		if cfg.dryRun {
+			return plan, nil
+		}
+		done := make([]Migration, 0, len(plan))
+		for _, m := range plan {
+			err := runMigration(ctx, db, cfg, m.Up, func(ctx context.Context) error {
+				_, err := db.Collection(migrationCollection).InsertOne(ctx, migrationRecord{
+					Version: m.Version, Name: m.Name, AppliedAt: nowFunc(),
+				})
+				return err
+			})
+			if err != nil {
+				return done, fmt.Errorf("%w: up %d (%s): %w", ErrMigrationFailed, m.Version, m.Name, err)
+			}
+			log.Info("mongodb migration applied", log.Int64("version", m.Version), log.String("name", m.Name))
+			done = append(done, m)
+		}
+		return done, nil
+	})
+}
+
+// Rollback reverts applied migrations with a version greater than the given one,
+// newest first, and removes their records from the _migrations collection.
+// It returns the migrations that were reverted, or would be reverted in dry-run mode.
+func Rollback(ctx context.Context, version int64, opts ...MigrateOption) ([]Migration, error) {
+	if dataStore == nil {
+		return nil, ErrNotConnected
+	}
+	cfg := newMigrateConfig(opts)
+	coll, err := dataStore.getCollection(migrationCollection)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMigrationFailed, err)
+	}
+	db := coll.Database()
+
+	return withMigrationLock(ctx, db, cfg, func(ctx context.Context) ([]Migration, error) {
+		applied, err := appliedMigrations(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		plan, err := rollbackMigrations(migrations, applied, version)
+		if err != nil || cfg.dryRun {
+			return plan, err
+		}
+		done := make([]Migration, 0, len(plan))
+		for _, m := range plan {
+			err := runMigration(ctx, db, cfg, m.Down, func(ctx context.Context) error {
+				_, err := db.Collection(migrationCollection).DeleteOne(ctx, bson.D{{Key: "_id", Value: m.Version}})
+				return err
+			})
+			if err != nil {
+				return done, fmt.Errorf("%w: down %d (%s): %w", ErrMigrationFailed, m.Version, m.Name, err)
+			}
+			log.Info("mongodb migration reverted", log.Int64("version", m.Version), log.String("name", m.Name))
+			done = append(done, m)
+		}
+		return done, nil
+	})
+}
+
+// pendingMigrations returns the registered migrations that are not applied yet,
+// up to and including target (0 means no limit).
+func pendingMigrations(registered []*Migration, applied map[int64]bool, target int64) []Migration {
+	var plan []Migration
+	for _, m := range registered {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if !applied[m.Version] {
+			plan = append(plan, *m)
+		}
+	}
+	return plan
+}
+
+// rollbackMigrations returns the applied migrations newer than version, newest first.
+// It fails if one of them is unknown or irreversible, before anything is reverted.
+func rollbackMigrations(registered []*Migration, applied map[int64]bool, version int64) ([]Migration, error) {
+	byVersion := make(map[int64]*Migration, len(registered))
+	for _, m := range registered {
+		byVersion[m.Version] = m
+	}
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		if v > version {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+	plan := make([]Migration, 0, len(versions))
+	for _, v := range versions {
+		m, ok := byVersion[v]
+		if !ok {
+			return nil, fmt.Errorf("%w: applied migration %d is not registered", ErrMigrationFailed, v)
+		}
+		if m.Down == nil {
+			return nil, fmt.Errorf("%w: migration %d (%s) is irreversible", ErrMigrationFailed, m.Version, m.Name)
+		}
+		plan = append(plan, *m)
+	}
+	return plan, nil
+}
+
+// appliedMigrations loads the versions recorded in the _migrations collection.
+func appliedMigrations(ctx context.Context, db *mongo.Database) (map[int64]bool, error) {
+	cursor, err := db.Collection(migrationCollection).Find(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	var records []migrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	applied := make(map[int64]bool, len(records))
+	for _, r := range records {
+		applied[r.Version] = true
+	}
+	return applied, nil
+}
+
+// runMigration executes step followed by record, inside a transaction if requested and available.
+func runMigration(ctx context.Context, db *mongo.Database, cfg *migrateConfig, step MigrationFunc, record func(ctx context.Context) error) error {
+	run := func(ctx context.Context) error {
+		if err := step(ctx, db); err != nil {
+			return err
+		}
+		return record(ctx)
+	}
+	if cfg.transaction {
+		if supportsTransactions(ctx, db) {
+			return runInTransaction(ctx, db.Client(), run)
+		}
+		log.Warn("mongodb deployment does not support transactions, running migration without one")
+	}
+	return run(ctx)
+}
+
+// withMigrationLock runs fn while holding the migration lock. Dry runs skip the lock.
+// The lock is renewed while fn runs, so migrations may take longer than its TTL; when
+// it cannot be renewed, the context passed to fn is cancelled and the cause returned.
+func withMigrationLock(ctx context.Context, db *mongo.Database, cfg *migrateConfig, fn func(ctx context.Context) ([]Migration, error)) ([]Migration, error) {
+	if cfg.dryRun {
+		return fn(ctx)
+	}
+	owner := migrationLockOwner()
+	if err := acquireMigrationLock(ctx, db, owner, cfg.lockTTL); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_, err := db.Collection(migrationLockCollection).DeleteOne(ctx, bson.D{
+			{Key: "_id", Value: migrationLockId},
+			{Key: "owner", Value: owner},
+		})
+		if err != nil {
+			log.Warn("failed to release mongodb migration lock", log.Err(err))
+		}
+	}()
+
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		keepMigrationLock(lockCtx, db, owner, cfg.lockTTL, stop, cancel)
+	}()
+	done, err := fn(lockCtx)
+	close(stop)
+	<-stopped
+	if cause := context.Cause(lockCtx); cause != nil && ctx.Err() == nil {
+		return done, cause
+	}
+	return done, err
+}
+
+// keepMigrationLock extends the lock every third of its TTL until stop is closed.
+// When the lock cannot be extended, it cancels the migration with the reason.
+func keepMigrationLock(ctx context.Context, db *mongo.Database, owner string, ttl time.Duration, stop <-chan struct{}, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(max(ttl/3, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := renewMigrationLock(ctx, db, owner, ttl); err != nil {
+				log.Error("mongodb migration lock lost, aborting the migration", log.Err(err))
+				cancel(err)
+				return
+			}
+		}
+	}
+}
+
+// renewMigrationLock moves the expiry of the lock held by owner ttl into the future.
+// It returns ErrMigrationLocked when the lock is no longer held by owner.
+func renewMigrationLock(ctx context.Context, db *mongo.Database, owner string, ttl time.Duration) error {
+	result, err := db.Collection(migrationLockCollection).UpdateOne(ctx,
+		bson.D{
+			{Key: "_id", Value: migrationLockId},
+			{Key: "owner", Value: owner},
+		},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "expiresAt", Value: nowFunc().Add(ttl)}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("%w: renewing the lock: %w", ErrMigrationFailed, err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: the lock was taken over by another runner", ErrMigrationLocked)
+	}
+	return nil
+}
+
+// acquireMigrationLock creates the lock document, or takes it over if it has expired.
+// If another runner holds a live lock, the upsert collides on _id and ErrMigrationLocked is returned.
+func acquireMigrationLock(ctx context.Context, db *mongo.Database, owner string, ttl time.Duration) error {
+	now := nowFunc()
+	_, err := db.Collection(migrationLockCollection).UpdateOne(ctx,
+		bson.D{
+			{Key: "_id", Value: migrationLockId},
+			{Key: "expiresAt", Value: bson.D{{Key: "$lt", Value: now}}},
+		},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "owner", Value: owner},
+			{Key: "lockedAt", Value: now},
+			{Key: "expiresAt", Value: now.Add(ttl)},
+		}}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrMigrationLocked
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrWriteFailed, err)
+	}
+	return nil
+}
+
+// migrationLockOwner identifies this process as the holder of the lock.
+func migrationLockOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), bson.NewObjectID().Hex())
+}
@@ -0,0 +1,91 @@
+package mgo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func noopMigration(ctx context.Context, db *mongo.Database) error { return nil }
+
+// withMigrations swaps the global registry for the duration of a test.
+func withMigrations(t *testing.T) {
+	original := migrations
+	migrations = []*Migration{}
+	t.Cleanup(func() { migrations = original })
+}
+
+func TestRegisterMigration(t *testing.T) {
+	t.Run("Sorted by version", func(t *testing.T) {
+		withMigrations(t)
+		RegisterMigration(3, "third", noopMigration, nil)
+		RegisterMigration(1, "first", noopMigration, nil)
+		RegisterMigration(2, "second", noopMigration, nil)
+
+		assert.Equal(t, int64(1), migrations[0].Version)
+		assert.Equal(t, int64(2), migrations[1].Version)
+		assert.Equal(t, int64(3), migrations[2].Version)
+	})
+
+	t.Run("Invalid registrations panic", func(t *testing.T) {
+		withMigrations(t)
+		RegisterMigration(1, "first", noopMigration, nil)
+
+		assert.Panics(t, func() { RegisterMigration(1, "duplicate", noopMigration, nil) })
+		assert.Panics(t, func() { RegisterMigration(0, "zero", noopMigration, nil) })
+		assert.Panics(t, func() { RegisterMigration(2, "no up", nil, nil) })
+	})
+}
+
+func TestPendingMigrations(t *testing.T) {
+	withMigrations(t)
+	RegisterMigration(1, "first", noopMigration, nil)
+	RegisterMigration(2, "second", noopMigration, nil)
+	RegisterMigration(3, "third", noopMigration, nil)
+
+	t.Run("Skips applied", func(t *testing.T) {
+		plan := pendingMigrations(migrations, map[int64]bool{1: true}, 0)
+		assert.Len(t, plan, 2)
+		assert.Equal(t, int64(2), plan[0].Version)
+		assert.Equal(t, int64(3), plan[1].Version)
+	})
+
+	t.Run("Stops at target", func(t *testing.T) {
+		plan := pendingMigrations(migrations, map[int64]bool{}, 2)
+		assert.Len(t, plan, 2)
+		assert.Equal(t, int64(2), plan[1].Version)
+	})
+
+	t.Run("Nothing pending", func(t *testing.T) {
+		plan := pendingMigrations(migrations, map[int64]bool{1: true, 2: true, 3: true}, 0)
+		assert.Empty(t, plan)
+	})
+}
+
+func TestRollbackMigrations(t *testing.T) {
+	withMigrations(t)
+	RegisterMigration(1, "first", noopMigration, noopMigration)
+	RegisterMigration(2, "second", noopMigration, noopMigration)
+	RegisterMigration(3, "third", noopMigration, noopMigration)
+	RegisterMigration(4, "irreversible", noopMigration, nil)
+
+	t.Run("Newest first", func(t *testing.T) {
+		plan, err := rollbackMigrations(migrations, map[int64]bool{1: true, 2: true, 3: true}, 1)
+		assert.NoError(t, err)
+		assert.Len(t, plan, 2)
+		assert.Equal(t, int64(3), plan[0].Version)
+		assert.Equal(t, int64(2), plan[1].Version)
+	})
+
+	t.Run("Irreversible", func(t *testing.T) {
+		_, err := rollbackMigrations(migrations, map[int64]bool{3: true, 4: true}, 2)
+		assert.ErrorIs(t, err, ErrMigrationFailed)
+	})
+
+	t.Run("Unknown applied version", func(t *testing.T) {
+		_, err := rollbackMigrations(migrations, map[int64]bool{9: true}, 0)
+		assert.ErrorIs(t, err, ErrMigrationFailed)
+	})
+}
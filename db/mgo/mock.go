@@ -2,9 +2,8 @@ package mgo
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"reflect"
+	"io"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -31,26 +30,44 @@ func SetDatastore(mock Datastore) (restore func()) {
 // It allows for setting mock functions for each method, making it easy to
 // control the behavior of the datastore in tests.
 type MockDatastore struct {
-	OnSave             func(ctx context.Context, doc DocInter) (DocInter, error)
-	OnFind             func(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error)
-	OnFindOne          func(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult
-	OnUpdateOne        func(ctx context.Context, collection string, filter bson.D, update bson.D) (int64, error)
-	OnUpdateMany       func(ctx context.Context, collection string, filter bson.D, update bson.D) (int64, error)
-	OnDeleteOne        func(ctx context.Context, collection string, filter bson.D) (int64, error)
-	OnDeleteMany       func(ctx context.Context, collection string, filter bson.D) (int64, error)
-	OnPipeFind         func(ctx context.Context, collection string, pipeline mongo.Pipeline) (*mongo.Cursor, error)
-	OnPipeFindOne      func(ctx context.Context, collection string, pipeline mongo.Pipeline) *mongo.SingleResult
-	OnNewBulkOperation func(cname string) BulkOperator
-	OnGetCollection    func(name string) *mongo.Collection
-	OnClose            func(ctx context.Context) error
+	OnSave                   func(ctx context.Context, doc DocInter) (DocInter, error)
+	OnInsertMany             func(ctx context.Context, collection string, docs []DocInter) ([]any, error)
+	OnFind                   func(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error)
+	OnFindOne                func(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult
+	OnCountDocuments         func(ctx context.Context, collection string, filter any, opts ...options.Lister[options.CountOptions]) (int64, error)
+	OnEstimatedDocumentCount func(ctx context.Context, collection string, opts ...options.Lister[options.EstimatedDocumentCountOptions]) (int64, error)
+	OnDistinct               func(ctx context.Context, collection string, field string, filter any, opts ...options.Lister[options.DistinctOptions]) (bson.RawArray, error)
+	OnUpdateOne              func(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error)
+	OnUpdateMany             func(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error)
+	OnDeleteOne              func(ctx context.Context, collection string, filter bson.D) (*WriteResult, error)
+	OnDeleteMany             func(ctx context.Context, collection string, filter bson.D) (*WriteResult, error)
+	OnUpsert                 func(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error)
+	OnReplaceOne             func(ctx context.Context, collection string, filter bson.D, doc DocInter) (*WriteResult, error)
+	OnFindOneAndUpdate       func(ctx context.Context, collection string, filter any, update bson.D, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult
+	OnFindOneAndDelete       func(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOneAndDeleteOptions]) *mongo.SingleResult
+	OnPipeFind               func(ctx context.Context, collection string, pipeline mongo.Pipeline) (*mongo.Cursor, error)
+	OnPipeFindOne            func(ctx context.Context, collection string, pipeline mongo.Pipeline) *mongo.SingleResult
+	OnTransaction            func(ctx context.Context, fn func(ctx context.Context) error) error
+	OnWatch                  func(ctx context.Context, collection string, pipeline mongo.Pipeline, opts ...options.Lister[options.ChangeStreamOptions]) (ChangeStream, error)
+	OnUploadFile             func(ctx context.Context, bucket, name string, source io.Reader, metadata any) (bson.ObjectID, error)
+	OnOpenDownloadStream     func(ctx context.Context, bucket string, fileID any) (FileReader, error)
+	OnDeleteFile             func(ctx context.Context, bucket string, fileID any) error
+	OnFindFiles              func(ctx context.Context, bucket string, filter any) ([]*File, error)
+	OnNewBulkOperation       func(cname string) BulkOperator
+	OnGetCollection          func(name string) *mongo.Collection
+	OnClose                  func(ctx context.Context) error
 }
 
 // MockBulkOperator is a mock implementation of the BulkOperator interface.
 type MockBulkOperator struct {
-	OnInsertOne func(doc DocInter) BulkOperator
-	OnUpdateOne func(filter any, update any) BulkOperator
-	OnExecute   func(ctx context.Context) (*mongo.BulkWriteResult, error)
-	OnDeleteOne func(filter any) BulkOperator
+	OnInsertOne  func(doc DocInter) BulkOperator
+	OnUpdateOne  func(filter any, update any) BulkOperator
+	OnUpdateMany func(filter any, update any) BulkOperator
+	OnUpsert     func(filter any, update any) BulkOperator
+	OnExecute    func(ctx context.Context) (*mongo.BulkWriteResult, error)
+	OnDeleteOne  func(filter any) BulkOperator
+	OnDeleteMany func(filter any) BulkOperator
+	OnReplaceOne func(filter any, replacement DocInter) BulkOperator
 }
 
 // Interface implementations for MockDatastore
@@ -59,6 +76,26 @@ func (m *MockDatastore) Save(ctx context.Context, doc DocInter) (DocInter, error
 	return m.OnSave(ctx, doc)
 }
 
+func (m *MockDatastore) InsertMany(ctx context.Context, collection string, docs []DocInter) ([]any, error) {
+	return m.OnInsertMany(ctx, collection, docs)
+}
+
+func (m *MockDatastore) Upsert(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error) {
+	return m.OnUpsert(ctx, collection, filter, update)
+}
+
+func (m *MockDatastore) ReplaceOne(ctx context.Context, collection string, filter bson.D, doc DocInter) (*WriteResult, error) {
+	return m.OnReplaceOne(ctx, collection, filter, doc)
+}
+
+func (m *MockDatastore) FindOneAndUpdate(ctx context.Context, collection string, filter any, update bson.D, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult {
+	return m.OnFindOneAndUpdate(ctx, collection, filter, update, opts...)
+}
+
+func (m *MockDatastore) FindOneAndDelete(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOneAndDeleteOptions]) *mongo.SingleResult {
+	return m.OnFindOneAndDelete(ctx, collection, filter, opts...)
+}
+
 func (m *MockDatastore) Find(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
 	return m.OnFind(ctx, collection, filter, opts...)
 }
@@ -67,19 +104,31 @@ func (m *MockDatastore) FindOne(ctx context.Context, collection string, filter a
 	return m.OnFindOne(ctx, collection, filter, opts...)
 }
 
-func (m *MockDatastore) UpdateOne(ctx context.Context, collection string, filter bson.D, update bson.D) (int64, error) {
+func (m *MockDatastore) CountDocuments(ctx context.Context, collection string, filter any, opts ...options.Lister[options.CountOptions]) (int64, error) {
+	return m.OnCountDocuments(ctx, collection, filter, opts...)
+}
+
+func (m *MockDatastore) EstimatedDocumentCount(ctx context.Context, collection string, opts ...options.Lister[options.EstimatedDocumentCountOptions]) (int64, error) {
+	return m.OnEstimatedDocumentCount(ctx, collection, opts...)
+}
+
+func (m *MockDatastore) Distinct(ctx context.Context, collection string, field string, filter any, opts ...options.Lister[options.DistinctOptions]) (bson.RawArray, error) {
+	return m.OnDistinct(ctx, collection, field, filter, opts...)
+}
+
+func (m *MockDatastore) UpdateOne(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error) {
 	return m.OnUpdateOne(ctx, collection, filter, update)
 }
 
-func (m *MockDatastore) UpdateMany(ctx context.Context, collection string, filter bson.D, update bson.D) (int64, error) {
+func (m *MockDatastore) UpdateMany(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error) {
 	return m.OnUpdateMany(ctx, collection, filter, update)
 }
 
-func (m *MockDatastore) DeleteOne(ctx context.Context, collection string, filter bson.D) (int64, error) {
+func (m *MockDatastore) DeleteOne(ctx context.Context, collection string, filter bson.D) (*WriteResult, error) {
 	return m.OnDeleteOne(ctx, collection, filter)
 }
 
-func (m *MockDatastore) DeleteMany(ctx context.Context, collection string, filter bson.D) (int64, error) {
+func (m *MockDatastore) DeleteMany(ctx context.Context, collection string, filter bson.D) (*WriteResult, error) {
 	return m.OnDeleteMany(ctx, collection, filter)
 }
 
@@ -91,12 +140,45 @@ func (m *MockDatastore) PipeFindOne(ctx context.Context, collection string, pipe
 	return m.OnPipeFindOne(ctx, collection, pipeline)
 }
 
-func (m *MockDatastore) NewBulkOperation(cname string) BulkOperator {
+func (m *MockDatastore) Watch(ctx context.Context, collection string, pipeline mongo.Pipeline, opts ...options.Lister[options.ChangeStreamOptions]) (ChangeStream, error) {
+	return m.OnWatch(ctx, collection, pipeline, opts...)
+}
+
+func (m *MockDatastore) UploadFile(ctx context.Context, bucket, name string, source io.Reader, metadata any) (bson.ObjectID, error) {
+	return m.OnUploadFile(ctx, bucket, name, source, metadata)
+}
+
+func (m *MockDatastore) OpenDownloadStream(ctx context.Context, bucket string, fileID any) (FileReader, error) {
+	return m.OnOpenDownloadStream(ctx, bucket, fileID)
+}
+
+func (m *MockDatastore) DeleteFile(ctx context.Context, bucket string, fileID any) error {
+	return m.OnDeleteFile(ctx, bucket, fileID)
+}
+
+func (m *MockDatastore) FindFiles(ctx context.Context, bucket string, filter any) ([]*File, error) {
+	return m.OnFindFiles(ctx, bucket, filter)
+}
+
+// Transaction calls OnTransaction, or simply runs fn when OnTransaction is not set.
+func (m *MockDatastore) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if m.OnTransaction == nil {
+		return fn(ctx)
+	}
+	return m.OnTransaction(ctx, fn)
+}
+
+func (m *MockDatastore) NewBulkOperation(cname string, opts ...BulkOption) BulkOperator {
 	return m.OnNewBulkOperation(cname)
 }
 
-func (m *MockDatastore) getCollection(name string) *mongo.Collection {
-	return m.OnGetCollection(name)
+func (m *MockDatastore) getCollection(name string) (*mongo.Collection, error) {
+	return m.OnGetCollection(name), nil
+}
+
+// database returns the mock itself, so that per-tenant databases share its handlers.
+func (m *MockDatastore) database(name string) Datastore {
+	return m
 }
 
 func (m *MockDatastore) close(ctx context.Context) error {
@@ -117,6 +199,14 @@ func (m *MockBulkOperator) UpdateById(id any, update any) BulkOperator {
 	return m.OnUpdateOne(bson.M{"_id": id}, update)
 }
 
+func (m *MockBulkOperator) UpdateMany(filter any, update any) BulkOperator {
+	return m.OnUpdateMany(filter, update)
+}
+
+func (m *MockBulkOperator) Upsert(filter any, update any) BulkOperator {
+	return m.OnUpsert(filter, update)
+}
+
 func (m *MockBulkOperator) DeleteOne(filter any) BulkOperator {
 	return m.OnDeleteOne(filter)
 }
@@ -125,6 +215,14 @@ func (m *MockBulkOperator) DeleteById(id any) BulkOperator {
 	return m.OnDeleteOne(bson.M{"_id": id})
 }
 
+func (m *MockBulkOperator) DeleteMany(filter any) BulkOperator {
+	return m.OnDeleteMany(filter)
+}
+
+func (m *MockBulkOperator) ReplaceOne(filter any, replacement DocInter) BulkOperator {
+	return m.OnReplaceOne(filter, replacement)
+}
+
 func (m *MockBulkOperator) Execute(ctx context.Context) (*mongo.BulkWriteResult, error) {
 	return m.OnExecute(ctx)
 }
@@ -168,18 +266,29 @@ func NewErrOnFindOne(err error) func(ctx context.Context, collection string, fil
 // It assigns a new ObjectID to the document and returns it.
 func NewOnSaveMock() func(ctx context.Context, doc DocInter) (DocInter, error) {
 	return func(ctx context.Context, doc DocInter) (DocInter, error) {
-		// 1. Restore the nil check for robustness.
-		if v := reflect.ValueOf(doc); v.Kind() == reflect.Ptr && v.IsNil() {
-			return nil, fmt.Errorf("%w: %w", ErrInvalidDocument, errors.New("document cannot be nil"))
-		}
-		if err := doc.Validate(); err != nil {
-			return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+		if err := checkNilDoc(doc); err != nil {
+			return nil, err
 		}
 		doc.SetId(bson.NewObjectID())
 		return doc, nil
 	}
 }
 
+// NewOnInsertManyMock returns an OnInsertMany function that simulates a successful insert.
+// It rejects nil documents like the real datastore and returns a new ObjectID for each.
+func NewOnInsertManyMock() func(ctx context.Context, collection string, docs []DocInter) ([]any, error) {
+	return func(ctx context.Context, collection string, docs []DocInter) ([]any, error) {
+		ids := make([]any, len(docs))
+		for i, doc := range docs {
+			if err := checkNilDoc(doc); err != nil {
+				return nil, fmt.Errorf("document %d: %w", i, err)
+			}
+			ids[i] = bson.NewObjectID()
+		}
+		return ids, nil
+	}
+}
+
 // NewOnPipeFindMock returns an OnPipeFind function that returns a cursor with the given fake data.
 func NewOnPipeFindMock(fakeData ...any) func(ctx context.Context, collection string, pipeline mongo.Pipeline) (*mongo.Cursor, error) {
 	return func(ctx context.Context, collection string, pipeline mongo.Pipeline) (*mongo.Cursor, error) {
@@ -188,6 +297,52 @@ func NewOnPipeFindMock(fakeData ...any) func(ctx context.Context, collection str
 	}
 }
 
+// NewOnWatchMock returns an OnWatch function that returns a change stream delivering the given fake events.
+// Each event's _id is used as its resume token.
+func NewOnWatchMock(fakeEvents ...any) func(ctx context.Context, collection string, pipeline mongo.Pipeline, opts ...options.Lister[options.ChangeStreamOptions]) (ChangeStream, error) {
+	return func(ctx context.Context, collection string, pipeline mongo.Pipeline, opts ...options.Lister[options.ChangeStreamOptions]) (ChangeStream, error) {
+		cursor, err := mongo.NewCursorFromDocuments(fakeEvents, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &cursorChangeStream{Cursor: cursor}, nil
+	}
+}
+
+// cursorChangeStream adapts a cursor of events to the ChangeStream interface.
+type cursorChangeStream struct {
+	*mongo.Cursor
+}
+
+func (c *cursorChangeStream) ResumeToken() bson.Raw {
+	id, err := c.Current.LookupErr("_id")
+	if err != nil {
+		return nil
+	}
+	doc, ok := id.DocumentOK()
+	if !ok {
+		return nil
+	}
+	return doc
+}
+
+// NewOnDistinctMock returns an OnDistinct function that returns the given values.
+func NewOnDistinctMock(values ...any) func(ctx context.Context, collection string, field string, filter any, opts ...options.Lister[options.DistinctOptions]) (bson.RawArray, error) {
+	return func(ctx context.Context, collection string, field string, filter any, opts ...options.Lister[options.DistinctOptions]) (bson.RawArray, error) {
+		return rawArray(values)
+	}
+}
+
+// NewOnOpenDownloadStreamMock returns an OnOpenDownloadStream function that serves content
+// as the given file. The file's Length is set to the length of content.
+func NewOnOpenDownloadStreamMock(file File, content []byte) func(ctx context.Context, bucket string, fileID any) (FileReader, error) {
+	return func(ctx context.Context, bucket string, fileID any) (FileReader, error) {
+		f := file
+		f.Length = int64(len(content))
+		return newBytesFileReader(&f, content), nil
+	}
+}
+
 // NewOnBulkOperationMock returns an OnNewBulkOperation function that creates a mock BulkOperator.
 // The mock BulkOperator's chainable methods are pre-configured to return itself,
 // and its Execute method is set to return the provided result and error.
@@ -199,6 +354,11 @@ func NewOnBulkOperationMock(result *mongo.BulkWriteResult, err error) func(cname
 		// Make chainable methods return the mock operator itself
 		mockOp.OnInsertOne = func(doc DocInter) BulkOperator { return mockOp }
 		mockOp.OnUpdateOne = func(filter any, update any) BulkOperator { return mockOp }
+		mockOp.OnUpdateMany = func(filter any, update any) BulkOperator { return mockOp }
+		mockOp.OnUpsert = func(filter any, update any) BulkOperator { return mockOp }
+		mockOp.OnDeleteOne = func(filter any) BulkOperator { return mockOp }
+		mockOp.OnDeleteMany = func(filter any) BulkOperator { return mockOp }
+		mockOp.OnReplaceOne = func(filter any, replacement DocInter) BulkOperator { return mockOp }
 
 		// Set the final return value for the Execute method
 		mockOp.OnExecute = func(ctx context.Context) (*mongo.BulkWriteResult, error) {
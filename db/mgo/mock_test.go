@@ -179,3 +179,13 @@ func TestNewOnBulkOperationMock(t *testing.T) {
 		assert.Equal(t, expectedErr, err)
 	})
 }
+
+func TestNewOnDistinctMock(t *testing.T) {
+	mockDB := &MockDatastore{OnDistinct: NewOnDistinctMock("TW", "JP")}
+	restore := SetDatastore(mockDB)
+	defer restore()
+
+	countries, err := Distinct[*testUser, string](context.Background(), &testUser{}, "country", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"TW", "JP"}, countries)
+}
@@ -0,0 +1,276 @@
+package mgo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/arwoosa/vulpes/ezgrpc/interceptor"
+	"github.com/arwoosa/vulpes/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// redactedValue replaces literal values in logged commands when redaction is enabled.
+const redactedValue = "?"
+
+// commandNoise lists command fields that are left out of the slow command log.
+var commandNoise = map[string]bool{
+	"lsid": true, "$clusterTime": true, "txnNumber": true, "$db": true,
+	"$readPreference": true, "autocommit": true, "startTransaction": true,
+}
+
+// MonitorOption configures the monitoring installed by WithMonitoring.
+type MonitorOption func(*monitor)
+
+// WithSlowCommandThreshold logs every command that takes at least d. Zero disables the log.
+// The default is 100ms.
+func WithSlowCommandThreshold(d time.Duration) MonitorOption {
+	return func(m *monitor) {
+		m.slowThreshold = d
+	}
+}
+
+// WithRedactedCommands replaces all literal values, such as filter values and
+// inserted fields, with "?" in the slow command log.
+func WithRedactedCommands() MonitorOption {
+	return func(m *monitor) {
+		m.redact = true
+	}
+}
+
+// WithMetricsRegisterer registers the metrics with reg instead of prometheus.DefaultRegisterer.
+func WithMetricsRegisterer(reg prometheus.Registerer) MonitorOption {
+	return func(m *monitor) {
+		m.registerer = reg
+	}
+}
+
+// WithMonitoring installs a command monitor and a pool monitor on the client. It exports
+// these Prometheus metrics:
+//
+//   - mongodb_command_duration_seconds: histogram per collection and command
+//   - mongodb_command_errors_total: failed commands per collection and command
+//   - mongodb_pool_connections: open connections per server
+//   - mongodb_pool_connections_in_use: checked out connections per server
+//   - mongodb_pool_checkout_failures_total: failed checkouts per server and reason
+//
+// Commands slower than the threshold are logged with the request ID of the context:
+//
+//	err := mgo.InitConnection(ctx, "app",
+//		mgo.WithURI(uri),
+//		mgo.WithMonitoring(mgo.WithSlowCommandThreshold(200*time.Millisecond), mgo.WithRedactedCommands()),
+//	)
+func WithMonitoring(opts ...MonitorOption) Option {
+	m := newMonitor(opts...)
+	return func(o *options.ClientOptions) {
+		o.SetMonitor(m.commandMonitor())
+		o.SetPoolMonitor(m.poolMonitor())
+	}
+}
+
+// monitor turns driver events into metrics and slow command logs.
+type monitor struct {
+	slowThreshold time.Duration
+	redact        bool
+	registerer    prometheus.Registerer
+
+	duration        *prometheus.HistogramVec
+	errors          *prometheus.CounterVec
+	connections     *prometheus.GaugeVec
+	inUse           *prometheus.GaugeVec
+	checkoutFailure *prometheus.CounterVec
+
+	// inflight maps the request ID of started commands to their details.
+	inflight sync.Map
+}
+
+// startedCommand is remembered between the started and finished events of a command.
+type startedCommand struct {
+	collection string
+	requestID  string
+	command    bson.Raw
+}
+
+func newMonitor(opts ...MonitorOption) *monitor {
+	m := &monitor{
+		slowThreshold: 100 * time.Millisecond,
+		registerer:    prometheus.DefaultRegisterer,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.duration = registerCollector(m.registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongodb_command_duration_seconds",
+		Help:    "Duration of MongoDB commands.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"collection", "command"}))
+	m.errors = registerCollector(m.registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongodb_command_errors_total",
+		Help: "Number of failed MongoDB commands.",
+	}, []string{"collection", "command"}))
+	m.connections = registerCollector(m.registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_pool_connections",
+		Help: "Number of open connections in the MongoDB connection pool.",
+	}, []string{"address"}))
+	m.inUse = registerCollector(m.registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_pool_connections_in_use",
+		Help: "Number of connections checked out of the MongoDB connection pool.",
+	}, []string{"address"}))
+	m.checkoutFailure = registerCollector(m.registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongodb_pool_checkout_failures_total",
+		Help: "Number of failed connection checkouts from the MongoDB connection pool.",
+	}, []string{"address", "reason"}))
+	return m
+}
+
+// registerCollector registers c, or returns the collector already registered under the
+// same name so that several clients share the metrics.
+func registerCollector[T prometheus.Collector](reg prometheus.Registerer, c T) T {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(T); ok {
+				return existing
+			}
+		}
+		log.Warn("mongodb monitoring: failed to register metric", log.Err(err))
+	}
+	return c
+}
+
+func (m *monitor) commandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: m.started,
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			m.finished(e.CommandFinishedEvent, nil)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			m.finished(e.CommandFinishedEvent, e.Failure)
+		},
+	}
+}
+
+func (m *monitor) started(ctx context.Context, e *event.CommandStartedEvent) {
+	sc := startedCommand{
+		collection: commandCollection(e.CommandName, e.Command),
+		requestID:  interceptor.GetRequestID(ctx),
+	}
+	if m.slowThreshold > 0 {
+		// The driver reuses the buffer after the event, keep a copy for the slow command log.
+		sc.command = append(bson.Raw(nil), e.Command...)
+	}
+	m.inflight.Store(e.RequestID, sc)
+}
+
+func (m *monitor) finished(e event.CommandFinishedEvent, failure error) {
+	v, ok := m.inflight.LoadAndDelete(e.RequestID)
+	if !ok {
+		return
+	}
+	sc := v.(startedCommand)
+	m.duration.WithLabelValues(sc.collection, e.CommandName).Observe(e.Duration.Seconds())
+	if failure != nil {
+		m.errors.WithLabelValues(sc.collection, e.CommandName).Inc()
+	}
+	if m.slowThreshold <= 0 || e.Duration < m.slowThreshold {
+		return
+	}
+	fields := []log.Field{
+		log.String("command", e.CommandName),
+		log.String("database", e.DatabaseName),
+		log.String("collection", sc.collection),
+		log.Duration("duration", e.Duration),
+		log.String("request_id", sc.requestID),
+		log.String("query", m.formatCommand(sc.command)),
+	}
+	if failure != nil {
+		fields = append(fields, log.Err(failure))
+	}
+	log.Warn("mongodb slow command", fields...)
+}
+
+// formatCommand renders a command as extended JSON without session fields,
+// redacting literal values when configured.
+func (m *monitor) formatCommand(command bson.Raw) string {
+	var doc bson.D
+	if err := bson.Unmarshal(command, &doc); err != nil {
+		return ""
+	}
+	out := make(bson.D, 0, len(doc))
+	for i, e := range doc {
+		if commandNoise[e.Key] {
+			continue
+		}
+		// The first element names the command and its collection; keep it readable.
+		if m.redact && i > 0 {
+			e.Value = redactValue(e.Value)
+		}
+		out = append(out, e)
+	}
+	b, err := bson.MarshalExtJSON(out, false, false)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// redactValue replaces every literal in v with "?", keeping document keys and
+// operators so the shape of the query stays visible.
+func redactValue(v any) any {
+	switch x := v.(type) {
+	case bson.D:
+		out := make(bson.D, len(x))
+		for i, e := range x {
+			out[i] = bson.E{Key: e.Key, Value: redactValue(e.Value)}
+		}
+		return out
+	case bson.A:
+		out := make(bson.A, len(x))
+		for i, item := range x {
+			out[i] = redactValue(item)
+		}
+		return out
+	default:
+		return redactedValue
+	}
+}
+
+// commandCollection returns the collection a command targets, or "" for database-level commands.
+func commandCollection(name string, command bson.Raw) string {
+	if name == "getMore" {
+		if c, ok := command.Lookup("collection").StringValueOK(); ok {
+			return c
+		}
+		return ""
+	}
+	elems, err := command.Elements()
+	if err != nil || len(elems) == 0 {
+		return ""
+	}
+	c, _ := elems[0].Value().StringValueOK()
+	return c
+}
+
+func (m *monitor) poolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				m.connections.WithLabelValues(e.Address).Inc()
+			case event.ConnectionClosed:
+				m.connections.WithLabelValues(e.Address).Dec()
+			case event.ConnectionCheckedOut:
+				m.inUse.WithLabelValues(e.Address).Inc()
+			case event.ConnectionCheckedIn:
+				m.inUse.WithLabelValues(e.Address).Dec()
+			case event.ConnectionCheckOutFailed:
+				m.checkoutFailure.WithLabelValues(e.Address, e.Reason).Inc()
+			}
+		},
+	}
+}
@@ -0,0 +1,93 @@
+package mgo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+func TestCommandMonitor(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := newMonitor(WithMetricsRegisterer(reg), WithSlowCommandThreshold(time.Second))
+	cm := m.commandMonitor()
+	ctx := context.Background()
+
+	run := func(id int64, name string, command bson.D, d time.Duration, failure error) {
+		raw, err := bson.Marshal(command)
+		assert.NoError(t, err)
+		cm.Started(ctx, &event.CommandStartedEvent{Command: raw, CommandName: name, DatabaseName: "app", RequestID: id})
+		finished := event.CommandFinishedEvent{CommandName: name, DatabaseName: "app", RequestID: id, Duration: d}
+		if failure != nil {
+			cm.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: finished, Failure: failure})
+			return
+		}
+		cm.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: finished})
+	}
+
+	run(1, "find", bson.D{{Key: "find", Value: "users"}}, 10*time.Millisecond, nil)
+	run(2, "find", bson.D{{Key: "find", Value: "users"}}, 2*time.Second, nil)
+	run(3, "insert", bson.D{{Key: "insert", Value: "users"}}, time.Millisecond, errors.New("duplicate"))
+	run(4, "getMore", bson.D{{Key: "getMore", Value: int64(42)}, {Key: "collection", Value: "orders"}}, time.Millisecond, nil)
+
+	assert.Equal(t, 3, testutil.CollectAndCount(m.duration))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.errors.WithLabelValues("users", "insert")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.errors.WithLabelValues("users", "find")))
+	assert.NoError(t, testutil.CollectAndCompare(m.duration, strings.NewReader(`
+# HELP mongodb_command_duration_seconds Duration of MongoDB commands.
+# TYPE mongodb_command_duration_seconds histogram
+mongodb_command_duration_seconds_count{collection="orders",command="getMore"} 1
+mongodb_command_duration_seconds_count{collection="users",command="find"} 2
+mongodb_command_duration_seconds_count{collection="users",command="insert"} 1
+`), "mongodb_command_duration_seconds_count"))
+
+	_, pending := m.inflight.Load(int64(1))
+	assert.False(t, pending, "finished commands are forgotten")
+
+	t.Run("Shares metrics between clients", func(t *testing.T) {
+		other := newMonitor(WithMetricsRegisterer(reg))
+		assert.Same(t, m.duration, other.duration)
+	})
+}
+
+func TestPoolMonitor(t *testing.T) {
+	m := newMonitor(WithMetricsRegisterer(prometheus.NewRegistry()))
+	pm := m.poolMonitor()
+	for _, typ := range []string{event.ConnectionCreated, event.ConnectionCreated, event.ConnectionCheckedOut, event.ConnectionCheckedOut, event.ConnectionCheckedIn, event.ConnectionClosed} {
+		pm.Event(&event.PoolEvent{Type: typ, Address: "db:27017"})
+	}
+	pm.Event(&event.PoolEvent{Type: event.ConnectionCheckOutFailed, Address: "db:27017", Reason: event.ReasonTimedOut})
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.connections.WithLabelValues("db:27017")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.inUse.WithLabelValues("db:27017")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.checkoutFailure.WithLabelValues("db:27017", event.ReasonTimedOut)))
+}
+
+func TestFormatCommand(t *testing.T) {
+	raw, err := bson.Marshal(bson.D{
+		{Key: "find", Value: "users"},
+		{Key: "filter", Value: bson.D{
+			{Key: "email", Value: "a@example.com"},
+			{Key: "age", Value: bson.D{{Key: "$in", Value: bson.A{18, 21}}}},
+		}},
+		{Key: "limit", Value: int64(1)},
+		{Key: "lsid", Value: bson.D{{Key: "id", Value: "session"}}},
+		{Key: "$db", Value: "app"},
+	})
+	assert.NoError(t, err)
+
+	plain := newMonitor(WithMetricsRegisterer(prometheus.NewRegistry()))
+	assert.JSONEq(t, `{"find":"users","filter":{"email":"a@example.com","age":{"$in":[18,21]}},"limit":1}`,
+		plain.formatCommand(raw))
+
+	redacted := newMonitor(WithMetricsRegisterer(prometheus.NewRegistry()), WithRedactedCommands())
+	assert.JSONEq(t, `{"find":"users","filter":{"email":"?","age":{"$in":["?","?"]}},"limit":"?"}`,
+		redacted.formatCommand(raw))
+}
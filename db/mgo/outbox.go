@@ -0,0 +1,297 @@
+package mgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arwoosa/vulpes/log"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const outboxCollection = "_outbox"
+
+// Outbox message states.
+const (
+	OutboxPending    = "pending"
+	OutboxProcessing = "processing"
+	OutboxSent       = "sent"
+	OutboxFailed     = "failed"
+)
+
+// OutboxMessage is an event waiting to be published by an OutboxRelay.
+// Register its indexes with mgo.RegisterIndex(&mgo.OutboxMessage{}).
+type OutboxMessage struct {
+	ID            bson.ObjectID `bson:"_id,omitempty"`
+	Timestamps    `bson:",inline"`
+	Topic         string     `bson:"topic"`
+	Payload       string     `bson:"payload"`
+	Status        string     `bson:"status"`
+	Attempts      int        `bson:"attempts"`
+	NextAttemptAt time.Time  `bson:"nextAttemptAt"`
+	LastError     string     `bson:"lastError,omitempty"`
+	SentAt        *time.Time `bson:"sentAt,omitempty"`
+}
+
+func (o *OutboxMessage) C() string { return outboxCollection }
+
+func (o *OutboxMessage) Indexes() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+	}
+}
+
+func (o *OutboxMessage) Validate() error {
+	if o.Topic == "" {
+		return errors.New("outbox topic is required")
+	}
+	return nil
+}
+
+func (o *OutboxMessage) GetId() any { return o.ID }
+
+func (o *OutboxMessage) SetId(id any) {
+	if oid, ok := id.(bson.ObjectID); ok {
+		o.ID = oid
+	}
+}
+
+// AddOutbox records an event to be published to topic. Call it with the context of
+// WithTransaction so that the event is stored if, and only if, the business write commits.
+func AddOutbox(ctx context.Context, topic, payload string) error {
+	now := nowFunc()
+	_, err := Save(ctx, &OutboxMessage{
+		Topic:         topic,
+		Payload:       payload,
+		Status:        OutboxPending,
+		NextAttemptAt: now,
+	})
+	return err
+}
+
+// PublishFunc delivers an outbox message. It must only return nil once the broker has
+// accepted the message, e.g. rabbitmq.SendConfirm.
+type PublishFunc func(ctx context.Context, topic, payload string) error
+
+// OutboxOption configures an OutboxRelay.
+type OutboxOption func(*OutboxRelay)
+
+// WithOutboxPollInterval sets how often the relay looks for due messages. Defaults to one second.
+func WithOutboxPollInterval(d time.Duration) OutboxOption {
+	return func(r *OutboxRelay) {
+		r.interval = d
+	}
+}
+
+// WithOutboxBatchSize sets how many messages are read per poll. Defaults to 100.
+func WithOutboxBatchSize(n int64) OutboxOption {
+	return func(r *OutboxRelay) {
+		r.batchSize = n
+	}
+}
+
+// WithOutboxMaxAttempts sets how many times a message is tried before it is marked failed.
+// Zero, the default, retries forever.
+func WithOutboxMaxAttempts(n int) OutboxOption {
+	return func(r *OutboxRelay) {
+		r.maxAttempts = n
+	}
+}
+
+// WithOutboxBackoff sets the delay before the first retry, doubled on each further attempt up to max.
+// Defaults to one second and five minutes.
+func WithOutboxBackoff(base, max time.Duration) OutboxOption {
+	return func(r *OutboxRelay) {
+		r.backoffBase = base
+		r.backoffMax = max
+	}
+}
+
+// WithOutboxLease sets how long a claimed message is reserved for one relay. A message whose
+// relay died while publishing becomes due again after the lease. Defaults to 30 seconds.
+func WithOutboxLease(d time.Duration) OutboxOption {
+	return func(r *OutboxRelay) {
+		r.lease = d
+	}
+}
+
+// WithOutboxChangeStream wakes the relay as soon as a message is inserted instead of waiting
+// for the next poll. Polling continues as a fallback. It requires a replica set.
+func WithOutboxChangeStream() OutboxOption {
+	return func(r *OutboxRelay) {
+		r.watch = true
+	}
+}
+
+// OutboxRelay publishes outbox messages and marks them as sent. Several relays may run
+// concurrently; each message is claimed by one of them. Delivery is at least once, so
+// consumers must tolerate duplicates.
+type OutboxRelay struct {
+	publish     PublishFunc
+	interval    time.Duration
+	batchSize   int64
+	maxAttempts int
+	backoffBase time.Duration
+	backoffMax  time.Duration
+	lease       time.Duration
+	watch       bool
+}
+
+// NewOutboxRelay creates a relay that delivers messages through publish.
+func NewOutboxRelay(publish PublishFunc, opts ...OutboxOption) *OutboxRelay {
+	r := &OutboxRelay{
+		publish:     publish,
+		interval:    time.Second,
+		batchSize:   100,
+		backoffBase: time.Second,
+		backoffMax:  5 * time.Minute,
+		lease:       30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run relays messages until ctx is cancelled, then returns nil.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	if dataStore == nil {
+		return ErrNotConnected
+	}
+	wake := make(chan struct{}, 1)
+	if r.watch {
+		go r.watchInserts(ctx, wake)
+	}
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := r.Process(ctx)
+			if err != nil {
+				log.Warn("outbox relay failed", log.Err(err))
+				break
+			}
+			if int64(n) < r.batchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// Process claims and publishes one batch of due messages and returns how many it handled.
+func (r *OutboxRelay) Process(ctx context.Context) (int, error) {
+	if dataStore == nil {
+		return 0, ErrNotConnected
+	}
+	now := nowFunc()
+	filter := bson.D{
+		{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{OutboxPending, OutboxProcessing}}}},
+		{Key: "nextAttemptAt", Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).SetLimit(r.batchSize)
+	cursor, err := dataStore.Find(ctx, outboxCollection, filter, opts)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	var due []*OutboxMessage
+	if err := cursor.All(ctx, &due); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+
+	handled := 0
+	for _, msg := range due {
+		claimed, err := r.claim(ctx, msg, now)
+		if err != nil {
+			return handled, err
+		}
+		if !claimed {
+			continue
+		}
+		if err := r.deliver(ctx, msg); err != nil {
+			return handled, err
+		}
+		handled++
+	}
+	return handled, nil
+}
+
+// claim reserves msg for this relay. The filter on the state read by Process makes the
+// update fail when another relay claimed the message first.
+func (r *OutboxRelay) claim(ctx context.Context, msg *OutboxMessage, now time.Time) (bool, error) {
+	filter := bson.D{
+		{Key: "_id", Value: msg.ID},
+		{Key: "status", Value: msg.Status},
+		{Key: "attempts", Value: msg.Attempts},
+	}
+	msg.Attempts++
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: OutboxProcessing},
+		{Key: "attempts", Value: msg.Attempts},
+		{Key: "nextAttemptAt", Value: now.Add(r.lease)},
+	}}}
+	result, err := dataStore.UpdateOne(ctx, outboxCollection, filter, stampUpdate(msg, update, now))
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrWriteFailed, err)
+	}
+	return result != nil && result.MatchedCount > 0, nil
+}
+
+// deliver publishes msg and records the outcome.
+func (r *OutboxRelay) deliver(ctx context.Context, msg *OutboxMessage) error {
+	var set bson.D
+	publishErr := r.publish(ctx, msg.Topic, msg.Payload)
+	now := nowFunc()
+	switch {
+	case publishErr == nil:
+		set = bson.D{{Key: "status", Value: OutboxSent}, {Key: "sentAt", Value: now}}
+	case r.maxAttempts > 0 && msg.Attempts >= r.maxAttempts:
+		log.Warn("outbox message failed permanently",
+			log.String("id", msg.ID.Hex()), log.String("topic", msg.Topic), log.Err(publishErr))
+		set = bson.D{{Key: "status", Value: OutboxFailed}, {Key: "lastError", Value: publishErr.Error()}}
+	default:
+		set = bson.D{
+			{Key: "status", Value: OutboxPending},
+			{Key: "nextAttemptAt", Value: now.Add(r.backoff(msg.Attempts))},
+			{Key: "lastError", Value: publishErr.Error()},
+		}
+	}
+	update := stampUpdate(msg, bson.D{{Key: "$set", Value: set}}, now)
+	if _, err := dataStore.UpdateOne(ctx, outboxCollection, bson.D{{Key: "_id", Value: msg.ID}}, update); err != nil {
+		return fmt.Errorf("%w: %w", ErrWriteFailed, err)
+	}
+	return nil
+}
+
+// backoff returns the retry delay after the given number of attempts.
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	d := r.backoffBase
+	for i := 1; i < attempts && d < r.backoffMax; i++ {
+		d *= 2
+	}
+	return min(d, r.backoffMax)
+}
+
+// watchInserts signals wake for every inserted outbox message until ctx is cancelled.
+func (r *OutboxRelay) watchInserts(ctx context.Context, wake chan<- struct{}) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "operationType", Value: OperationInsert}}}}}
+	err := Watch(ctx, outboxCollection, func(ctx context.Context, _ ChangeEvent[bson.Raw]) error {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+		return nil
+	}, WithWatchPipeline(pipeline))
+	if err != nil {
+		log.Warn("outbox change stream stopped, falling back to polling", log.Err(err))
+	}
+}
@@ -0,0 +1,169 @@
+package mgo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// setField returns the value of key in the $set document of update.
+func setField(update bson.D, key string) any {
+	for _, op := range update {
+		if op.Key != "$set" {
+			continue
+		}
+		for _, e := range op.Value.(bson.D) {
+			if e.Key == key {
+				return e.Value
+			}
+		}
+	}
+	return nil
+}
+
+func TestAddOutbox(t *testing.T) {
+	var saved *mgo.OutboxMessage
+	inTransaction := false
+	mockDB := &mgo.MockDatastore{
+		OnTransaction: func(ctx context.Context, fn func(ctx context.Context) error) error {
+			inTransaction = true
+			defer func() { inTransaction = false }()
+			return fn(ctx)
+		},
+		OnSave: func(ctx context.Context, doc mgo.DocInter) (mgo.DocInter, error) {
+			assert.True(t, inTransaction)
+			saved = doc.(*mgo.OutboxMessage)
+			return mgo.NewOnSaveMock()(ctx, doc)
+		},
+	}
+	restore := mgo.SetDatastore(mockDB)
+	defer restore()
+
+	err := mgo.WithTransaction(context.Background(), func(ctx context.Context) error {
+		return mgo.AddOutbox(ctx, "user.created", `{"id":"1"}`)
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "user.created", saved.Topic)
+	assert.Equal(t, mgo.OutboxPending, saved.Status)
+	assert.False(t, saved.CreatedAt.IsZero())
+}
+
+func TestWithTransactionPassesThroughErrors(t *testing.T) {
+	restore := mgo.SetDatastore(&mgo.MockDatastore{})
+	defer restore()
+
+	errBusiness := errors.New("insufficient balance")
+	err := mgo.WithTransaction(context.Background(), func(ctx context.Context) error { return errBusiness })
+	assert.Equal(t, errBusiness, err)
+}
+
+func TestOutboxRelayProcess(t *testing.T) {
+	pending := func() *mgo.OutboxMessage {
+		return &mgo.OutboxMessage{ID: bson.NewObjectID(), Topic: "user.created", Payload: "{}", Status: mgo.OutboxPending}
+	}
+
+	t.Run("Publishes and marks sent", func(t *testing.T) {
+		var updates []bson.D
+		mockDB := &mgo.MockDatastore{
+			OnFind: mgo.NewOnFindMock(pending()),
+			OnUpdateOne: func(ctx context.Context, collection string, filter bson.D, update bson.D) (*mgo.WriteResult, error) {
+				updates = append(updates, update)
+				return &mgo.WriteResult{MatchedCount: 1, ModifiedCount: 1}, nil
+			},
+		}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		var published []string
+		relay := mgo.NewOutboxRelay(func(ctx context.Context, topic, payload string) error {
+			published = append(published, topic)
+			return nil
+		})
+		n, err := relay.Process(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []string{"user.created"}, published)
+		assert.Len(t, updates, 2)
+		assert.Equal(t, mgo.OutboxProcessing, setField(updates[0], "status"))
+		assert.Equal(t, 1, setField(updates[0], "attempts"))
+		assert.Equal(t, mgo.OutboxSent, setField(updates[1], "status"))
+	})
+
+	t.Run("Skips messages claimed by another relay", func(t *testing.T) {
+		mockDB := &mgo.MockDatastore{
+			OnFind: mgo.NewOnFindMock(pending()),
+			OnUpdateOne: func(ctx context.Context, collection string, filter bson.D, update bson.D) (*mgo.WriteResult, error) {
+				return &mgo.WriteResult{}, nil
+			},
+		}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		relay := mgo.NewOutboxRelay(func(ctx context.Context, topic, payload string) error {
+			t.Fatal("claimed message must not be published")
+			return nil
+		})
+		n, err := relay.Process(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("Schedules a retry with backoff", func(t *testing.T) {
+		msg := pending()
+		msg.Attempts = 2
+		var last bson.D
+		mockDB := &mgo.MockDatastore{
+			OnFind: mgo.NewOnFindMock(msg),
+			OnUpdateOne: func(ctx context.Context, collection string, filter bson.D, update bson.D) (*mgo.WriteResult, error) {
+				last = update
+				return &mgo.WriteResult{MatchedCount: 1, ModifiedCount: 1}, nil
+			},
+		}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		before := time.Now()
+		relay := mgo.NewOutboxRelay(func(ctx context.Context, topic, payload string) error {
+			return errors.New("broker unavailable")
+		}, mgo.WithOutboxBackoff(time.Minute, time.Hour))
+		_, err := relay.Process(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, mgo.OutboxPending, setField(last, "status"))
+		assert.Equal(t, "broker unavailable", setField(last, "lastError"))
+		// Third attempt: base doubled twice.
+		next := setField(last, "nextAttemptAt").(time.Time)
+		assert.WithinDuration(t, before.Add(4*time.Minute), next, 5*time.Second)
+	})
+
+	t.Run("Marks failed after max attempts", func(t *testing.T) {
+		msg := pending()
+		msg.Attempts = 2
+		var last bson.D
+		mockDB := &mgo.MockDatastore{
+			OnFind: mgo.NewOnFindMock(msg),
+			OnUpdateOne: func(ctx context.Context, collection string, filter bson.D, update bson.D) (*mgo.WriteResult, error) {
+				last = update
+				return &mgo.WriteResult{MatchedCount: 1, ModifiedCount: 1}, nil
+			},
+		}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		relay := mgo.NewOutboxRelay(func(ctx context.Context, topic, payload string) error {
+			return errors.New("broker unavailable")
+		}, mgo.WithOutboxMaxAttempts(3))
+		_, err := relay.Process(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, mgo.OutboxFailed, setField(last, "status"))
+	})
+}
@@ -14,10 +14,15 @@ type MgoAggregate interface {
 }
 
 func PipeFind[T MgoAggregate](ctx context.Context, aggr T, filter bson.M) ([]T, error) {
-	if dataStore == nil {
+	ds := storeIn(ctx, aggr)
+	if ds == nil {
 		return nil, ErrNotConnected
 	}
-	sortCursor, err := dataStore.PipeFind(ctx, aggr.C(), aggr.GetPipeline(filter))
+	pipeline, err := tenantPipeline(ctx, aggr, aggr.GetPipeline(filter))
+	if err != nil {
+		return nil, err
+	}
+	sortCursor, err := ds.PipeFind(ctx, aggr.C(), pipeline)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
 	}
@@ -26,22 +31,31 @@ func PipeFind[T MgoAggregate](ctx context.Context, aggr T, filter bson.M) ([]T,
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
 	}
+	if err := decryptDocs(ctx, slice); err != nil {
+		return nil, err
+	}
 	return slice, nil
 }
 
 func PipeFindOne[T MgoAggregate](ctx context.Context, aggr T, filter bson.M) error {
-	if dataStore == nil {
+	ds := storeIn(ctx, aggr)
+	if ds == nil {
 		return ErrNotConnected
 	}
-	err := dataStore.PipeFindOne(ctx, aggr.C(), aggr.GetPipeline(filter)).Decode(&aggr)
+	pipeline, err := tenantPipeline(ctx, aggr, aggr.GetPipeline(filter))
+	if err != nil {
+		return err
+	}
+	err = ds.PipeFindOne(ctx, aggr.C(), pipeline).Decode(&aggr)
 	if err != nil {
-		return fmt.Errorf("%w: %w", ErrReadFailed, err)
+		return readError(err)
 	}
-	return nil
+	_, err = decryptDoc(ctx, aggr)
+	return err
 }
 
 func (m *mongoStore) PipeFind(ctx context.Context, collection string, pipeline mongo.Pipeline) (*mongo.Cursor, error) {
-	c := m.getCollection(collection)
+	c := m.collection(ctx, collection)
 	sortCursor, err := c.Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
@@ -50,7 +64,7 @@ func (m *mongoStore) PipeFind(ctx context.Context, collection string, pipeline m
 }
 
 func (m *mongoStore) PipeFindOne(ctx context.Context, collection string, pipeline mongo.Pipeline) *mongo.SingleResult {
-	c := m.getCollection(collection)
+	c := m.collection(ctx, collection)
 	sortCursor, err := c.Aggregate(ctx, pipeline)
 	if err != nil {
 		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
@@ -0,0 +1,306 @@
+package mgo
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Pipeline composes aggregation stages. Each method appends a stage and returns the
+// pipeline so calls can be chained; Build returns the result for MgoAggregate.GetPipeline:
+//
+//	func (o *OrderStats) GetPipeline(q bson.M) mongo.Pipeline {
+//		return mgo.NewPipeline().
+//			Match(bson.D{{Key: "status", Value: q["status"]}}).
+//			Group("$customerId", mgo.AccSum("total", "$amount"), mgo.AccCount("orders")).
+//			Sort(bson.D{{Key: "total", Value: -1}}).
+//			Build()
+//	}
+type Pipeline struct {
+	stages mongo.Pipeline
+}
+
+// NewPipeline returns a pipeline starting with the given raw stages.
+func NewPipeline(stages ...bson.D) *Pipeline {
+	return &Pipeline{stages: append(mongo.Pipeline{}, stages...)}
+}
+
+// Build returns the composed stages.
+func (p *Pipeline) Build() mongo.Pipeline {
+	return append(mongo.Pipeline{}, p.stages...)
+}
+
+// Stage appends a raw stage, for operators without a dedicated method.
+func (p *Pipeline) Stage(stage bson.D) *Pipeline {
+	p.stages = append(p.stages, stage)
+	return p
+}
+
+// Append appends all stages of other.
+func (p *Pipeline) Append(other *Pipeline) *Pipeline {
+	p.stages = append(p.stages, other.stages...)
+	return p
+}
+
+func (p *Pipeline) add(op string, value any) *Pipeline {
+	return p.Stage(bson.D{{Key: op, Value: value}})
+}
+
+// Match appends a $match stage filtering documents with a query filter.
+func (p *Pipeline) Match(filter any) *Pipeline {
+	if filter == nil {
+		filter = bson.D{}
+	}
+	return p.add("$match", filter)
+}
+
+// Lookup appends a $lookup stage joining documents of collection from whose
+// foreignField equals localField, stored as an array in as.
+func (p *Pipeline) Lookup(from, localField, foreignField, as string) *Pipeline {
+	return p.add("$lookup", bson.D{
+		{Key: "from", Value: from},
+		{Key: "localField", Value: localField},
+		{Key: "foreignField", Value: foreignField},
+		{Key: "as", Value: as},
+	})
+}
+
+// LookupPipeline appends a $lookup stage running pipeline against collection from.
+// let binds variables from the input document, usable as $$name in the pipeline.
+func (p *Pipeline) LookupPipeline(from string, let bson.D, pipeline *Pipeline, as string) *Pipeline {
+	spec := bson.D{{Key: "from", Value: from}}
+	if len(let) > 0 {
+		spec = append(spec, bson.E{Key: "let", Value: let})
+	}
+	spec = append(spec,
+		bson.E{Key: "pipeline", Value: pipeline.Build()},
+		bson.E{Key: "as", Value: as},
+	)
+	return p.add("$lookup", spec)
+}
+
+// Unwind appends an $unwind stage emitting one document per element of the array at path,
+// e.g. "$items". With preserveEmpty, documents whose array is missing or empty are kept.
+func (p *Pipeline) Unwind(path string, preserveEmpty bool) *Pipeline {
+	if !preserveEmpty {
+		return p.add("$unwind", path)
+	}
+	return p.add("$unwind", bson.D{
+		{Key: "path", Value: path},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	})
+}
+
+// Group appends a $group stage grouping by id, e.g. "$status" or nil for a single group,
+// and computing the given accumulators:
+//
+//	Group("$status", mgo.AccCount("n"), mgo.AccAvg("avgAge", "$age"))
+func (p *Pipeline) Group(id any, accumulators ...bson.E) *Pipeline {
+	spec := bson.D{{Key: "_id", Value: id}}
+	return p.add("$group", append(spec, accumulators...))
+}
+
+// Accumulator returns a $group field computing op over expr, e.g. Accumulator("tags", "$addToSet", "$tag").
+func Accumulator(field, op string, expr any) bson.E {
+	return bson.E{Key: field, Value: bson.D{{Key: op, Value: expr}}}
+}
+
+// AccSum returns a $group field adding up expr.
+func AccSum(field string, expr any) bson.E { return Accumulator(field, "$sum", expr) }
+
+// AccCount returns a $group field counting the documents in the group.
+func AccCount(field string) bson.E { return Accumulator(field, "$sum", 1) }
+
+// AccAvg returns a $group field averaging expr.
+func AccAvg(field string, expr any) bson.E { return Accumulator(field, "$avg", expr) }
+
+// AccMin returns a $group field holding the lowest value of expr.
+func AccMin(field string, expr any) bson.E { return Accumulator(field, "$min", expr) }
+
+// AccMax returns a $group field holding the highest value of expr.
+func AccMax(field string, expr any) bson.E { return Accumulator(field, "$max", expr) }
+
+// AccFirst returns a $group field holding expr of the first document in the group.
+func AccFirst(field string, expr any) bson.E { return Accumulator(field, "$first", expr) }
+
+// AccLast returns a $group field holding expr of the last document in the group.
+func AccLast(field string, expr any) bson.E { return Accumulator(field, "$last", expr) }
+
+// AccPush returns a $group field collecting expr of every document into an array.
+func AccPush(field string, expr any) bson.E { return Accumulator(field, "$push", expr) }
+
+// AccAddToSet returns a $group field collecting the distinct values of expr into an array.
+func AccAddToSet(field string, expr any) bson.E { return Accumulator(field, "$addToSet", expr) }
+
+// Facet appends a $facet stage running each sub-pipeline on the same input.
+// The output is a single document with one array field per facet.
+func (p *Pipeline) Facet(facets map[string]*Pipeline) *Pipeline {
+	spec := bson.D{}
+	for _, name := range slices.Sorted(maps.Keys(facets)) {
+		spec = append(spec, bson.E{Key: name, Value: facets[name].Build()})
+	}
+	return p.add("$facet", spec)
+}
+
+// GeoNearOption configures a $geoNear stage.
+type GeoNearOption func(spec *bson.D)
+
+// geoNearField sets key in the $geoNear spec, replacing an earlier value.
+func geoNearField(key string, value any) GeoNearOption {
+	return func(spec *bson.D) {
+		for i, e := range *spec {
+			if e.Key == key {
+				(*spec)[i].Value = value
+				return
+			}
+		}
+		*spec = append(*spec, bson.E{Key: key, Value: value})
+	}
+}
+
+// WithGeoMaxDistance limits results to meters from the point.
+func WithGeoMaxDistance(meters float64) GeoNearOption {
+	return geoNearField("maxDistance", meters)
+}
+
+// WithGeoMinDistance excludes results closer than meters to the point.
+func WithGeoMinDistance(meters float64) GeoNearOption {
+	return geoNearField("minDistance", meters)
+}
+
+// WithGeoQuery additionally filters the documents considered.
+func WithGeoQuery(filter any) GeoNearOption {
+	return geoNearField("query", filter)
+}
+
+// WithGeoKey selects the geospatial index field when the collection has several.
+func WithGeoKey(field string) GeoNearOption {
+	return geoNearField("key", field)
+}
+
+// GeoNear appends a $geoNear stage sorting documents by distance from near, a GeoJSON
+// point, and storing the distance in meters in distanceField. It must be the first stage
+// and needs a 2dsphere index.
+func (p *Pipeline) GeoNear(near any, distanceField string, opts ...GeoNearOption) *Pipeline {
+	return p.add("$geoNear", geoNearSpec(near, distanceField, opts))
+}
+
+func geoNearSpec(near any, distanceField string, opts []GeoNearOption) bson.D {
+	spec := bson.D{
+		{Key: "near", Value: near},
+		{Key: "distanceField", Value: distanceField},
+		{Key: "spherical", Value: true},
+	}
+	for _, opt := range opts {
+		opt(&spec)
+	}
+	return spec
+}
+
+// Project appends a $project stage including, excluding or computing fields.
+func (p *Pipeline) Project(fields any) *Pipeline {
+	return p.add("$project", fields)
+}
+
+// AddFields appends an $addFields stage.
+func (p *Pipeline) AddFields(fields any) *Pipeline {
+	return p.add("$addFields", fields)
+}
+
+// Sort appends a $sort stage.
+func (p *Pipeline) Sort(keys bson.D) *Pipeline {
+	return p.add("$sort", keys)
+}
+
+// Skip appends a $skip stage.
+func (p *Pipeline) Skip(n int64) *Pipeline {
+	return p.add("$skip", n)
+}
+
+// Limit appends a $limit stage.
+func (p *Pipeline) Limit(n int64) *Pipeline {
+	return p.add("$limit", n)
+}
+
+// Count appends a $count stage storing the number of input documents in field.
+func (p *Pipeline) Count(field string) *Pipeline {
+	return p.add("$count", field)
+}
+
+// Paginate appends $skip and $limit stages selecting the 1-based page of size documents.
+func (p *Pipeline) Paginate(page, size int64) *Pipeline {
+	skip, limit := pageWindow(page, size)
+	return p.Skip(skip).Limit(limit)
+}
+
+// PaginateWithTotal appends a $facet stage returning the requested page in "items" and
+// the number of documents before pagination in "total", in one round trip.
+// PipeFindPage decodes its output into a PageResult.
+func (p *Pipeline) PaginateWithTotal(page, size int64) *Pipeline {
+	return p.Facet(map[string]*Pipeline{
+		"items": NewPipeline().Paginate(page, size),
+		"total": NewPipeline().Count("count"),
+	})
+}
+
+// pageWindow converts a 1-based page number to skip and limit. Page and size below 1 are raised to 1.
+func pageWindow(page, size int64) (skip, limit int64) {
+	page, size = max(page, 1), max(size, 1)
+	return (page - 1) * size, size
+}
+
+// PageResult is one page of aggregation results with the total number of matches.
+type PageResult[T any] struct {
+	Items []T
+	Total int64
+	Page  int64
+	Size  int64
+}
+
+// pageFacet is the document produced by PaginateWithTotal.
+type pageFacet[T any] struct {
+	Items []T `bson:"items"`
+	Total []struct {
+		Count int64 `bson:"count"`
+	} `bson:"total"`
+}
+
+// PipeFindPage runs the pipeline of aggr followed by PaginateWithTotal and returns the
+// requested 1-based page together with the total count.
+func PipeFindPage[T MgoAggregate](ctx context.Context, aggr T, filter bson.M, page, size int64) (*PageResult[T], error) {
+	ds := storeIn(ctx, aggr)
+	if ds == nil {
+		return nil, ErrNotConnected
+	}
+	stages, err := tenantPipeline(ctx, aggr, aggr.GetPipeline(filter))
+	if err != nil {
+		return nil, err
+	}
+	pipeline := NewPipeline(stages...).PaginateWithTotal(page, size).Build()
+	cursor, err := ds.PipeFind(ctx, aggr.C(), pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	var facets []pageFacet[T]
+	if err := cursor.All(ctx, &facets); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	_, size = pageWindow(page, size)
+	result := &PageResult[T]{Items: []T{}, Page: max(page, 1), Size: size}
+	if len(facets) > 0 {
+		if facets[0].Items != nil {
+			result.Items = facets[0].Items
+			if err := decryptDocs(ctx, result.Items); err != nil {
+				return nil, err
+			}
+		}
+		if len(facets[0].Total) > 0 {
+			result.Total = facets[0].Total[0].Count
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package mgo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func TestPipelineBuild(t *testing.T) {
+	pipeline := mgo.NewPipeline().
+		Match(bson.D{{Key: "status", Value: "paid"}}).
+		Lookup("customers", "customerId", "_id", "customer").
+		Unwind("$customer", true).
+		Group("$customer.country", mgo.AccSum("total", "$amount"), mgo.AccCount("orders")).
+		Sort(bson.D{{Key: "total", Value: -1}}).
+		Paginate(2, 10).
+		Build()
+
+	expected := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "status", Value: "paid"}}}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "customers"},
+			{Key: "localField", Value: "customerId"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "customer"},
+		}}},
+		{{Key: "$unwind", Value: bson.D{
+			{Key: "path", Value: "$customer"},
+			{Key: "preserveNullAndEmptyArrays", Value: true},
+		}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$customer.country"},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+			{Key: "orders", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "total", Value: -1}}}},
+		{{Key: "$skip", Value: int64(10)}},
+		{{Key: "$limit", Value: int64(10)}},
+	}
+	assert.Equal(t, expected, pipeline)
+}
+
+func TestPipelineGeoNearAndFacet(t *testing.T) {
+	near := bson.D{{Key: "type", Value: "Point"}, {Key: "coordinates", Value: bson.A{121.5, 25.0}}}
+	pipeline := mgo.NewPipeline().
+		GeoNear(near, "distance", mgo.WithGeoMaxDistance(500)).
+		Facet(map[string]*mgo.Pipeline{
+			"nearest": mgo.NewPipeline().Limit(1),
+			"count":   mgo.NewPipeline().Count("n"),
+		}).
+		Build()
+
+	assert.Equal(t, bson.D{
+		{Key: "near", Value: near},
+		{Key: "distanceField", Value: "distance"},
+		{Key: "spherical", Value: true},
+		{Key: "maxDistance", Value: float64(500)},
+	}, pipeline[0][0].Value)
+	assert.Equal(t, bson.D{
+		{Key: "count", Value: mongo.Pipeline{{{Key: "$count", Value: "n"}}}},
+		{Key: "nearest", Value: mongo.Pipeline{{{Key: "$limit", Value: int64(1)}}}},
+	}, pipeline[1][0].Value)
+}
+
+func TestPipeFindPage(t *testing.T) {
+	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+	defer restore()
+	seedUsers(t)
+	ctx := context.Background()
+
+	page, err := mgo.PipeFindPage(ctx, &testAdults{}, bson.M{"minAge": 0}, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), page.Total, "testAdults limits to two users")
+	assert.Len(t, page.Items, 1)
+	assert.Equal(t, "Alice", page.Items[0].Name)
+
+	page, err = mgo.PipeFindPage(ctx, &testAdults{}, bson.M{"minAge": 100}, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), page.Total)
+	assert.Empty(t, page.Items)
+	assert.Equal(t, int64(10), page.Size)
+}
+
+func TestMemoryDatastoreUnwind(t *testing.T) {
+	store := mgo.NewMemoryDatastore()
+	restore := mgo.SetDatastore(store)
+	defer restore()
+	ctx := context.Background()
+
+	_, err := mgo.Save(ctx, &testAccount{Email: "a@example.com", Tags: []string{"new", "vip"}})
+	assert.NoError(t, err)
+	_, err = mgo.Save(ctx, &testAccount{Email: "b@example.com"})
+	assert.NoError(t, err)
+
+	unwound := func(preserveEmpty bool) []bson.M {
+		cursor, err := store.PipeFind(ctx, "memory_accounts", mgo.NewPipeline().Unwind("$tags", preserveEmpty).Build())
+		assert.NoError(t, err)
+		var docs []bson.M
+		assert.NoError(t, cursor.All(ctx, &docs))
+		return docs
+	}
+	docs := unwound(false)
+	assert.Len(t, docs, 2)
+	assert.Equal(t, "vip", docs[1]["tags"])
+	assert.Len(t, unwound(true), 3)
+}
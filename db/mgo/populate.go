@@ -0,0 +1,235 @@
+package mgo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// reference is a field tagged with `vulpes:"ref=<collection>"` together with the
+// field Populate fills with the referenced documents.
+type reference struct {
+	collection string
+	// id is the index of the tagged field holding the _id, or a slice of _ids when many.
+	id   []int
+	many bool
+	// target is the index of the populated field, a pointer or a slice of pointers.
+	target []int
+	name   string
+	// model is the pointer type of the referenced documents.
+	model reflect.Type
+}
+
+// referenceCache maps a struct type to its []reference.
+var referenceCache sync.Map
+
+// references returns the references declared by the struct type t.
+func references(t reflect.Type) ([]reference, error) {
+	if refs, ok := referenceCache.Load(t); ok {
+		return refs.([]reference), nil
+	}
+	var refs []reference
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := parseTag(f)
+		if !tag.has("ref") {
+			continue
+		}
+		ref, err := newReference(t, f, tag)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	referenceCache.Store(t, refs)
+	return refs, nil
+}
+
+// newReference resolves the target of the reference field f of t. The target is named by
+// the "into" option, or else by f's name without its ID suffix, e.g. UserID fills User.
+func newReference(t reflect.Type, f reflect.StructField, tag fieldTag) (reference, error) {
+	ref := reference{collection: tag["ref"], id: f.Index, many: f.Type.Kind() == reflect.Slice}
+	if ref.collection == "" {
+		return ref, fmt.Errorf("%w: %s.%s: ref needs a collection name", ErrInvalidDocument, t.Name(), f.Name)
+	}
+	ref.name = tag["into"]
+	if ref.name == "" {
+		ref.name = f.Name
+		for _, suffix := range []string{"IDs", "Ids", "ID", "Id"} {
+			if name, ok := strings.CutSuffix(f.Name, suffix); ok && name != "" {
+				ref.name = name
+				break
+			}
+		}
+	}
+	target, ok := t.FieldByName(ref.name)
+	if !ok || ref.name == f.Name {
+		return ref, fmt.Errorf("%w: %s.%s: no field %s to populate", ErrInvalidDocument, t.Name(), f.Name, ref.name)
+	}
+	ref.target = target.Index
+	ref.model = target.Type
+	if ref.many {
+		if ref.model.Kind() != reflect.Slice {
+			return ref, fmt.Errorf("%w: %s.%s must be a slice of pointers", ErrInvalidDocument, t.Name(), ref.name)
+		}
+		ref.model = ref.model.Elem()
+	}
+	if ref.model.Kind() != reflect.Ptr || ref.model.Elem().Kind() != reflect.Struct {
+		return ref, fmt.Errorf("%w: %s.%s must point to a struct", ErrInvalidDocument, t.Name(), ref.name)
+	}
+	return ref, nil
+}
+
+// Populate fills the reference fields of docs with the documents they refer to, loading
+// each relation with a single $in query instead of one query per document. A reference
+// is a field holding an _id, or a slice of _ids, tagged with the referenced collection;
+// it fills the field named like it without its ID suffix, or the field named by into:
+//
+//	type Order struct {
+//		UserID  bson.ObjectID   `bson:"userId" vulpes:"ref=users"`
+//		User    *User           `bson:"-"`
+//		ItemIDs []bson.ObjectID `bson:"itemIds" vulpes:"ref=items,into=Lines"`
+//		Lines   []*Item         `bson:"-"`
+//	}
+//
+//	orders, err := mgo.Find(ctx, &Order{}, filter)
+//	err = mgo.Populate(ctx, orders)
+//
+// fields restricts the call to the named relations, e.g. "User"; by default all are loaded.
+// Referenced documents are read from the datastore of their model with the same scoping
+// as Find: soft-deleted documents are left out, encrypted fields are decrypted and
+// AfterFind hooks run. References to missing documents stay nil and are skipped in slices.
+// Documents referring to the same _id share the loaded document.
+func Populate[T any](ctx context.Context, docs []T, fields ...string) error {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: cannot populate %s, need pointers to structs", ErrInvalidDocument, t)
+	}
+	refs, err := references(t.Elem())
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if len(fields) > 0 && !slices.Contains(fields, ref.name) {
+			continue
+		}
+		if err := populate(ctx, docs, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// populate loads and fills one relation of docs.
+func populate[T any](ctx context.Context, docs []T, ref reference) error {
+	var ids []any
+	seen := map[string]bool{}
+	for _, doc := range docs {
+		for _, id := range ref.ids(doc) {
+			if key, ok := idKey(id); ok && !seen[key] {
+				seen[key] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	model := reflect.New(ref.model.Elem()).Interface()
+	ds := storeIn(ctx, model)
+	if ds == nil {
+		return ErrNotConnected
+	}
+	filter, err := tenantFilter(ctx, model, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return err
+	}
+	cursor, err := ds.Find(ctx, ref.collection, scopeFilter(ctx, model, filter))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	defer cursor.Close(ctx)
+	loaded := map[string]reflect.Value{}
+	for cursor.Next(ctx) {
+		id := cursor.Current.Lookup("_id")
+		doc := reflect.New(ref.model.Elem())
+		if err := cursor.Decode(doc.Interface()); err != nil {
+			return fmt.Errorf("%w: %w", ErrReadFailed, err)
+		}
+		if _, err := decryptDoc(ctx, doc.Interface()); err != nil {
+			return err
+		}
+		if err := afterFind(ctx, doc.Interface()); err != nil {
+			return err
+		}
+		loaded[rawKey(id.Type, id.Value)] = doc
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+
+	for _, doc := range docs {
+		v := reflect.ValueOf(doc)
+		if v.IsNil() {
+			continue
+		}
+		target := v.Elem().FieldByIndex(ref.target)
+		if !ref.many {
+			target.SetZero()
+		} else {
+			target.Set(reflect.MakeSlice(target.Type(), 0, 0))
+		}
+		for _, id := range ref.ids(doc) {
+			key, _ := idKey(id)
+			found, ok := loaded[key]
+			switch {
+			case !ok:
+			case ref.many:
+				target.Set(reflect.Append(target, found))
+			default:
+				target.Set(found)
+			}
+		}
+	}
+	return nil
+}
+
+// ids returns the non-zero _ids doc refers to.
+func (r reference) ids(doc any) []any {
+	v := reflect.ValueOf(doc)
+	if v.IsNil() {
+		return nil
+	}
+	field := v.Elem().FieldByIndex(r.id)
+	if !r.many {
+		if field.IsZero() {
+			return nil
+		}
+		return []any{field.Interface()}
+	}
+	ids := make([]any, 0, field.Len())
+	for i := 0; i < field.Len(); i++ {
+		if id := field.Index(i); !id.IsZero() {
+			ids = append(ids, id.Interface())
+		}
+	}
+	return ids
+}
+
+// idKey encodes id like the stored _id, so that it can be matched with loaded documents.
+func idKey(id any) (string, bool) {
+	typ, data, err := bson.MarshalValue(id)
+	if err != nil {
+		return "", false
+	}
+	return rawKey(typ, data), true
+}
+
+func rawKey(typ bson.Type, data []byte) string {
+	return string(append([]byte{byte(typ)}, data...))
+}
@@ -0,0 +1,91 @@
+package mgo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// testOrder refers to its buyer and the products it contains.
+type testOrder struct {
+	ID         bson.ObjectID   `bson:"_id,omitempty"`
+	BuyerID    bson.ObjectID   `bson:"buyerId" vulpes:"ref=users"`
+	Buyer      *testUser       `bson:"-"`
+	ProductIDs []bson.ObjectID `bson:"productIds" vulpes:"ref=products,into=Lines"`
+	Lines      []*testProduct  `bson:"-"`
+}
+
+func (o *testOrder) C() string                   { return "orders" }
+func (o *testOrder) Indexes() []mongo.IndexModel { return nil }
+func (o *testOrder) Validate() error             { return nil }
+func (o *testOrder) GetId() any                  { return o.ID }
+func (o *testOrder) SetId(id any)                { o.ID = id.(bson.ObjectID) }
+
+// findCounter counts the Find calls made through a datastore.
+type findCounter struct {
+	mgo.Datastore
+	finds map[string]int
+}
+
+func (c *findCounter) Find(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
+	c.finds[collection]++
+	return c.Datastore.Find(ctx, collection, filter, opts...)
+}
+
+func TestPopulate(t *testing.T) {
+	store := &findCounter{Datastore: mgo.NewMemoryDatastore(), finds: map[string]int{}}
+	defer mgo.SetDatastore(store)()
+	ctx := context.Background()
+
+	ann, err := mgo.Save(ctx, &testUser{Name: "Ann"})
+	assert.NoError(t, err)
+	bob, err := mgo.Save(ctx, &testUser{Name: "Bob"})
+	assert.NoError(t, err)
+	mug, err := mgo.Save(ctx, &testProduct{Name: "Mug"})
+	assert.NoError(t, err)
+	cup, err := mgo.Save(ctx, &testProduct{Name: "Cup"})
+	assert.NoError(t, err)
+	_, err = mgo.DeleteById(ctx, cup)
+	assert.NoError(t, err)
+
+	orders := []*testOrder{
+		{BuyerID: ann.ID, ProductIDs: []bson.ObjectID{mug.ID, cup.ID}},
+		{BuyerID: bob.ID, ProductIDs: []bson.ObjectID{mug.ID}},
+		{BuyerID: ann.ID},
+		{BuyerID: bson.NewObjectID()},
+	}
+	assert.NoError(t, mgo.Populate(ctx, orders))
+
+	assert.Equal(t, map[string]int{"users": 1, "products": 1}, store.finds, "one query per relation")
+	assert.Equal(t, "Ann", orders[0].Buyer.Name)
+	assert.Equal(t, "Bob", orders[1].Buyer.Name)
+	assert.Same(t, orders[0].Buyer, orders[2].Buyer)
+	assert.Nil(t, orders[3].Buyer, "missing documents are left nil")
+	if assert.Len(t, orders[0].Lines, 1, "soft-deleted documents are left out") {
+		assert.Equal(t, "Mug", orders[0].Lines[0].Name)
+	}
+	assert.Empty(t, orders[2].Lines)
+
+	t.Run("Selected relations", func(t *testing.T) {
+		store.finds = map[string]int{}
+		orders := []*testOrder{{BuyerID: bob.ID, ProductIDs: []bson.ObjectID{mug.ID}}}
+		assert.NoError(t, mgo.Populate(ctx, orders, "Buyer"))
+		assert.Equal(t, map[string]int{"users": 1}, store.finds)
+		assert.Equal(t, "Bob", orders[0].Buyer.Name)
+		assert.Nil(t, orders[0].Lines)
+	})
+}
+
+func TestPopulateInvalidReference(t *testing.T) {
+	type broken struct {
+		OwnerID bson.ObjectID `vulpes:"ref=users"`
+	}
+	err := mgo.Populate(context.Background(), []*broken{{}})
+	assert.ErrorIs(t, err, mgo.ErrInvalidDocument)
+}
@@ -0,0 +1,606 @@
+package mgo
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arwoosa/vulpes/db/mgo/types"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// timestampName is the full name of the well-known google.protobuf.Timestamp message.
+const timestampName protoreflect.FullName = "google.protobuf.Timestamp"
+
+var (
+	objectIDType = reflect.TypeOf(bson.ObjectID{})
+	timeType     = reflect.TypeOf(time.Time{})
+	locationType = reflect.TypeOf(types.Location{})
+)
+
+// ProtoOption overrides how ToProto, ToProtos and FromProto pair model fields with
+// message fields. Options apply to nested structs as well.
+type ProtoOption func(*protoMapping)
+
+type protoMapping struct {
+	// names maps the Go name of a model field to the name of its message field,
+	// "-" leaving it unmapped.
+	names map[string]string
+}
+
+// WithProtoName maps the model field with the given Go name to the message field named
+// name, e.g. WithProtoName("ID", "order_id"). The struct tag `vulpes:"proto=order_id"`
+// does the same for every conversion of the model.
+func WithProtoName(field, name string) ProtoOption {
+	return func(m *protoMapping) {
+		m.names[field] = name
+	}
+}
+
+// WithoutProtoField leaves the model fields with the given Go names unmapped, like the
+// struct tag `vulpes:"proto=-"`.
+func WithoutProtoField(fields ...string) ProtoOption {
+	return func(m *protoMapping) {
+		for _, field := range fields {
+			m.names[field] = "-"
+		}
+	}
+}
+
+func newProtoMapping(opts []ProtoOption) *protoMapping {
+	m := &protoMapping{names: map[string]string{}}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// ToProto copies the fields of doc into msg, e.g. to build a gRPC response from a model:
+//
+//	resp := &pb.Order{}
+//	if err := mgo.ToProto(order, resp); err != nil {
+//		return nil, err
+//	}
+//
+// Fields are paired by name, ignoring case and underscores, so that UserID or
+// `bson:"userId"` fills user_id; fields of inline structs such as Timestamps are
+// included. Besides values of the same kind, bson.ObjectID maps to a string (the hex
+// form), time.Time to google.protobuf.Timestamp, types.Location to a message with
+// lat/latitude and lng/lon/longitude fields, and structs to messages. Model fields
+// without a matching message field are skipped; zero ObjectIDs and times and nil
+// pointers leave the message field unset. Fields whose types cannot be converted
+// return ErrInvalidDocument.
+func ToProto(doc DocInter, msg proto.Message, opts ...ProtoOption) error {
+	if isNilDoc(doc) {
+		return fmt.Errorf("%w: nil document", ErrInvalidDocument)
+	}
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	return newProtoMapping(opts).toMessage(v, msg.ProtoReflect())
+}
+
+// ToProtos converts docs to new messages of the generated type M like ToProto, e.g. for
+// list responses:
+//
+//	items, err := mgo.ToProtos[*pb.Order](orders)
+func ToProtos[M proto.Message, T DocInter](docs []T, opts ...ProtoOption) ([]M, error) {
+	var zero M
+	msgType := zero.ProtoReflect().Type()
+	mapping := newProtoMapping(opts)
+	msgs := make([]M, len(docs))
+	for i, doc := range docs {
+		if isNilDoc(doc) {
+			return nil, fmt.Errorf("%w: document %d is nil", ErrInvalidDocument, i)
+		}
+		msg := msgType.New()
+		if err := mapping.toMessage(reflect.ValueOf(doc).Elem(), msg); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		msgs[i] = msg.Interface().(M)
+	}
+	return msgs, nil
+}
+
+// FromProto copies the fields of msg into doc, the reverse of ToProto, e.g. to build a
+// model from a gRPC request. Every paired field is overwritten; unset message fields
+// reset the model field to its zero value. Strings that are not valid ObjectIDs return
+// ErrInvalidDocument.
+func FromProto(msg proto.Message, doc DocInter, opts ...ProtoOption) error {
+	if isNilDoc(doc) {
+		return fmt.Errorf("%w: nil document", ErrInvalidDocument)
+	}
+	return newProtoMapping(opts).fromMessage(msg.ProtoReflect(), reflect.ValueOf(doc).Elem())
+}
+
+// protoDocField is a model field that can be paired with a message field.
+type protoDocField struct {
+	index []int
+	// goName is the Go name of the field, used by WithProtoName and WithoutProtoField.
+	goName string
+	// keys are the normalized Go and bson names the field pairs with.
+	keys []string
+	// tagName is the message field name from the proto= tag option, if any.
+	tagName string
+}
+
+// protoFieldCache maps a struct type to its []protoDocField.
+var protoFieldCache sync.Map
+
+// protoDocFields returns the fields of the struct type t, including those of inline
+// and embedded structs.
+func protoDocFields(t reflect.Type) []protoDocField {
+	if fields, ok := protoFieldCache.Load(t); ok {
+		return fields.([]protoDocField)
+	}
+	fields := collectProtoDocFields(t, nil)
+	protoFieldCache.Store(t, fields)
+	return fields
+}
+
+func collectProtoDocFields(t reflect.Type, index []int) []protoDocField {
+	var fields []protoDocField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		name, inline, _ := bsonFieldName(f)
+		tagName := parseTag(f)["proto"]
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if (f.Anonymous || inline) && tagName == "" && ft.Kind() == reflect.Struct {
+			fields = append(fields, collectProtoDocFields(ft, fieldIndex)...)
+			continue
+		}
+		keys := []string{normalizeProtoName(f.Name)}
+		if name != "" && name != "-" {
+			keys = append(keys, normalizeProtoName(name))
+		}
+		fields = append(fields, protoDocField{index: fieldIndex, goName: f.Name, keys: keys, tagName: tagName})
+	}
+	return fields
+}
+
+// normalizeProtoName folds case and underscores, so that UserID, userId and user_id match.
+func normalizeProtoName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// messageField returns the message field paired with f, or nil when there is none.
+func (m *protoMapping) messageField(f protoDocField, md protoreflect.MessageDescriptor) (protoreflect.FieldDescriptor, error) {
+	name, ok := m.names[f.goName]
+	if !ok {
+		name = f.tagName
+	}
+	switch name {
+	case "-":
+		return nil, nil
+	case "":
+		fields := md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			fd := fields.Get(i)
+			key := normalizeProtoName(string(fd.Name()))
+			for _, k := range f.keys {
+				if k == key {
+					return fd, nil
+				}
+			}
+		}
+		return nil, nil
+	}
+	fd := md.Fields().ByName(protoreflect.Name(name))
+	if fd == nil {
+		return nil, fmt.Errorf("%w: %s has no field %q for %s", ErrInvalidDocument, md.FullName(), name, f.goName)
+	}
+	return fd, nil
+}
+
+func (m *protoMapping) toMessage(v reflect.Value, msg protoreflect.Message) error {
+	for _, f := range protoDocFields(v.Type()) {
+		fd, err := m.messageField(f, msg.Descriptor())
+		if err != nil {
+			return err
+		}
+		if fd == nil {
+			continue
+		}
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil {
+			// A nil embedded pointer: its fields are all unset.
+			continue
+		}
+		if err := m.setMessageField(msg, fd, fv); err != nil {
+			return fmt.Errorf("%s: %w", f.goName, err)
+		}
+	}
+	return nil
+}
+
+func (m *protoMapping) setMessageField(msg protoreflect.Message, fd protoreflect.FieldDescriptor, v reflect.Value) error {
+	switch {
+	case fd.IsList():
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return mismatchError(v.Type(), fd)
+		}
+		if v.Len() == 0 {
+			return nil
+		}
+		list := msg.Mutable(fd).List()
+		for i := 0; i < v.Len(); i++ {
+			elem, ok, err := m.toProtoValue(v.Index(i), fd, list.NewElement)
+			if err != nil {
+				return fmt.Errorf("%d: %w", i, err)
+			}
+			if ok {
+				list.Append(elem)
+			}
+		}
+	case fd.IsMap():
+		if v.Kind() != reflect.Map {
+			return mismatchError(v.Type(), fd)
+		}
+		if v.Len() == 0 {
+			return nil
+		}
+		entries := msg.Mutable(fd).Map()
+		iter := v.MapRange()
+		for iter.Next() {
+			key, ok, err := toProtoScalar(iter.Key(), fd.MapKey())
+			if err != nil || !ok {
+				return err
+			}
+			value, ok, err := m.toProtoValue(iter.Value(), fd.MapValue(), entries.NewValue)
+			if err != nil {
+				return fmt.Errorf("%v: %w", iter.Key(), err)
+			}
+			if ok {
+				entries.Set(key.MapKey(), value)
+			}
+		}
+	default:
+		value, ok, err := m.toProtoValue(v, fd, func() protoreflect.Value { return msg.NewField(fd) })
+		if err != nil || !ok {
+			return err
+		}
+		msg.Set(fd, value)
+	}
+	return nil
+}
+
+// toProtoValue converts a single value for fd, reporting false when it stays unset.
+// newMessage allocates the message of a message field.
+func (m *protoMapping) toProtoValue(v reflect.Value, fd protoreflect.FieldDescriptor, newMessage func() protoreflect.Value) (protoreflect.Value, bool, error) {
+	if fd.Message() == nil {
+		return toProtoScalar(v, fd)
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return protoreflect.Value{}, false, nil
+		}
+		v = v.Elem()
+	}
+	value := newMessage()
+	msg := value.Message()
+	switch {
+	case v.Type() == timeType && fd.Message().FullName() == timestampName:
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return protoreflect.Value{}, false, nil
+		}
+		fields := fd.Message().Fields()
+		msg.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(t.Unix()))
+		msg.Set(fields.ByName("nanos"), protoreflect.ValueOfInt32(int32(t.Nanosecond())))
+	case v.Type() == locationType:
+		loc := v.Interface().(types.Location)
+		lat, lng := latLngFields(fd.Message())
+		if lat == nil || lng == nil {
+			return protoreflect.Value{}, false, mismatchError(v.Type(), fd)
+		}
+		if len(loc.Coordinates) != 2 {
+			return protoreflect.Value{}, false, nil
+		}
+		msg.Set(lat, floatValue(lat, loc.Coordinates[1]))
+		msg.Set(lng, floatValue(lng, loc.Coordinates[0]))
+	case v.Kind() == reflect.Struct && v.Type() != timeType:
+		if err := m.toMessage(v, msg); err != nil {
+			return protoreflect.Value{}, false, err
+		}
+	default:
+		return protoreflect.Value{}, false, mismatchError(v.Type(), fd)
+	}
+	return value, true, nil
+}
+
+func toProtoScalar(v reflect.Value, fd protoreflect.FieldDescriptor) (protoreflect.Value, bool, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return protoreflect.Value{}, false, nil
+		}
+		v = v.Elem()
+	}
+	if v.Type() == objectIDType && fd.Kind() == protoreflect.StringKind {
+		id := v.Interface().(bson.ObjectID)
+		if id.IsZero() {
+			return protoreflect.Value{}, false, nil
+		}
+		return protoreflect.ValueOfString(id.Hex()), true, nil
+	}
+	k := v.Kind()
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		if k == reflect.String {
+			return protoreflect.ValueOfString(v.String()), true, nil
+		}
+	case protoreflect.BoolKind:
+		if k == reflect.Bool {
+			return protoreflect.ValueOfBool(v.Bool()), true, nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if isIntKind(k) {
+			return protoreflect.ValueOfInt32(int32(v.Int())), true, nil
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if isIntKind(k) {
+			return protoreflect.ValueOfInt64(v.Int()), true, nil
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if isUintKind(k) {
+			return protoreflect.ValueOfUint32(uint32(v.Uint())), true, nil
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if isUintKind(k) {
+			return protoreflect.ValueOfUint64(v.Uint()), true, nil
+		}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		if k == reflect.Float32 || k == reflect.Float64 {
+			return floatValue(fd, v.Float()), true, nil
+		}
+	case protoreflect.BytesKind:
+		if k == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return protoreflect.ValueOfBytes(v.Bytes()), true, nil
+		}
+	case protoreflect.EnumKind:
+		switch {
+		case isIntKind(k):
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v.Int())), true, nil
+		case k == reflect.String:
+			if v.String() == "" {
+				return protoreflect.Value{}, false, nil
+			}
+			value := fd.Enum().Values().ByName(protoreflect.Name(v.String()))
+			if value == nil {
+				return protoreflect.Value{}, false, fmt.Errorf("%w: %s has no value %q", ErrInvalidDocument, fd.Enum().FullName(), v.String())
+			}
+			return protoreflect.ValueOfEnum(value.Number()), true, nil
+		}
+	}
+	return protoreflect.Value{}, false, mismatchError(v.Type(), fd)
+}
+
+func (m *protoMapping) fromMessage(msg protoreflect.Message, v reflect.Value) error {
+	for _, f := range protoDocFields(v.Type()) {
+		fd, err := m.messageField(f, msg.Descriptor())
+		if err != nil {
+			return err
+		}
+		if fd == nil {
+			continue
+		}
+		if err := m.setDocField(fieldByIndexAlloc(v, f.index), msg, fd); err != nil {
+			return fmt.Errorf("%s: %w", f.goName, err)
+		}
+	}
+	return nil
+}
+
+// fieldByIndexAlloc is reflect.Value.FieldByIndex, allocating nil embedded pointers.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func (m *protoMapping) setDocField(v reflect.Value, msg protoreflect.Message, fd protoreflect.FieldDescriptor) error {
+	switch {
+	case fd.IsList():
+		if v.Kind() != reflect.Slice {
+			return mismatchError(v.Type(), fd)
+		}
+		list := msg.Get(fd).List()
+		if list.Len() == 0 {
+			v.SetZero()
+			return nil
+		}
+		s := reflect.MakeSlice(v.Type(), list.Len(), list.Len())
+		for i := 0; i < list.Len(); i++ {
+			if err := m.fromProtoValue(s.Index(i), list.Get(i), fd); err != nil {
+				return fmt.Errorf("%d: %w", i, err)
+			}
+		}
+		v.Set(s)
+	case fd.IsMap():
+		if v.Kind() != reflect.Map {
+			return mismatchError(v.Type(), fd)
+		}
+		entries := msg.Get(fd).Map()
+		if entries.Len() == 0 {
+			v.SetZero()
+			return nil
+		}
+		out := reflect.MakeMapWithSize(v.Type(), entries.Len())
+		var err error
+		entries.Range(func(k protoreflect.MapKey, value protoreflect.Value) bool {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err = fromProtoScalar(key, k.Value(), fd.MapKey()); err != nil {
+				return false
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err = m.fromProtoValue(elem, value, fd.MapValue()); err != nil {
+				err = fmt.Errorf("%v: %w", k.Interface(), err)
+				return false
+			}
+			out.SetMapIndex(key, elem)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		v.Set(out)
+	case fd.HasPresence() && !msg.Has(fd):
+		v.SetZero()
+	default:
+		return m.fromProtoValue(v, msg.Get(fd), fd)
+	}
+	return nil
+}
+
+func (m *protoMapping) fromProtoValue(v reflect.Value, value protoreflect.Value, fd protoreflect.FieldDescriptor) error {
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := m.fromProtoValue(elem.Elem(), value, fd); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	if fd.Message() == nil {
+		return fromProtoScalar(v, value, fd)
+	}
+	msg := value.Message()
+	switch {
+	case v.Type() == timeType && fd.Message().FullName() == timestampName:
+		fields := fd.Message().Fields()
+		seconds := msg.Get(fields.ByName("seconds")).Int()
+		nanos := msg.Get(fields.ByName("nanos")).Int()
+		v.Set(reflect.ValueOf(time.Unix(seconds, nanos).UTC()))
+	case v.Type() == locationType:
+		lat, lng := latLngFields(fd.Message())
+		if lat == nil || lng == nil {
+			return mismatchError(v.Type(), fd)
+		}
+		v.Set(reflect.ValueOf(*types.NewLocationPoint(msg.Get(lng).Float(), msg.Get(lat).Float())))
+	case v.Kind() == reflect.Struct && v.Type() != timeType:
+		return m.fromMessage(msg, v)
+	default:
+		return mismatchError(v.Type(), fd)
+	}
+	return nil
+}
+
+func fromProtoScalar(v reflect.Value, value protoreflect.Value, fd protoreflect.FieldDescriptor) error {
+	if v.Type() == objectIDType && fd.Kind() == protoreflect.StringKind {
+		if value.String() == "" {
+			v.SetZero()
+			return nil
+		}
+		id, err := bson.ObjectIDFromHex(value.String())
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidDocument, err)
+		}
+		v.Set(reflect.ValueOf(id))
+		return nil
+	}
+	k := v.Kind()
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		if k == reflect.String {
+			v.SetString(value.String())
+			return nil
+		}
+	case protoreflect.BoolKind:
+		if k == reflect.Bool {
+			v.SetBool(value.Bool())
+			return nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if isIntKind(k) {
+			v.SetInt(value.Int())
+			return nil
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if isUintKind(k) {
+			v.SetUint(value.Uint())
+			return nil
+		}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		if k == reflect.Float32 || k == reflect.Float64 {
+			v.SetFloat(value.Float())
+			return nil
+		}
+	case protoreflect.BytesKind:
+		if k == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(append([]byte(nil), value.Bytes()...))
+			return nil
+		}
+	case protoreflect.EnumKind:
+		switch {
+		case isIntKind(k):
+			v.SetInt(int64(value.Enum()))
+			return nil
+		case k == reflect.String:
+			if ev := fd.Enum().Values().ByNumber(value.Enum()); ev != nil {
+				v.SetString(string(ev.Name()))
+			} else {
+				v.SetString("")
+			}
+			return nil
+		}
+	}
+	return mismatchError(v.Type(), fd)
+}
+
+// latLngFields returns the latitude and longitude fields of a lat/lng message, such as
+// google.type.LatLng.
+func latLngFields(md protoreflect.MessageDescriptor) (lat, lng protoreflect.FieldDescriptor) {
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.Kind() != protoreflect.DoubleKind && fd.Kind() != protoreflect.FloatKind {
+			continue
+		}
+		switch fd.Name() {
+		case "lat", "latitude":
+			lat = fd
+		case "lng", "lon", "longitude":
+			lng = fd
+		}
+	}
+	return lat, lng
+}
+
+func floatValue(fd protoreflect.FieldDescriptor, f float64) protoreflect.Value {
+	if fd.Kind() == protoreflect.FloatKind {
+		return protoreflect.ValueOfFloat32(float32(f))
+	}
+	return protoreflect.ValueOfFloat64(f)
+}
+
+func isIntKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUintKind(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uint64
+}
+
+func mismatchError(t reflect.Type, fd protoreflect.FieldDescriptor) error {
+	return fmt.Errorf("%w: cannot map %s to %s", ErrInvalidDocument, t, fd.FullName())
+}
@@ -0,0 +1,179 @@
+package mgo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+	"github.com/arwoosa/vulpes/db/mgo/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type testLine struct {
+	SKU string `bson:"sku"`
+	Qty int    `bson:"qty"`
+}
+
+// testShipment pairs with the test.Shipment message of shipmentDescriptor.
+type testShipment struct {
+	ID             bson.ObjectID   `bson:"_id,omitempty"`
+	UserID         bson.ObjectID   `bson:"userId"`
+	Status         string          `bson:"status"`
+	Location       *types.Location `bson:"location"`
+	Lines          []testLine      `bson:"lines"`
+	Total          float64         `bson:"total"`
+	Remark         string          `bson:"remark" vulpes:"proto=note"`
+	Secret         string          `bson:"secret"`
+	mgo.Timestamps `bson:",inline"`
+}
+
+func (s *testShipment) C() string                   { return "shipments" }
+func (s *testShipment) Indexes() []mongo.IndexModel { return nil }
+func (s *testShipment) Validate() error             { return nil }
+func (s *testShipment) GetId() any                  { return s.ID }
+func (s *testShipment) SetId(id any)                { s.ID = id.(bson.ObjectID) }
+
+// testClock pairs with google.protobuf.Timestamp.
+type testClock struct {
+	ID      bson.ObjectID `bson:"_id,omitempty"`
+	Seconds int64         `bson:"seconds"`
+	Nanos   int32         `bson:"nanos"`
+}
+
+func (c *testClock) C() string                   { return "clocks" }
+func (c *testClock) Indexes() []mongo.IndexModel { return nil }
+func (c *testClock) Validate() error             { return nil }
+func (c *testClock) GetId() any                  { return c.ID }
+func (c *testClock) SetId(id any)                { c.ID = id.(bson.ObjectID) }
+
+func shipmentDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     typ.Enum(),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			JsonName: proto.String(name),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	lines := field("lines", 5, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.Line")
+	lines.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("shipment.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("PENDING"), Number: proto.Int32(0)},
+				{Name: proto.String("SHIPPED"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("LatLng"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("latitude", 1, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+				field("longitude", 2, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+			}},
+			{Name: proto.String("Line"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("sku", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("qty", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+			}},
+			{Name: proto.String("Shipment"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("user_id", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("status", 3, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".test.Status"),
+				field("location", 4, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".test.LatLng"),
+				lines,
+				field("total", 6, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+				field("note", 7, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("secret", 8, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("created_at", 9, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+			}},
+		},
+	}, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	return file.Messages().ByName("Shipment")
+}
+
+func TestProtoMapping(t *testing.T) {
+	md := shipmentDescriptor(t)
+	created := time.Date(2025, 3, 1, 12, 30, 0, 500, time.UTC)
+	shipment := &testShipment{
+		ID:         bson.NewObjectID(),
+		UserID:     bson.NewObjectID(),
+		Status:     "SHIPPED",
+		Location:   types.NewLocationPoint(121.5, 25.03),
+		Lines:      []testLine{{SKU: "tea", Qty: 2}, {SKU: "mug", Qty: 1}},
+		Total:      12.5,
+		Remark:     "fragile",
+		Secret:     "s3cret",
+		Timestamps: mgo.Timestamps{CreatedAt: created},
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	require.NoError(t, mgo.ToProto(shipment, msg, mgo.WithoutProtoField("Secret")))
+	get := func(name string) protoreflect.Value { return msg.Get(md.Fields().ByName(protoreflect.Name(name))) }
+	assert.Equal(t, shipment.ID.Hex(), get("id").String())
+	assert.Equal(t, shipment.UserID.Hex(), get("user_id").String())
+	assert.Equal(t, protoreflect.EnumNumber(1), get("status").Enum())
+	assert.Equal(t, 25.03, get("location").Message().Get(md.Fields().ByName("location").Message().Fields().ByName("latitude")).Float())
+	assert.Equal(t, 2, get("lines").List().Len())
+	assert.Equal(t, "fragile", get("note").String(), "renamed by the proto= tag")
+	assert.Empty(t, get("secret").String(), "left out by WithoutProtoField")
+	assert.Equal(t, created.Unix(), get("created_at").Message().Get(md.Fields().ByName("created_at").Message().Fields().ByName("seconds")).Int())
+
+	t.Run("Round trip", func(t *testing.T) {
+		back := &testShipment{Secret: "kept"}
+		require.NoError(t, mgo.FromProto(msg, back, mgo.WithoutProtoField("Secret")))
+		shipment.Secret = "kept"
+		assert.Equal(t, shipment, back)
+	})
+
+	t.Run("Unset fields reset the model", func(t *testing.T) {
+		back := &testShipment{Location: types.NewLocationPoint(1, 2), Total: 3}
+		require.NoError(t, mgo.FromProto(dynamicpb.NewMessage(md), back))
+		assert.Equal(t, &testShipment{Status: "PENDING"}, back, "an unset enum is its zero value")
+	})
+
+	t.Run("Invalid ObjectID", func(t *testing.T) {
+		bad := dynamicpb.NewMessage(md)
+		bad.Set(md.Fields().ByName("id"), protoreflect.ValueOfString("nope"))
+		assert.ErrorIs(t, mgo.FromProto(bad, &testShipment{}), mgo.ErrInvalidDocument)
+	})
+
+	t.Run("Unknown override", func(t *testing.T) {
+		err := mgo.ToProto(shipment, dynamicpb.NewMessage(md), mgo.WithProtoName("Total", "amount"))
+		assert.ErrorIs(t, err, mgo.ErrInvalidDocument)
+	})
+
+	t.Run("Type mismatch", func(t *testing.T) {
+		err := mgo.ToProto(shipment, dynamicpb.NewMessage(md), mgo.WithProtoName("Lines", "note"))
+		assert.ErrorIs(t, err, mgo.ErrInvalidDocument)
+	})
+}
+
+func TestToProtos(t *testing.T) {
+	msgs, err := mgo.ToProtos[*timestamppb.Timestamp]([]*testClock{{Seconds: 60, Nanos: 5}, {Seconds: 120}})
+	require.NoError(t, err)
+	if assert.Len(t, msgs, 2) {
+		assert.Equal(t, time.Unix(60, 5).UTC(), msgs[0].AsTime())
+		assert.Equal(t, int64(120), msgs[1].GetSeconds())
+	}
+}
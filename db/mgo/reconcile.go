@@ -0,0 +1,779 @@
+package mgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arwoosa/vulpes/log"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// idIndexName is the name of the mandatory _id index, which is never dropped.
+const idIndexName = "_id_"
+
+// SyncAction is the kind of change a SyncStep applies.
+type SyncAction string
+
+const (
+	SyncCreateCollection SyncAction = "createCollection"
+	SyncModifyCollection SyncAction = "modifyCollection"
+	SyncCreateIndex      SyncAction = "createIndex"
+	SyncDropIndex        SyncAction = "dropIndex"
+	SyncRebuildIndex     SyncAction = "rebuildIndex"
+	SyncModifyIndex      SyncAction = "modifyIndex"
+)
+
+// SyncStep is a single change required to bring a collection in line with its definition.
+type SyncStep struct {
+	Collection string
+	Action     SyncAction
+	// Name is the index name; it is empty for collection-level steps.
+	Name string
+	// Reason explains why the step is needed.
+	Reason string
+
+	apply func(ctx context.Context, db *mongo.Database) error
+	// db is the database holding the collection.
+	db *mongo.Database
+}
+
+// String renders the step for logs.
+func (s SyncStep) String() string {
+	target := s.Collection
+	if s.Name != "" {
+		target += "." + s.Name
+	}
+	return fmt.Sprintf("%s %s: %s", s.Action, target, s.Reason)
+}
+
+// SyncPlan is the ordered list of steps computed by PlanSync.
+type SyncPlan []SyncStep
+
+// String renders the plan one step per line.
+func (p SyncPlan) String() string {
+	lines := make([]string, len(p))
+	for i, s := range p {
+		lines[i] = s.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SyncOption configures SyncIndexes and PlanSync.
+type SyncOption func(*syncConfig)
+
+type syncConfig struct {
+	reconcile    bool
+	dryRun       bool
+	keepObsolete bool
+}
+
+// WithReconcile makes SyncIndexes diff existing indexes and collection options against
+// the registered definitions and apply the resulting plan.
+func WithReconcile() SyncOption {
+	return func(c *syncConfig) {
+		c.reconcile = true
+	}
+}
+
+// WithDryRun makes SyncIndexes compute and log the reconcile plan without applying it.
+func WithDryRun() SyncOption {
+	return func(c *syncConfig) {
+		c.reconcile = true
+		c.dryRun = true
+	}
+}
+
+// WithKeepObsoleteIndexes prevents reconciliation from dropping indexes that are
+// no longer defined in code. A renamed index then keeps its previous name.
+func WithKeepObsoleteIndexes() SyncOption {
+	return func(c *syncConfig) {
+		c.keepObsolete = true
+	}
+}
+
+func newSyncConfig(opts []SyncOption) *syncConfig {
+	cfg := &syncConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// PlanSync computes the steps needed to reconcile every registered collection with
+// its definition, without changing anything.
+func PlanSync(ctx context.Context, opts ...SyncOption) (SyncPlan, error) {
+	if dataStore == nil {
+		return nil, ErrNotConnected
+	}
+	return planSync(ctx, newSyncConfig(opts))
+}
+
+// reconcile plans and, unless in dry-run mode, applies the plan.
+func reconcile(ctx context.Context, cfg *syncConfig) error {
+	plan, err := planSync(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	for _, step := range plan {
+		if cfg.dryRun {
+			log.Info("mongodb sync plan (dry run): " + step.String())
+			continue
+		}
+		log.Info("mongodb sync: " + step.String())
+		if err := step.apply(ctx, step.db); err != nil {
+			return fmt.Errorf("failed to %s: %w", step, errors.Join(ErrCreateIndexFailed, err))
+		}
+	}
+	return nil
+}
+
+func planSync(ctx context.Context, cfg *syncConfig) (SyncPlan, error) {
+	var plan SyncPlan
+	for _, index := range indexes {
+		ds := storeIn(ctx, index)
+		if ds == nil {
+			return nil, fmt.Errorf("collection '%s': %w", index.C(), ErrNotConnected)
+		}
+		coll, err := ds.getCollection(index.C())
+		if err != nil {
+			return nil, fmt.Errorf("collection '%s': %w", index.C(), err)
+		}
+		db := coll.Database()
+		start := len(plan)
+
+		var desiredOpts *CollectionOptions
+		if cs, ok := index.(CollectionSpecifier); ok {
+			desiredOpts = cs.CollectionOptions()
+		}
+		existingOpts, exists, err := collectionInfo(ctx, db, index.C())
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, diffCollection(index.C(), exists, existingOpts, desiredOpts)...)
+
+		desired := make([]indexSpec, 0, len(index.Indexes()))
+		for _, model := range index.Indexes() {
+			spec, err := desiredIndexSpec(model)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index for collection '%s': %w", index.C(), errors.Join(ErrCreateIndexFailed, err))
+			}
+			desired = append(desired, spec)
+		}
+		var existing []indexSpec
+		if exists {
+			existing, err = existingIndexSpecs(ctx, db.Collection(index.C()))
+			if err != nil {
+				return nil, err
+			}
+		}
+		plan = append(plan, diffIndexes(index.C(), existing, desired, !cfg.keepObsolete)...)
+		for i := start; i < len(plan); i++ {
+			plan[i].db = db
+		}
+	}
+	return plan, nil
+}
+
+// collectionInfo returns the options of the named collection and whether it exists.
+func collectionInfo(ctx context.Context, db *mongo.Database, name string) (bson.M, bool, error) {
+	specs, err := db.ListCollectionSpecifications(ctx, bson.D{{Key: "name", Value: name}})
+	if err != nil {
+		return nil, false, errors.Join(ErrListCollectionFailed, err)
+	}
+	if len(specs) == 0 {
+		return nil, false, nil
+	}
+	opts := bson.M{}
+	if len(specs[0].Options) > 0 {
+		if err := bson.Unmarshal(specs[0].Options, &opts); err != nil {
+			return nil, false, errors.Join(ErrListCollectionFailed, err)
+		}
+	}
+	return opts, true, nil
+}
+
+// diffCollection plans collection creation and collMod/convertToCapped changes.
+func diffCollection(name string, exists bool, existing bson.M, desired *CollectionOptions) SyncPlan {
+	if !exists {
+		return SyncPlan{{
+			Collection: name,
+			Action:     SyncCreateCollection,
+			Reason:     "collection does not exist",
+			apply: func(ctx context.Context, db *mongo.Database) error {
+				return db.CreateCollection(ctx, name, createCollectionOptions(desired))
+			},
+		}}
+	}
+	if desired == nil {
+		return nil
+	}
+
+	var plan SyncPlan
+	mod := bson.D{}
+	var reasons []string
+	if desired.Validator != nil && !equalValue(existing["validator"], desired.Validator) {
+		mod = append(mod, bson.E{Key: "validator", Value: desired.Validator})
+		reasons = append(reasons, "validator changed")
+	}
+	if desired.ValidationLevel != "" && existing["validationLevel"] != desired.ValidationLevel {
+		mod = append(mod, bson.E{Key: "validationLevel", Value: desired.ValidationLevel})
+		reasons = append(reasons, "validationLevel changed")
+	}
+	if desired.ValidationAction != "" && existing["validationAction"] != desired.ValidationAction {
+		mod = append(mod, bson.E{Key: "validationAction", Value: desired.ValidationAction})
+		reasons = append(reasons, "validationAction changed")
+	}
+
+	capped, _ := existing["capped"].(bool)
+	switch {
+	case desired.Capped && !capped:
+		plan = append(plan, SyncStep{
+			Collection: name,
+			Action:     SyncModifyCollection,
+			Reason:     "convert to capped collection",
+			apply: func(ctx context.Context, db *mongo.Database) error {
+				return db.RunCommand(ctx, bson.D{
+					{Key: "convertToCapped", Value: name},
+					{Key: "size", Value: desired.SizeInBytes},
+				}).Err()
+			},
+		})
+	case desired.Capped:
+		if !equalValue(existing["size"], desired.SizeInBytes) {
+			mod = append(mod, bson.E{Key: "cappedSize", Value: desired.SizeInBytes})
+			reasons = append(reasons, "capped size changed")
+		}
+		if desired.MaxDocuments > 0 && !equalValue(existing["max"], desired.MaxDocuments) {
+			mod = append(mod, bson.E{Key: "cappedMax", Value: desired.MaxDocuments})
+			reasons = append(reasons, "capped max changed")
+		}
+	case capped:
+		log.Warn("mongodb collection '" + name + "' is capped but its definition is not; capped collections cannot be converted back")
+	}
+
+	if desired.ExpireAfter > 0 {
+		seconds := int64(desired.ExpireAfter / time.Second)
+		if !equalValue(existing["expireAfterSeconds"], seconds) {
+			mod = append(mod, bson.E{Key: "expireAfterSeconds", Value: seconds})
+			reasons = append(reasons, "expireAfterSeconds changed")
+		}
+	}
+	// These options are fixed when the collection is created; changing them means
+	// recreating the collection, which is left to a migration.
+	if desired.TimeSeries != nil && !matchesSubset(existing["timeseries"], timeSeriesDoc(desired.TimeSeries)) {
+		log.Warn("mongodb collection '" + name + "' does not match its time-series definition; recreate it to apply")
+	}
+	if desired.Clustered && existing["clusteredIndex"] == nil {
+		log.Warn("mongodb collection '" + name + "' is not clustered but its definition is; recreate it to apply")
+	}
+	if desired.Collation != nil && !matchesSubset(existing["collation"], collationDoc(desired.Collation)) {
+		log.Warn("mongodb collection '" + name + "' does not match its collation definition; recreate it to apply")
+	}
+
+	if len(mod) > 0 {
+		cmd := append(bson.D{{Key: "collMod", Value: name}}, mod...)
+		plan = append(plan, SyncStep{
+			Collection: name,
+			Action:     SyncModifyCollection,
+			Reason:     strings.Join(reasons, ", "),
+			apply: func(ctx context.Context, db *mongo.Database) error {
+				return db.RunCommand(ctx, cmd).Err()
+			},
+		})
+	}
+	return plan
+}
+
+// createCollectionOptions translates CollectionOptions into driver options.
+func createCollectionOptions(desired *CollectionOptions) *options.CreateCollectionOptionsBuilder {
+	opts := options.CreateCollection()
+	if desired == nil {
+		return opts
+	}
+	if desired.Validator != nil {
+		opts.SetValidator(desired.Validator)
+	}
+	if desired.ValidationLevel != "" {
+		opts.SetValidationLevel(desired.ValidationLevel)
+	}
+	if desired.ValidationAction != "" {
+		opts.SetValidationAction(desired.ValidationAction)
+	}
+	if desired.Capped {
+		opts.SetCapped(true).SetSizeInBytes(desired.SizeInBytes)
+		if desired.MaxDocuments > 0 {
+			opts.SetMaxDocuments(desired.MaxDocuments)
+		}
+	}
+	if ts := desired.TimeSeries; ts != nil {
+		tsOpts := options.TimeSeries().SetTimeField(ts.TimeField)
+		if ts.MetaField != "" {
+			tsOpts.SetMetaField(ts.MetaField)
+		}
+		if ts.Granularity != "" {
+			tsOpts.SetGranularity(ts.Granularity)
+		}
+		opts.SetTimeSeriesOptions(tsOpts)
+	}
+	if desired.Clustered {
+		opts.SetClusteredIndex(bson.D{{Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "unique", Value: true}})
+	}
+	if desired.ExpireAfter > 0 {
+		opts.SetExpireAfterSeconds(int64(desired.ExpireAfter / time.Second))
+	}
+	if desired.Collation != nil {
+		opts.SetCollation(desired.Collation)
+	}
+	return opts
+}
+
+// timeSeriesDoc renders time-series options with the field names used by the server.
+func timeSeriesDoc(ts *TimeSeriesOptions) bson.M {
+	doc := bson.M{"timeField": ts.TimeField}
+	if ts.MetaField != "" {
+		doc["metaField"] = ts.MetaField
+	}
+	if ts.Granularity != "" {
+		doc["granularity"] = ts.Granularity
+	}
+	return doc
+}
+
+// indexSpec is a normalized index definition used for diffing.
+type indexSpec struct {
+	Name    string
+	Keys    bson.D
+	Options bson.M
+
+	model mongo.IndexModel
+}
+
+// desiredIndexSpec normalizes an index model defined in code.
+func desiredIndexSpec(model mongo.IndexModel) (indexSpec, error) {
+	keys, err := toBsonD(model.Keys)
+	if err != nil {
+		return indexSpec{}, err
+	}
+	var args options.IndexOptions
+	if model.Options != nil {
+		for _, set := range model.Options.List() {
+			if err := set(&args); err != nil {
+				return indexSpec{}, err
+			}
+		}
+	}
+	opts := bson.M{}
+	if args.ExpireAfterSeconds != nil {
+		opts["expireAfterSeconds"] = *args.ExpireAfterSeconds
+	}
+	if args.Sparse != nil {
+		opts["sparse"] = *args.Sparse
+	}
+	if args.Unique != nil {
+		opts["unique"] = *args.Unique
+	}
+	if args.Hidden != nil {
+		opts["hidden"] = *args.Hidden
+	}
+	if args.PartialFilterExpression != nil {
+		opts["partialFilterExpression"] = args.PartialFilterExpression
+	}
+	if args.WildcardProjection != nil {
+		opts["wildcardProjection"] = args.WildcardProjection
+	}
+	if args.Weights != nil {
+		opts["weights"] = args.Weights
+	}
+	if args.DefaultLanguage != nil {
+		opts["default_language"] = *args.DefaultLanguage
+	}
+	if args.LanguageOverride != nil {
+		opts["language_override"] = *args.LanguageOverride
+	}
+	if args.SphereVersion != nil {
+		opts["2dsphereIndexVersion"] = *args.SphereVersion
+	}
+	if args.Collation != nil {
+		opts["collation"] = collationDoc(args.Collation)
+	}
+
+	name := ""
+	if args.Name != nil {
+		name = *args.Name
+	} else {
+		name = defaultIndexName(keys)
+	}
+	return indexSpec{Name: name, Keys: keys, Options: opts, model: model}, nil
+}
+
+// existingIndexSpecs lists the indexes of a collection as normalized specs.
+func existingIndexSpecs(ctx context.Context, c *mongo.Collection) ([]indexSpec, error) {
+	cursor, err := c.Indexes().List(ctx)
+	if err != nil {
+		return nil, errors.Join(ErrListCollectionFailed, err)
+	}
+	var raw []bson.D
+	if err := cursor.All(ctx, &raw); err != nil {
+		return nil, errors.Join(ErrListCollectionFailed, err)
+	}
+	specs := make([]indexSpec, 0, len(raw))
+	for _, doc := range raw {
+		spec := indexSpec{Options: bson.M{}}
+		for _, e := range doc {
+			switch e.Key {
+			case "name":
+				spec.Name, _ = e.Value.(string)
+			case "key":
+				spec.Keys, _ = e.Value.(bson.D)
+			case "v", "ns":
+			default:
+				spec.Options[e.Key] = e.Value
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// diffIndexes plans the index changes for one collection. Drops come first so that
+// a rebuilt or renamed index never collides with its previous version. Without
+// dropObsolete, a renamed index keeps its previous name, since the server refuses a
+// second index with the same keys.
+func diffIndexes(collection string, existing, desired []indexSpec, dropObsolete bool) SyncPlan {
+	byName := make(map[string]indexSpec, len(existing))
+	for _, e := range existing {
+		byName[e.Name] = e
+	}
+	wanted := make(map[string]bool, len(desired))
+	for _, d := range desired {
+		wanted[d.Name] = true
+	}
+
+	var drops, changes SyncPlan
+	dropped := map[string]bool{}
+	for _, d := range desired {
+		e, ok := byName[d.Name]
+		if !ok {
+			// An index with the same keys under another, obsolete name would make createIndexes fail.
+			renamed := ""
+			for _, other := range existing {
+				if other.Name != idIndexName && !wanted[other.Name] && !dropped[other.Name] && sameKeys(other.Keys, d.Keys) {
+					renamed = other.Name
+					dropped[other.Name] = true
+					break
+				}
+			}
+			if renamed != "" && !dropObsolete {
+				log.Warn("mongodb index '" + collection + "." + renamed + "' is kept under its previous name instead of " + d.Name + "; drop it to apply the new name")
+				continue
+			}
+			if renamed != "" {
+				drops = append(drops, dropIndexStep(collection, renamed, "renamed to "+d.Name))
+			}
+			changes = append(changes, createIndexStep(collection, d, SyncCreateIndex, "index does not exist"))
+			continue
+		}
+		if !sameKeys(e.Keys, d.Keys) {
+			changes = append(changes, createIndexStep(collection, d, SyncRebuildIndex, "keys changed"))
+			continue
+		}
+		diff := optionsDiff(e.Options, d.Options)
+		if len(diff) == 0 {
+			continue
+		}
+		if modifiable(diff, e.Options) {
+			changes = append(changes, modifyIndexStep(collection, d, "options changed: "+strings.Join(diff, ", ")))
+			continue
+		}
+		changes = append(changes, createIndexStep(collection, d, SyncRebuildIndex, "options changed: "+strings.Join(diff, ", ")))
+	}
+
+	if dropObsolete {
+		for _, e := range existing {
+			if e.Name == idIndexName || wanted[e.Name] || dropped[e.Name] {
+				continue
+			}
+			drops = append(drops, dropIndexStep(collection, e.Name, "index is not defined"))
+		}
+	}
+	return append(drops, changes...)
+}
+
+func dropIndexStep(collection, name, reason string) SyncStep {
+	return SyncStep{
+		Collection: collection,
+		Action:     SyncDropIndex,
+		Name:       name,
+		Reason:     reason,
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection(collection).Indexes().DropOne(ctx, name)
+		},
+	}
+}
+
+func createIndexStep(collection string, spec indexSpec, action SyncAction, reason string) SyncStep {
+	return SyncStep{
+		Collection: collection,
+		Action:     action,
+		Name:       spec.Name,
+		Reason:     reason,
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			view := db.Collection(collection).Indexes()
+			if action == SyncRebuildIndex {
+				if spec.Name == idIndexName {
+					return errors.New("refusing to drop the _id index")
+				}
+				if err := view.DropOne(ctx, spec.Name); err != nil {
+					return err
+				}
+			}
+			_, err := view.CreateOne(ctx, spec.model)
+			return err
+		},
+	}
+}
+
+func modifyIndexStep(collection string, spec indexSpec, reason string) SyncStep {
+	index := bson.D{{Key: "name", Value: spec.Name}}
+	for _, key := range []string{"expireAfterSeconds", "hidden"} {
+		if v, ok := spec.Options[key]; ok {
+			index = append(index, bson.E{Key: key, Value: v})
+		}
+	}
+	return SyncStep{
+		Collection: collection,
+		Action:     SyncModifyIndex,
+		Name:       spec.Name,
+		Reason:     reason,
+		apply: func(ctx context.Context, db *mongo.Database) error {
+			return db.RunCommand(ctx, bson.D{
+				{Key: "collMod", Value: collection},
+				{Key: "index", Value: index},
+			}).Err()
+		},
+	}
+}
+
+// strictIndexOptions must match exactly: their presence on the server alone is a difference.
+var strictIndexOptions = []string{"unique", "sparse", "hidden", "expireAfterSeconds", "partialFilterExpression"}
+
+// optionsDiff returns the sorted names of options that differ. Options the server fills in
+// with defaults (e.g. text index weights) are only compared when defined in code.
+func optionsDiff(existing, desired bson.M) []string {
+	var diff []string
+	for k, dv := range desired {
+		ev, ok := existing[k]
+		if !ok {
+			if dv == false {
+				continue
+			}
+			diff = append(diff, k)
+			continue
+		}
+		if !matchesSubset(ev, dv) {
+			diff = append(diff, k)
+		}
+	}
+	for _, k := range strictIndexOptions {
+		if _, ok := desired[k]; ok {
+			continue
+		}
+		if ev, ok := existing[k]; ok && ev != false {
+			diff = append(diff, k)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// modifiable reports whether the differing options can be changed with collMod
+// instead of rebuilding the index.
+func modifiable(diff []string, existing bson.M) bool {
+	for _, k := range diff {
+		switch k {
+		case "hidden":
+		case "expireAfterSeconds":
+			// collMod can only change the TTL of an index that already has one.
+			if _, ok := existing[k]; !ok {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// sameKeys compares index key documents in order. Text index fields are folded into
+// the _fts/_ftsx pair the server reports.
+func sameKeys(existing, desired bson.D) bool {
+	desired = textIndexKeys(desired)
+	if len(existing) != len(desired) {
+		return false
+	}
+	for i := range existing {
+		if existing[i].Key != desired[i].Key || !equalValue(existing[i].Value, desired[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// textIndexKeys rewrites text fields of a key document the way the server stores them.
+func textIndexKeys(keys bson.D) bson.D {
+	out := make(bson.D, 0, len(keys))
+	text := false
+	for _, k := range keys {
+		if k.Value != "text" {
+			out = append(out, k)
+			continue
+		}
+		if !text {
+			out = append(out, bson.E{Key: "_fts", Value: "text"}, bson.E{Key: "_ftsx", Value: 1})
+			text = true
+		}
+	}
+	return out
+}
+
+// defaultIndexName mirrors the server's naming: field_value pairs joined by underscores.
+func defaultIndexName(keys bson.D) string {
+	parts := make([]string, 0, len(keys)*2)
+	for _, k := range keys {
+		parts = append(parts, k.Key, fmt.Sprint(k.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+// collationDoc renders a collation with the field names used by the server.
+func collationDoc(c *options.Collation) bson.M {
+	doc := bson.M{}
+	if c.Locale != "" {
+		doc["locale"] = c.Locale
+	}
+	if c.CaseLevel {
+		doc["caseLevel"] = true
+	}
+	if c.CaseFirst != "" {
+		doc["caseFirst"] = c.CaseFirst
+	}
+	if c.Strength != 0 {
+		doc["strength"] = c.Strength
+	}
+	if c.NumericOrdering {
+		doc["numericOrdering"] = true
+	}
+	if c.Alternate != "" {
+		doc["alternate"] = c.Alternate
+	}
+	if c.MaxVariable != "" {
+		doc["maxVariable"] = c.MaxVariable
+	}
+	if c.Normalization {
+		doc["normalization"] = true
+	}
+	if c.Backwards {
+		doc["backwards"] = true
+	}
+	return doc
+}
+
+// toBsonD converts any document-like value into a bson.D.
+func toBsonD(v any) (bson.D, error) {
+	if d, ok := v.(bson.D); ok {
+		return d, nil
+	}
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// equalValue compares two BSON values ignoring numeric types and document key order.
+func equalValue(a, b any) bool {
+	return reflect.DeepEqual(normalizeValue(a), normalizeValue(b))
+}
+
+// matchesSubset reports whether existing contains every field of desired with an
+// equal value, recursing into documents. Non-document values must be equal.
+func matchesSubset(existing, desired any) bool {
+	ev, dv := normalizeValue(existing), normalizeValue(desired)
+	dm, ok := dv.(map[string]any)
+	if !ok {
+		return reflect.DeepEqual(ev, dv)
+	}
+	em, ok := ev.(map[string]any)
+	if !ok {
+		return false
+	}
+	for k, v := range dm {
+		if !matchesSubset(em[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeValue converts documents to maps, arrays to []any and numbers to float64.
+func normalizeValue(v any) any {
+	switch x := v.(type) {
+	case bson.D:
+		m := make(map[string]any, len(x))
+		for _, e := range x {
+			m[e.Key] = normalizeValue(e.Value)
+		}
+		return m
+	case bson.M:
+		m := make(map[string]any, len(x))
+		for k, e := range x {
+			m[k] = normalizeValue(e)
+		}
+		return m
+	case map[string]any:
+		return normalizeValue(bson.M(x))
+	case bson.A:
+		return normalizeValue([]any(x))
+	case []any:
+		out := make([]any, len(x))
+		for i, e := range x {
+			out[i] = normalizeValue(e)
+		}
+		return out
+	case int:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case float32:
+		return float64(x)
+	case nil, string, bool, float64:
+		return x
+	default:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+			// Typed slices such as []string compare like the bson.A the server returns.
+			out := make([]any, rv.Len())
+			for i := range out {
+				out[i] = normalizeValue(rv.Index(i).Interface())
+			}
+			return out
+		}
+		if d, err := toBsonD(v); err == nil {
+			return normalizeValue(d)
+		}
+		return v
+	}
+}
@@ -0,0 +1,216 @@
+package mgo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func mustDesired(t *testing.T, model mongo.IndexModel) indexSpec {
+	t.Helper()
+	spec, err := desiredIndexSpec(model)
+	assert.NoError(t, err)
+	return spec
+}
+
+func mustJSONSchema(t *testing.T, model any) bson.M {
+	t.Helper()
+	schema, err := JSONSchema(model)
+	assert.NoError(t, err)
+	return schema
+}
+
+func actions(plan SyncPlan) []string {
+	out := make([]string, len(plan))
+	for i, s := range plan {
+		out[i] = string(s.Action) + ":" + s.Name
+	}
+	return out
+}
+
+func TestDesiredIndexSpec(t *testing.T) {
+	spec := mustDesired(t, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}, {Key: "createdAt", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+	assert.Equal(t, "email_1_createdAt_-1", spec.Name)
+	assert.Equal(t, bson.M{"unique": true}, spec.Options)
+
+	named := mustDesired(t, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetName("by_email"),
+	})
+	assert.Equal(t, "by_email", named.Name)
+}
+
+func TestDiffIndexes(t *testing.T) {
+	idIndex := indexSpec{Name: "_id_", Keys: bson.D{{Key: "_id", Value: int32(1)}}, Options: bson.M{}}
+	emailUnique := mustDesired(t, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+
+	t.Run("In sync", func(t *testing.T) {
+		existing := []indexSpec{idIndex, {Name: "email_1", Keys: bson.D{{Key: "email", Value: int32(1)}}, Options: bson.M{"unique": true}}}
+		assert.Empty(t, diffIndexes("users", existing, []indexSpec{emailUnique}, true))
+	})
+
+	t.Run("Create missing and drop obsolete", func(t *testing.T) {
+		existing := []indexSpec{idIndex, {Name: "name_1", Keys: bson.D{{Key: "name", Value: int32(1)}}, Options: bson.M{}}}
+		plan := diffIndexes("users", existing, []indexSpec{emailUnique}, true)
+		assert.Equal(t, []string{"dropIndex:name_1", "createIndex:email_1"}, actions(plan))
+
+		plan = diffIndexes("users", existing, []indexSpec{emailUnique}, false)
+		assert.Equal(t, []string{"createIndex:email_1"}, actions(plan))
+	})
+
+	t.Run("Option conflict rebuilds", func(t *testing.T) {
+		existing := []indexSpec{idIndex, {Name: "email_1", Keys: bson.D{{Key: "email", Value: int32(1)}}, Options: bson.M{}}}
+		plan := diffIndexes("users", existing, []indexSpec{emailUnique}, true)
+		assert.Equal(t, []string{"rebuildIndex:email_1"}, actions(plan))
+		assert.Contains(t, plan[0].Reason, "unique")
+	})
+
+	t.Run("TTL change modifies", func(t *testing.T) {
+		ttl := mustDesired(t, mongo.IndexModel{
+			Keys:    bson.D{{Key: "createdAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(60),
+		})
+		existing := []indexSpec{idIndex, {Name: "createdAt_1", Keys: bson.D{{Key: "createdAt", Value: int32(1)}}, Options: bson.M{"expireAfterSeconds": int32(30)}}}
+		plan := diffIndexes("events", existing, []indexSpec{ttl}, true)
+		assert.Equal(t, []string{"modifyIndex:createdAt_1"}, actions(plan))
+	})
+
+	t.Run("Renamed index", func(t *testing.T) {
+		named := mustDesired(t, mongo.IndexModel{
+			Keys:    bson.D{{Key: "email", Value: 1}},
+			Options: options.Index().SetName("by_email").SetUnique(true),
+		})
+		existing := []indexSpec{idIndex, {Name: "email_1", Keys: bson.D{{Key: "email", Value: int32(1)}}, Options: bson.M{"unique": true}}}
+		plan := diffIndexes("users", existing, []indexSpec{named}, true)
+		assert.Equal(t, []string{"dropIndex:email_1", "createIndex:by_email"}, actions(plan))
+
+		plan = diffIndexes("users", existing, []indexSpec{named}, false)
+		assert.Empty(t, plan, "WithKeepObsoleteIndexes keeps the previous name")
+	})
+
+	t.Run("Text index keys", func(t *testing.T) {
+		text := mustDesired(t, mongo.IndexModel{Keys: bson.D{{Key: "title", Value: "text"}, {Key: "body", Value: "text"}}})
+		existing := []indexSpec{idIndex, {
+			Name:    "title_text_body_text",
+			Keys:    bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+			Options: bson.M{"weights": bson.D{{Key: "body", Value: int32(1)}, {Key: "title", Value: int32(1)}}, "default_language": "english"},
+		}}
+		assert.Empty(t, diffIndexes("posts", existing, []indexSpec{text}, true))
+	})
+
+	t.Run("Never drops _id_", func(t *testing.T) {
+		plan := diffIndexes("users", []indexSpec{idIndex}, nil, true)
+		assert.Empty(t, plan)
+	})
+}
+
+func TestDiffCollection(t *testing.T) {
+	validator := bson.M{"$jsonSchema": bson.M{"required": bson.A{"email"}}}
+
+	t.Run("Missing collection", func(t *testing.T) {
+		plan := diffCollection("users", false, nil, nil)
+		assert.Equal(t, []string{"createCollection:"}, actions(plan))
+	})
+
+	t.Run("Unmanaged options", func(t *testing.T) {
+		assert.Empty(t, diffCollection("users", true, bson.M{"validator": validator}, nil))
+	})
+
+	t.Run("Validator in sync", func(t *testing.T) {
+		existing := bson.M{"validator": bson.D{{Key: "$jsonSchema", Value: bson.D{{Key: "required", Value: bson.A{"email"}}}}}}
+		assert.Empty(t, diffCollection("users", true, existing, &CollectionOptions{Validator: validator}))
+	})
+
+	t.Run("Generated validator in sync after applying it", func(t *testing.T) {
+		type account struct {
+			Email string   `bson:"email" validate:"required,email"`
+			Tags  []string `bson:"tags" validate:"max=3"`
+			Role  string   `bson:"role" validate:"required,oneof=admin user"`
+		}
+		desired := &CollectionOptions{Validator: bson.M{"$jsonSchema": mustJSONSchema(t, account{})}}
+		// The server returns the validator as it was stored.
+		raw, err := bson.Marshal(desired.Validator)
+		assert.NoError(t, err)
+		var stored bson.D
+		assert.NoError(t, bson.Unmarshal(raw, &stored))
+		assert.Empty(t, diffCollection("accounts", true, bson.M{"validator": stored}, desired))
+		assert.True(t, equalValue(bson.A{"a", "b"}, []string{"a", "b"}))
+	})
+
+	t.Run("Validator and capped changes", func(t *testing.T) {
+		existing := bson.M{"capped": true, "size": int64(1024), "validationLevel": "strict"}
+		plan := diffCollection("logs", true, existing, &CollectionOptions{
+			Validator:       validator,
+			ValidationLevel: "moderate",
+			Capped:          true,
+			SizeInBytes:     4096,
+		})
+		assert.Equal(t, []string{"modifyCollection:"}, actions(plan))
+		assert.Equal(t, "validator changed, validationLevel changed, capped size changed", plan[0].Reason)
+	})
+
+	t.Run("Convert to capped", func(t *testing.T) {
+		plan := diffCollection("logs", true, bson.M{}, &CollectionOptions{Capped: true, SizeInBytes: 4096})
+		assert.Equal(t, []string{"modifyCollection:"}, actions(plan))
+		assert.Equal(t, "convert to capped collection", plan[0].Reason)
+	})
+
+	t.Run("Expire after change", func(t *testing.T) {
+		existing := bson.M{"timeseries": bson.M{"timeField": "at"}, "expireAfterSeconds": int64(3600)}
+		plan := diffCollection("metrics", true, existing, &CollectionOptions{
+			TimeSeries:  &TimeSeriesOptions{TimeField: "at"},
+			ExpireAfter: 24 * time.Hour,
+		})
+		assert.Equal(t, []string{"modifyCollection:"}, actions(plan))
+		assert.Equal(t, "expireAfterSeconds changed", plan[0].Reason)
+	})
+
+	t.Run("Creation options are not modified", func(t *testing.T) {
+		plan := diffCollection("metrics", true, bson.M{}, &CollectionOptions{
+			TimeSeries: &TimeSeriesOptions{TimeField: "at"},
+			Clustered:  true,
+			Collation:  &options.Collation{Locale: "en"},
+		})
+		assert.Empty(t, plan)
+	})
+}
+
+func TestCreateCollectionOptions(t *testing.T) {
+	def := NewCollectDef("metrics", func() []mongo.IndexModel { return nil },
+		WithTimeSeries("at", "device", "minutes"),
+		WithExpireAfter(30*24*time.Hour),
+		WithCollation(&options.Collation{Locale: "en", Strength: 2}),
+	)
+	var args options.CreateCollectionOptions
+	for _, set := range createCollectionOptions(def.(CollectionSpecifier).CollectionOptions()).List() {
+		assert.NoError(t, set(&args))
+	}
+	var ts options.TimeSeriesOptions
+	for _, set := range args.TimeSeriesOptions.List() {
+		assert.NoError(t, set(&ts))
+	}
+	assert.Equal(t, "at", ts.TimeField)
+	assert.Equal(t, "device", *ts.MetaField)
+	assert.Equal(t, "minutes", *ts.Granularity)
+	assert.Equal(t, int64(30*24*3600), *args.ExpireAfterSeconds)
+	assert.Equal(t, "en", args.Collation.Locale)
+	assert.Nil(t, args.ClusteredIndex)
+	assert.Nil(t, args.Capped)
+
+	clustered := NewCollectDef("events", func() []mongo.IndexModel { return nil }, WithClustered())
+	args = options.CreateCollectionOptions{}
+	for _, set := range createCollectionOptions(clustered.(CollectionSpecifier).CollectionOptions()).List() {
+		assert.NoError(t, set(&args))
+	}
+	assert.Equal(t, bson.D{{Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "unique", Value: true}}, args.ClusteredIndex)
+}
@@ -0,0 +1,222 @@
+package mgo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Repository bundles the common operations on one model type. Handlers depend on the
+// interface, so tests can substitute a fake, or a repository created with
+// WithRepositoryDatastore(NewMemoryDatastore()), without touching the global datastore.
+//
+// All reads and writes go through the generic functions, so timestamps, soft delete,
+// encryption, auditing and datastore routing apply as usual.
+type Repository[T DocWithId] interface {
+	// FindById returns the document with the given _id, or ErrNotFound.
+	FindById(ctx context.Context, id any) (T, error)
+	// FindOne returns the first document matching filter, or ErrNotFound.
+	FindOne(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) (T, error)
+	// Find returns all documents matching filter.
+	Find(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) ([]T, error)
+	// List returns the 1-based page of documents matching filter and their total count.
+	List(ctx context.Context, filter any, page, size int64) (*PageResult[T], error)
+	// Count returns the number of documents matching filter.
+	Count(ctx context.Context, filter any) (int64, error)
+	// Exists reports whether any document matches filter.
+	Exists(ctx context.Context, filter any) (bool, error)
+	// Save inserts doc.
+	Save(ctx context.Context, doc T) (T, error)
+	// UpdateById applies update to the document with the given _id.
+	UpdateById(ctx context.Context, id any, update bson.D) (*WriteResult, error)
+	// ReplaceById replaces the stored document with doc.
+	ReplaceById(ctx context.Context, doc T) (*WriteResult, error)
+	// DeleteById deletes the document with the given _id, softly for models embedding SoftDelete.
+	DeleteById(ctx context.Context, id any) (*WriteResult, error)
+}
+
+// RepositoryOption configures a repository created by NewRepository.
+type RepositoryOption[T DocWithId] func(*repository[T])
+
+// WithBeforeSave runs fn before Save and ReplaceById write a document, e.g. to fill
+// derived fields. An error aborts the write.
+func WithBeforeSave[T DocWithId](fn func(ctx context.Context, doc T) error) RepositoryOption[T] {
+	return func(r *repository[T]) {
+		r.beforeSave = append(r.beforeSave, fn)
+	}
+}
+
+// WithAfterFind runs fn on every document returned by FindById, FindOne, Find and List.
+// An error fails the read.
+func WithAfterFind[T DocWithId](fn func(ctx context.Context, doc T) error) RepositoryOption[T] {
+	return func(r *repository[T]) {
+		r.afterFind = append(r.afterFind, fn)
+	}
+}
+
+// WithListSort sets the order of List results. The default is by _id.
+func WithListSort[T DocWithId](sort bson.D) RepositoryOption[T] {
+	return func(r *repository[T]) {
+		r.listSort = sort
+	}
+}
+
+// WithRepositoryDatastore makes the repository use ds instead of the datastore its model
+// is bound to.
+func WithRepositoryDatastore[T DocWithId](ds Datastore) RepositoryOption[T] {
+	return func(r *repository[T]) {
+		r.ds = ds
+	}
+}
+
+type repository[T DocWithId] struct {
+	ds         Datastore
+	beforeSave []func(ctx context.Context, doc T) error
+	afterFind  []func(ctx context.Context, doc T) error
+	listSort   bson.D
+}
+
+// NewRepository returns a Repository for the model type T, which must be a pointer to
+// a struct; other types return ErrInvalidDocument:
+//
+//	users, err := mgo.NewRepository[*User](
+//		mgo.WithBeforeSave(func(ctx context.Context, u *User) error {
+//			u.Email = strings.ToLower(u.Email)
+//			return nil
+//		}),
+//	)
+//	user, err := users.FindById(ctx, id)
+func NewRepository[T DocWithId](opts ...RepositoryOption[T]) (Repository[T], error) {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: repository model %s is not a pointer to a struct", ErrInvalidDocument, t)
+	}
+	r := &repository[T]{listSort: bson.D{{Key: "_id", Value: 1}}}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// model returns a new, empty instance of T.
+func (r *repository[T]) model() T {
+	return reflect.New(reflect.TypeFor[T]().Elem()).Interface().(T)
+}
+
+// context pins the repository's datastore, if any, for calls with the model type.
+func (r *repository[T]) context(ctx context.Context) context.Context {
+	if r.ds == nil {
+		return ctx
+	}
+	return pinStore(ctx, r.model(), r.ds)
+}
+
+func (r *repository[T]) found(ctx context.Context, docs ...T) error {
+	for _, doc := range docs {
+		for _, fn := range r.afterFind {
+			if err := fn(ctx, doc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *repository[T]) saving(ctx context.Context, doc T) error {
+	for _, fn := range r.beforeSave {
+		if err := fn(ctx, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *repository[T]) FindById(ctx context.Context, id any) (T, error) {
+	var zero T
+	doc := r.model()
+	doc.SetId(id)
+	if err := FindById(r.context(ctx), doc); err != nil {
+		return zero, err
+	}
+	if err := r.found(ctx, doc); err != nil {
+		return zero, err
+	}
+	return doc, nil
+}
+
+func (r *repository[T]) FindOne(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) (T, error) {
+	var zero T
+	doc := r.model()
+	if err := FindOne(r.context(ctx), doc, filter, opts...); err != nil {
+		return zero, err
+	}
+	if err := r.found(ctx, doc); err != nil {
+		return zero, err
+	}
+	return doc, nil
+}
+
+func (r *repository[T]) Find(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) ([]T, error) {
+	docs, err := Find(r.context(ctx), r.model(), filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.found(ctx, docs...); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+func (r *repository[T]) List(ctx context.Context, filter any, page, size int64) (*PageResult[T], error) {
+	total, err := r.Count(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	skip, limit := pageWindow(page, size)
+	items, err := r.Find(ctx, filter, options.Find().SetSort(r.listSort).SetSkip(skip).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []T{}
+	}
+	return &PageResult[T]{Items: items, Total: total, Page: max(page, 1), Size: limit}, nil
+}
+
+func (r *repository[T]) Count(ctx context.Context, filter any) (int64, error) {
+	return Count(r.context(ctx), r.model(), filter)
+}
+
+func (r *repository[T]) Exists(ctx context.Context, filter any) (bool, error) {
+	return Exists(r.context(ctx), r.model(), filter)
+}
+
+func (r *repository[T]) Save(ctx context.Context, doc T) (T, error) {
+	if err := r.saving(ctx, doc); err != nil {
+		var zero T
+		return zero, err
+	}
+	return Save(r.context(ctx), doc)
+}
+
+func (r *repository[T]) UpdateById(ctx context.Context, id any, update bson.D) (*WriteResult, error) {
+	doc := r.model()
+	doc.SetId(id)
+	return UpdateById(r.context(ctx), doc, update)
+}
+
+func (r *repository[T]) ReplaceById(ctx context.Context, doc T) (*WriteResult, error) {
+	if err := r.saving(ctx, doc); err != nil {
+		return nil, err
+	}
+	return ReplaceById(r.context(ctx), doc)
+}
+
+func (r *repository[T]) DeleteById(ctx context.Context, id any) (*WriteResult, error) {
+	doc := r.model()
+	doc.SetId(id)
+	return DeleteById(r.context(ctx), doc)
+}
@@ -0,0 +1,148 @@
+package mgo_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// testProduct is managed through a Repository.
+type testProduct struct {
+	ID             bson.ObjectID `bson:"_id,omitempty"`
+	Name           string        `bson:"name"`
+	Slug           string        `bson:"slug"`
+	Price          int           `bson:"price"`
+	mgo.SoftDelete `bson:",inline"`
+}
+
+func (p *testProduct) C() string                   { return "products" }
+func (p *testProduct) Indexes() []mongo.IndexModel { return nil }
+func (p *testProduct) Validate() error             { return nil }
+func (p *testProduct) GetId() any                  { return p.ID }
+func (p *testProduct) SetId(id any)                { p.ID = id.(bson.ObjectID) }
+func (p *testProduct) InitIndex()                  {}
+func (p *testProduct) NewId()                      { p.ID = bson.NewObjectID() }
+
+func TestRepository(t *testing.T) {
+	// The global datastore is never used.
+	restore := mgo.SetDatastore(nil)
+	defer restore()
+	store := mgo.NewMemoryDatastore()
+	var found []string
+	products, err := mgo.NewRepository(
+		mgo.WithRepositoryDatastore[*testProduct](store),
+		mgo.WithBeforeSave(func(ctx context.Context, p *testProduct) error {
+			if p.Name == "" {
+				return errors.New("name is required")
+			}
+			p.Slug = strings.ToLower(strings.ReplaceAll(p.Name, " ", "-"))
+			return nil
+		}),
+		mgo.WithAfterFind(func(ctx context.Context, p *testProduct) error {
+			found = append(found, p.Name)
+			return nil
+		}),
+		mgo.WithListSort[*testProduct](bson.D{{Key: "price", Value: 1}}),
+	)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	var saved []*testProduct
+	for i, name := range []string{"Blue Mug", "Red Mug", "Green Mug"} {
+		p, err := products.Save(ctx, &testProduct{Name: name, Price: 30 - i*10})
+		assert.NoError(t, err)
+		saved = append(saved, p)
+	}
+	assert.Equal(t, "blue-mug", saved[0].Slug)
+
+	t.Run("Before save aborts", func(t *testing.T) {
+		_, err := products.Save(ctx, &testProduct{})
+		assert.EqualError(t, err, "name is required")
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		p, err := products.FindById(ctx, saved[1].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Red Mug", p.Name)
+		assert.Equal(t, []string{"Red Mug"}, found)
+
+		p, err = products.FindOne(ctx, bson.D{{Key: "slug", Value: "green-mug"}})
+		assert.NoError(t, err)
+		assert.Equal(t, 10, p.Price)
+
+		_, err = products.FindById(ctx, bson.NewObjectID())
+		assert.ErrorIs(t, err, mgo.ErrNotFound)
+	})
+
+	t.Run("List, count and exists", func(t *testing.T) {
+		page, err := products.List(ctx, nil, 1, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), page.Total)
+		assert.Len(t, page.Items, 2)
+		assert.Equal(t, "Green Mug", page.Items[0].Name)
+
+		n, err := products.Count(ctx, bson.D{{Key: "price", Value: bson.D{{Key: "$gt", Value: 10}}}})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+
+		exists, err := products.Exists(ctx, bson.D{{Key: "slug", Value: "red-mug"}})
+		assert.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("Update, replace and delete", func(t *testing.T) {
+		_, err := products.UpdateById(ctx, saved[0].ID, bson.D{{Key: "$set", Value: bson.D{{Key: "price", Value: 35}}}})
+		assert.NoError(t, err)
+
+		saved[1].Name = "Dark Red Mug"
+		_, err = products.ReplaceById(ctx, saved[1])
+		assert.NoError(t, err)
+		p, err := products.FindById(ctx, saved[1].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "dark-red-mug", p.Slug)
+
+		_, err = products.DeleteById(ctx, saved[2].ID)
+		assert.NoError(t, err)
+		n, err := products.Count(ctx, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n, "soft-deleted documents are not counted")
+	})
+}
+
+func TestRepositoryRoutesToModelDatastore(t *testing.T) {
+	store := mgo.NewMemoryDatastore()
+	defer mgo.SetDatastore(store)()
+	ctx := context.Background()
+
+	products, err := mgo.NewRepository[*testProduct]()
+	assert.NoError(t, err)
+	_, err = products.Save(ctx, &testProduct{Name: "Cup"})
+	assert.NoError(t, err)
+
+	all, err := mgo.Find(ctx, &testProduct{}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+}
+
+// testValueModel implements DocWithId with value receivers.
+type testValueModel struct{}
+
+func (testValueModel) C() string                   { return "values" }
+func (testValueModel) Indexes() []mongo.IndexModel { return nil }
+func (testValueModel) Validate() error             { return nil }
+func (testValueModel) GetId() any                  { return nil }
+func (testValueModel) SetId(id any)                {}
+func (testValueModel) InitIndex()                  {}
+func (testValueModel) NewId()                      {}
+
+func TestNewRepositoryRequiresPointer(t *testing.T) {
+	_, err := mgo.NewRepository[testValueModel]()
+	assert.ErrorIs(t, err, mgo.ErrInvalidDocument)
+}
@@ -0,0 +1,74 @@
+package mgo
+
+import (
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// WriteResult reports the outcome of an update, upsert, replace or delete.
+type WriteResult struct {
+	// MatchedCount is the number of documents matched by the filter.
+	MatchedCount int64
+	// ModifiedCount is the number of matched documents that were actually changed.
+	ModifiedCount int64
+	// UpsertedID is the _id of the document inserted by an upsert, or nil.
+	UpsertedID any
+	// DeletedCount is the number of documents removed.
+	DeletedCount int64
+}
+
+// newUpdateWriteResult converts the driver's update result.
+func newUpdateWriteResult(r *mongo.UpdateResult) *WriteResult {
+	return &WriteResult{
+		MatchedCount:  r.MatchedCount,
+		ModifiedCount: r.ModifiedCount,
+		UpsertedID:    r.UpsertedID,
+	}
+}
+
+// writeError additionally marks err with ErrDuplicateKey when a unique index was violated.
+func writeError(err error) error {
+	if err != nil && mongo.IsDuplicateKeyError(err) && !errors.Is(err, ErrDuplicateKey) {
+		return fmt.Errorf("%w: %w", ErrDuplicateKey, err)
+	}
+	return err
+}
+
+// readError classifies an error returned by a single-document read: ErrNotFound when
+// nothing matched, ErrReadFailed otherwise. The driver error stays in the chain.
+func readError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return fmt.Errorf("%w: %w", ErrReadFailed, err)
+}
+
+// requireMatch returns ErrNotFound when a single-document update matched nothing.
+func requireMatch(result *WriteResult, err error) (*WriteResult, error) {
+	if err != nil {
+		return result, writeError(err)
+	}
+	if result == nil {
+		result = &WriteResult{}
+	}
+	if result.MatchedCount == 0 && result.UpsertedID == nil {
+		return result, fmt.Errorf("%w: no document matched the filter", ErrNotFound)
+	}
+	return result, nil
+}
+
+// requireDelete returns ErrNotFound when a single-document delete removed nothing.
+func requireDelete(result *WriteResult, err error) (*WriteResult, error) {
+	if err != nil {
+		return result, writeError(err)
+	}
+	if result == nil {
+		result = &WriteResult{}
+	}
+	if result.DeletedCount == 0 {
+		return result, fmt.Errorf("%w: no document matched the filter", ErrNotFound)
+	}
+	return result, nil
+}
@@ -0,0 +1,74 @@
+package mgo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"google.golang.org/grpc/codes"
+)
+
+func TestWriteResult(t *testing.T) {
+	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+	defer restore()
+	seedUsers(t)
+	ctx := context.Background()
+	setAge := bson.D{{Key: "$set", Value: bson.D{{Key: "age", Value: 30}}}}
+
+	t.Run("Matched but unchanged", func(t *testing.T) {
+		result, err := mgo.UpdateOne(ctx, &testUser{}, bson.D{{Key: "name", Value: "Peter"}}, setAge)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), result.MatchedCount)
+		assert.Equal(t, int64(0), result.ModifiedCount)
+	})
+
+	t.Run("No match", func(t *testing.T) {
+		result, err := mgo.UpdateOne(ctx, &testUser{}, bson.D{{Key: "name", Value: "Nobody"}}, setAge)
+		assert.ErrorIs(t, err, mgo.ErrNotFound)
+		assert.Equal(t, int64(0), result.MatchedCount)
+
+		_, err = mgo.UpdateById(ctx, &testUser{ID: bson.NewObjectID()}, setAge)
+		assert.ErrorIs(t, err, mgo.ErrNotFound)
+		_, err = mgo.ReplaceById(ctx, &testUser{ID: bson.NewObjectID(), Name: "Ghost"})
+		assert.ErrorIs(t, err, mgo.ErrNotFound)
+		_, err = mgo.DeleteById(ctx, &testUser{ID: bson.NewObjectID()})
+		assert.ErrorIs(t, err, mgo.ErrNotFound)
+		_, err = mgo.DeleteById(ctx, &testArticle{ID: bson.NewObjectID()})
+		assert.ErrorIs(t, err, mgo.ErrNotFound, "soft delete")
+
+		err = mgo.FindOne(ctx, &testUser{}, bson.D{{Key: "name", Value: "Nobody"}})
+		assert.ErrorIs(t, err, mgo.ErrNotFound)
+		assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	})
+
+	t.Run("Many operations report zero matches without an error", func(t *testing.T) {
+		result, err := mgo.UpdateMany(ctx, &testUser{}, bson.D{{Key: "name", Value: "Nobody"}}, setAge)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), result.MatchedCount)
+
+		result, err = mgo.DeleteMany(ctx, &testUser{}, bson.D{{Key: "name", Value: "Nobody"}})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), result.DeletedCount)
+	})
+}
+
+func TestToStatus(t *testing.T) {
+	restore := mgo.SetDatastore(mgo.NewMemoryDatastore())
+	defer restore()
+	ctx := context.Background()
+
+	err := mgo.FindOne(ctx, &testUser{}, bson.D{{Key: "name", Value: "Nobody"}})
+	assert.Equal(t, codes.NotFound, mgo.ToStatus(err).Code())
+
+	_, err = mgo.Save(ctx, &testAccount{Email: "a@example.com"})
+	assert.NoError(t, err)
+	_, err = mgo.Save(ctx, &testAccount{Email: "a@example.com"})
+	assert.Equal(t, codes.AlreadyExists, mgo.ToStatus(err).Code())
+
+	assert.Equal(t, codes.Internal, mgo.ToStatus(mgo.ErrWriteFailed).Code())
+	assert.Nil(t, mgo.ToStatus(nil))
+}
@@ -4,38 +4,52 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"reflect"
 )
 
+// Save inserts doc into its collection.
+// Models embedding Timestamps get their CreatedAt and UpdatedAt fields set before the insert.
+// Fields tagged with `vulpes:"encrypt"` are stored encrypted; doc keeps the plaintexts.
+// Models implementing BeforeInserter and AfterInserter have their hooks run around the insert.
 func Save[T DocInter](ctx context.Context, doc T) (T, error) {
 	var zero T
-	if dataStore == nil {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
 		return zero, ErrNotConnected
 	}
-	newDoc, err := dataStore.Save(ctx, doc)
+	if err := stampTenant(ctx, doc); err != nil {
+		return zero, err
+	}
+	if !isNilDoc(doc) {
+		if err := beforeInsert(ctx, doc); err != nil {
+			return zero, err
+		}
+	}
+	if err := validateDoc(doc); err != nil {
+		return zero, err
+	}
+	stampInsert(doc, nowFunc())
+	restore, err := encryptDoc(ctx, doc)
+	if err != nil {
+		return zero, err
+	}
+	newDoc, err := ds.Save(ctx, doc)
+	restore()
 	if err != nil {
-		return zero, fmt.Errorf("%w: %w", ErrWriteFailed, err)
+		return zero, writeError(err)
 	}
 	result, ok := newDoc.(T)
 	if !ok {
 		return zero, fmt.Errorf("%w: failed to cast to %T", ErrWriteFailed, doc)
 	}
-	return result, nil
+	return result, afterInsert(ctx, result)
 }
 
 func (m *mongoStore) Save(ctx context.Context, doc DocInter) (DocInter, error) {
-	// 1. Restore the nil check for robustness.
-	if v := reflect.ValueOf(doc); v.Kind() == reflect.Ptr && v.IsNil() {
-		return nil, fmt.Errorf("%w: %w", ErrInvalidDocument, errors.New("document cannot be nil"))
-	}
-
-	// 2. Restore the validation check.
-	if err := doc.Validate(); err != nil {
-		return doc, fmt.Errorf("%w: %w", ErrInvalidDocument, err)
+	if err := checkNilDoc(doc); err != nil {
+		return nil, err
 	}
 
-	// 3. Perform the database operation.
-	c := m.getCollection(doc.C())
+	c := m.collection(ctx, doc.C())
 	result, err := c.InsertOne(ctx, doc)
 	if err != nil {
 		return doc, fmt.Errorf("%w: %w", ErrWriteFailed, err)
@@ -43,3 +57,95 @@ func (m *mongoStore) Save(ctx context.Context, doc DocInter) (DocInter, error) {
 	doc.SetId(result.InsertedID)
 	return doc, nil
 }
+
+// InsertMany inserts docs into their collection in a single request.
+// Every document is validated before anything is written; the first invalid one
+// aborts the call with ErrInvalidDocument. Models embedding Timestamps are stamped
+// and the generated _ids are set on the documents. BeforeInsert hooks run before the
+// validation and AfterInsert hooks once all documents are written.
+func InsertMany[T DocInter](ctx context.Context, docs []T) ([]T, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+	ds := storeIn(ctx, docs[0])
+	if ds == nil {
+		return nil, ErrNotConnected
+	}
+	now := nowFunc()
+	inters := make([]DocInter, len(docs))
+	// The documents get their plaintexts back right after the write, before AfterInsert.
+	restores := make([]func(), 0, len(docs))
+	restoreAll := func() {
+		for _, restore := range restores {
+			restore()
+		}
+		restores = nil
+	}
+	defer restoreAll()
+	for i, doc := range docs {
+		if err := stampTenant(ctx, doc); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if err := beforeInsert(ctx, doc); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if err := validateDoc(doc); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		stampInsert(doc, now)
+		restore, err := encryptDoc(ctx, doc)
+		restores = append(restores, restore)
+		if err != nil {
+			return nil, err
+		}
+		inters[i] = doc
+	}
+	ids, err := ds.InsertMany(ctx, docs[0].C(), inters)
+	restoreAll()
+	if err != nil {
+		return nil, writeError(err)
+	}
+	for i, id := range ids {
+		docs[i].SetId(id)
+	}
+	for _, doc := range docs {
+		if err := afterInsert(ctx, doc); err != nil {
+			return docs, err
+		}
+	}
+	return docs, nil
+}
+
+// validateDoc rejects nil documents and documents failing their own validation.
+// The generic functions call it on the plaintext document, before encryptDoc.
+func validateDoc(doc DocInter) error {
+	if err := checkNilDoc(doc); err != nil {
+		return err
+	}
+	if err := doc.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidDocument, err)
+	}
+	return nil
+}
+
+// checkNilDoc rejects nil documents. The datastores only check this, since the
+// generic functions validate documents before encrypting them.
+func checkNilDoc(doc DocInter) error {
+	if isNilDoc(doc) {
+		return fmt.Errorf("%w: %w", ErrInvalidDocument, errors.New("document cannot be nil"))
+	}
+	return nil
+}
+
+func (m *mongoStore) InsertMany(ctx context.Context, collection string, docs []DocInter) ([]any, error) {
+	for i, doc := range docs {
+		if err := checkNilDoc(doc); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+	result, err := m.collection(ctx, collection).InsertMany(ctx, docs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWriteFailed, err)
+	}
+	return result.InsertedIDs, nil
+}
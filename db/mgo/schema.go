@@ -0,0 +1,308 @@
+package mgo
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var (
+	typeTime       = reflect.TypeOf(time.Time{})
+	typeObjectID   = reflect.TypeOf(bson.ObjectID{})
+	typeDecimal128 = reflect.TypeOf(bson.Decimal128{})
+	typeBytes      = reflect.TypeOf([]byte(nil))
+)
+
+// emailPattern is a deliberately loose pattern; the Go validator remains the source of truth.
+const emailPattern = `^[^@\s]+@[^@\s]+$`
+
+// JSONSchema derives a MongoDB $jsonSchema document from a model struct.
+// Field names come from bson tags, bsonType from the Go types, and constraints from
+// the validate tags understood by the validate package:
+//
+//   - required → listed in "required"
+//   - min, max, len, gte, lte → length, range or item limits depending on the type
+//   - gt, lt → exclusive range limits on numbers
+//   - oneof → enum
+//   - email → pattern
+//
+// Constraints of fields tagged with validate:"omitempty" are skipped, since empty values
+// are stored and would otherwise be rejected. Tags after "dive" are ignored. Fields tagged
+// with vulpes:"encrypt" only get their bsonType and "required".
+func JSONSchema(model any) (bson.M, error) {
+	t := reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: json schema requires a struct, got %T", ErrInvalidDocument, model)
+	}
+	return structSchema(t, map[reflect.Type]bool{}), nil
+}
+
+// WithJSONSchema sets the collection validator to the $jsonSchema derived from model.
+// Combine it with WithValidation to choose the validationLevel and validationAction.
+// It panics if model is not a struct, since this is a programming error.
+func WithJSONSchema(model any) CollectOption {
+	schema, err := JSONSchema(model)
+	if err != nil {
+		panic(err)
+	}
+	return WithValidator(bson.M{"$jsonSchema": schema})
+}
+
+// structSchema builds an object schema. seen guards against recursive types.
+func structSchema(t reflect.Type, seen map[reflect.Type]bool) bson.M {
+	schema := bson.M{"bsonType": "object"}
+	if seen[t] {
+		return schema
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	properties := bson.M{}
+	var required []string
+	collectFields(t, seen, properties, &required)
+	if len(properties) > 0 {
+		schema["properties"] = properties
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// collectFields adds the properties of t to properties, flattening inline structs.
+func collectFields(t reflect.Type, seen map[reflect.Type]bool, properties bson.M, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, inline, skip := bsonFieldName(f)
+		if skip {
+			continue
+		}
+		ft := f.Type
+		if inline {
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				collectFields(ft, seen, properties, required)
+			}
+			continue
+		}
+
+		prop := typeSchema(ft, seen)
+		if prop == nil {
+			continue
+		}
+		rules := strings.Split(f.Tag.Get("validate"), ",")
+		constraints := prop
+		if parseTag(f).has("encrypt") {
+			// The rules hold for the plaintext, not the stored ciphertext, so only the type is checked.
+			constraints = bson.M{}
+		}
+		if applyValidateRules(constraints, ft, rules) {
+			*required = append(*required, name)
+		}
+		properties[name] = prop
+	}
+}
+
+// bsonFieldName returns the stored field name, whether the field is inlined and
+// whether it is skipped, following the driver's struct tag rules.
+func bsonFieldName(f reflect.StructField) (name string, inline bool, skip bool) {
+	// Untagged fields, including embedded structs, are stored under their lowercased name.
+	tag := f.Tag.Get("bson")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	for _, p := range parts[1:] {
+		if p == "inline" {
+			inline = true
+		}
+	}
+	name = parts[0]
+	if name == "" {
+		name = strings.ToLower(f.Name)
+	}
+	return name, inline, false
+}
+
+// typeSchema maps a Go type to a schema. It returns nil for types that cannot be
+// described, such as interfaces, which are left unconstrained.
+func typeSchema(t reflect.Type, seen map[reflect.Type]bool) bson.M {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+	var schema bson.M
+	switch {
+	case t == typeTime:
+		schema = bson.M{"bsonType": "date"}
+	case t == typeObjectID:
+		schema = bson.M{"bsonType": "objectId"}
+	case t == typeDecimal128:
+		schema = bson.M{"bsonType": "decimal"}
+	case t == typeBytes:
+		schema = bson.M{"bsonType": "binData"}
+	default:
+		switch t.Kind() {
+		case reflect.String:
+			schema = bson.M{"bsonType": "string"}
+		case reflect.Bool:
+			schema = bson.M{"bsonType": "bool"}
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+			schema = bson.M{"bsonType": "int"}
+		case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+			// The driver stores these as int32 when the value fits.
+			schema = bson.M{"bsonType": bson.A{"int", "long"}}
+		case reflect.Float32, reflect.Float64:
+			schema = bson.M{"bsonType": "double"}
+		case reflect.Slice, reflect.Array:
+			schema = bson.M{"bsonType": "array"}
+			if items := typeSchema(t.Elem(), seen); items != nil {
+				schema["items"] = items
+			}
+			// nil slices are stored as null.
+			nullable = nullable || t.Kind() == reflect.Slice
+		case reflect.Map:
+			schema = bson.M{"bsonType": "object"}
+			nullable = true
+		case reflect.Struct:
+			schema = structSchema(t, seen)
+		default:
+			return nil
+		}
+	}
+	if nullable {
+		schema["bsonType"] = appendBsonType(schema["bsonType"], "null")
+	}
+	return schema
+}
+
+// appendBsonType adds an alternative to a bsonType value.
+func appendBsonType(current any, extra string) bson.A {
+	switch v := current.(type) {
+	case bson.A:
+		return append(v, extra)
+	default:
+		return bson.A{v, extra}
+	}
+}
+
+// applyValidateRules translates validate tag rules into schema keywords and reports
+// whether the field is required.
+func applyValidateRules(prop bson.M, t reflect.Type, rules []string) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	required := false
+	for _, r := range rules {
+		if r == "omitempty" {
+			return false
+		}
+	}
+	for _, r := range rules {
+		if r == "dive" {
+			break
+		}
+		key, param, _ := strings.Cut(r, "=")
+		switch key {
+		case "required":
+			required = true
+		case "email":
+			if t.Kind() == reflect.String {
+				prop["pattern"] = emailPattern
+			}
+		case "oneof":
+			if enum := oneOfEnum(t, param); enum != nil {
+				prop["enum"] = enum
+			}
+		case "len":
+			setLimit(prop, t, "min", param)
+			setLimit(prop, t, "max", param)
+		case "min", "gte":
+			setLimit(prop, t, "min", param)
+		case "max", "lte":
+			setLimit(prop, t, "max", param)
+		case "gt":
+			if isNumber(t) && setLimit(prop, t, "min", param) {
+				prop["exclusiveMinimum"] = true
+			}
+		case "lt":
+			if isNumber(t) && setLimit(prop, t, "max", param) {
+				prop["exclusiveMaximum"] = true
+			}
+		}
+	}
+	return required
+}
+
+// setLimit sets the minimum/maximum keyword matching the field type.
+func setLimit(prop bson.M, t reflect.Type, bound string, param string) bool {
+	var keyword string
+	switch {
+	case t.Kind() == reflect.String:
+		keyword = bound + "Length"
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		keyword = bound + "Items"
+	case isNumber(t):
+		keyword = bound + "imum"
+	default:
+		return false
+	}
+	if isNumber(t) {
+		v, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return false
+		}
+		prop[keyword] = v
+		return true
+	}
+	v, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		return false
+	}
+	prop[keyword] = v
+	return true
+}
+
+// oneOfEnum parses the space separated values of a oneof rule according to the field type.
+func oneOfEnum(t reflect.Type, param string) bson.A {
+	values := strings.Fields(param)
+	enum := make(bson.A, 0, len(values))
+	for _, v := range values {
+		switch {
+		case t.Kind() == reflect.String:
+			enum = append(enum, v)
+		case isNumber(t):
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil
+			}
+			enum = append(enum, n)
+		default:
+			return nil
+		}
+	}
+	return enum
+}
+
+func isNumber(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package mgo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type schemaAddress struct {
+	City string `bson:"city" validate:"required"`
+}
+
+type schemaModel struct {
+	mgo.Index      `bson:"-"`
+	mgo.ObjectID   `bson:",inline"`
+	mgo.Timestamps `bson:",inline"`
+	Email          string         `bson:"email" validate:"required,email"`
+	Name           string         `bson:"name" validate:"min=2,max=50"`
+	Nickname       string         `bson:"nickname" validate:"omitempty,min=3"`
+	Age            int            `bson:"age" validate:"gte=0,lte=150"`
+	Score          float64        `bson:"score" validate:"gt=0"`
+	Role           string         `bson:"role" validate:"oneof=admin member"`
+	Tags           []string       `bson:"tags" validate:"max=5,dive,min=1"`
+	Address        *schemaAddress `bson:"address"`
+	Birthday       time.Time      `bson:"birthday"`
+	Extra          any            `bson:"extra"`
+	secret         string
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema, err := mgo.JSONSchema(&schemaModel{})
+	assert.NoError(t, err)
+	assert.Equal(t, "object", schema["bsonType"])
+	assert.Equal(t, []string{"email"}, schema["required"])
+
+	props := schema["properties"].(bson.M)
+	assert.Equal(t, bson.M{"bsonType": "objectId"}, props["_id"])
+	assert.Equal(t, bson.M{"bsonType": "date"}, props["createdAt"])
+	assert.Equal(t, bson.M{"bsonType": "string", "pattern": `^[^@\s]+@[^@\s]+$`}, props["email"])
+	assert.Equal(t, bson.M{"bsonType": "string", "minLength": int64(2), "maxLength": int64(50)}, props["name"])
+	assert.Equal(t, bson.M{"bsonType": "string"}, props["nickname"])
+	assert.Equal(t, bson.M{"bsonType": bson.A{"int", "long"}, "minimum": float64(0), "maximum": float64(150)}, props["age"])
+	assert.Equal(t, bson.M{"bsonType": "double", "minimum": float64(0), "exclusiveMinimum": true}, props["score"])
+	assert.Equal(t, bson.M{"bsonType": "string", "enum": bson.A{"admin", "member"}}, props["role"])
+	assert.Equal(t, bson.M{"bsonType": bson.A{"array", "null"}, "items": bson.M{"bsonType": "string"}, "maxItems": int64(5)}, props["tags"])
+	assert.Equal(t, bson.M{
+		"bsonType":   bson.A{"object", "null"},
+		"properties": bson.M{"city": bson.M{"bsonType": "string"}},
+		"required":   []string{"city"},
+	}, props["address"])
+	assert.NotContains(t, props, "extra")
+	assert.NotContains(t, props, "secret")
+	assert.NotContains(t, props, "index")
+}
+
+func TestJSONSchemaEncryptedField(t *testing.T) {
+	type contact struct {
+		Email string  `bson:"email" validate:"required,email,max=50" vulpes:"encrypt,deterministic"`
+		Phone *string `bson:"phone" validate:"min=8" vulpes:"encrypt"`
+	}
+	schema, err := mgo.JSONSchema(&contact{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"email"}, schema["required"])
+	props := schema["properties"].(bson.M)
+	assert.Equal(t, bson.M{"bsonType": "string"}, props["email"], "the ciphertext is no email")
+	assert.Equal(t, bson.M{"bsonType": bson.A{"string", "null"}}, props["phone"])
+}
+
+func TestJSONSchemaRejectsNonStruct(t *testing.T) {
+	_, err := mgo.JSONSchema("not a struct")
+	assert.ErrorIs(t, err, mgo.ErrInvalidDocument)
+}
+
+func TestWithJSONSchema(t *testing.T) {
+	def := mgo.NewCollectDef("schema_models", func() []mongo.IndexModel { return nil },
+		mgo.WithJSONSchema(&schemaModel{}),
+		mgo.WithValidation("moderate", "warn"),
+	)
+	opts := def.(mgo.CollectionSpecifier).CollectionOptions()
+	assert.Contains(t, opts.Validator, "$jsonSchema")
+	assert.Equal(t, "moderate", opts.ValidationLevel)
+	assert.Equal(t, "warn", opts.ValidationAction)
+}
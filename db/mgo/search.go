@@ -0,0 +1,204 @@
+package mgo
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// WithTextIndex adds a text index over the given string fields, as required by Text and
+// TextSearch. A collection can have only one text index, so list all searchable fields.
+func WithTextIndex(fields ...string) CollectOption {
+	return func(c *collectDef) {
+		keys := make(bson.D, len(fields))
+		for i, field := range fields {
+			keys[i] = bson.E{Key: field, Value: "text"}
+		}
+		c.indexes = append(c.indexes, mongo.IndexModel{Keys: keys})
+	}
+}
+
+// TextOption configures a $text query.
+type TextOption func(spec *bson.D)
+
+// WithTextLanguage selects the language used for stemming and stop words, e.g. "none"
+// to match words exactly; by default the language of the text index is used.
+func WithTextLanguage(language string) TextOption {
+	return func(spec *bson.D) {
+		*spec = append(*spec, bson.E{Key: "$language", Value: language})
+	}
+}
+
+// WithTextCaseSensitive makes the query distinguish upper and lower case.
+func WithTextCaseSensitive() TextOption {
+	return func(spec *bson.D) {
+		*spec = append(*spec, bson.E{Key: "$caseSensitive", Value: true})
+	}
+}
+
+// WithTextDiacriticSensitive makes the query distinguish diacritics, e.g. é from e.
+func WithTextDiacriticSensitive() TextOption {
+	return func(spec *bson.D) {
+		*spec = append(*spec, bson.E{Key: "$diacriticSensitive", Value: true})
+	}
+}
+
+// Text returns a filter condition matching documents whose text index contains any of
+// the words of search. Quoted phrases must match as a whole and words prefixed with -
+// exclude documents:
+//
+//	filter := bson.D{mgo.Text(`mug "dish washer" -plastic`), {Key: "inStock", Value: true}}
+func Text(search string, opts ...TextOption) bson.E {
+	spec := bson.D{{Key: "$search", Value: search}}
+	for _, opt := range opts {
+		opt(&spec)
+	}
+	return bson.E{Key: "$text", Value: spec}
+}
+
+// TextScore returns the relevance of a $text match as field. Use it in a projection to
+// decode the score into a model field, and in a sort to return the best matches first:
+//
+//	score := bson.D{mgo.TextScore("score")}
+//	products, err := mgo.Find(ctx, &Product{}, bson.D{mgo.Text("mug")},
+//		options.Find().SetProjection(score).SetSort(score))
+func TextScore(field string) bson.E {
+	return bson.E{Key: field, Value: bson.D{{Key: "$meta", Value: "textScore"}}}
+}
+
+// Searcher produces the leading stages of a search pipeline, so that the same query
+// code can run against different search engines. TextSearch uses a text index and works
+// on every deployment; AtlasSearch uses the $search stage of an Atlas Search index.
+type Searcher interface {
+	// SearchStages returns the stages selecting the matches, best first, and storing
+	// their relevance in scoreField unless it is empty.
+	SearchStages(scoreField string) []bson.D
+}
+
+type textSearcher struct {
+	text bson.E
+}
+
+// TextSearch returns a Searcher running a $text query, see Text.
+func TextSearch(search string, opts ...TextOption) Searcher {
+	return textSearcher{text: Text(search, opts...)}
+}
+
+func (s textSearcher) SearchStages(scoreField string) []bson.D {
+	sortField := scoreField
+	if sortField == "" {
+		sortField = "score"
+	}
+	stages := []bson.D{
+		{{Key: "$match", Value: bson.D{s.text}}},
+		{{Key: "$sort", Value: bson.D{TextScore(sortField)}}},
+	}
+	if scoreField != "" {
+		stages = append(stages, bson.D{{Key: "$addFields", Value: bson.D{TextScore(scoreField)}}})
+	}
+	return stages
+}
+
+type atlasSearcher struct {
+	index    string
+	operator bson.D
+}
+
+// AtlasSearch returns a Searcher running operator with the $search stage against the
+// Atlas Search index named index, or the index named "default" when empty:
+//
+//	mgo.AtlasSearch("products", mgo.AtlasText("mug", "name", "description"))
+//
+// operator is any Atlas Search operator, such as text, autocomplete or compound.
+func AtlasSearch(index string, operator bson.D) Searcher {
+	return atlasSearcher{index: index, operator: operator}
+}
+
+func (s atlasSearcher) SearchStages(scoreField string) []bson.D {
+	spec := bson.D{}
+	if s.index != "" {
+		spec = append(spec, bson.E{Key: "index", Value: s.index})
+	}
+	stages := []bson.D{{{Key: "$search", Value: append(spec, s.operator...)}}}
+	if scoreField != "" {
+		stages = append(stages, bson.D{{Key: "$addFields", Value: bson.D{
+			{Key: scoreField, Value: bson.D{{Key: "$meta", Value: "searchScore"}}},
+		}}})
+	}
+	return stages
+}
+
+// AtlasText returns an Atlas Search text operator matching query in the given fields.
+func AtlasText(query string, paths ...string) bson.D {
+	var path any = paths
+	if len(paths) == 1 {
+		path = paths[0]
+	}
+	return bson.D{{Key: "text", Value: bson.D{
+		{Key: "query", Value: query},
+		{Key: "path", Value: path},
+	}}}
+}
+
+// Search appends the stages of s, storing the relevance of each match in scoreField
+// unless it is empty. It must come first, so that models implementing MgoAggregate can
+// serve search results through PipeFind:
+//
+//	func (p *ProductSearch) GetPipeline(q bson.M) mongo.Pipeline {
+//		return mgo.NewPipeline().
+//			Search(mgo.TextSearch(q["keyword"].(string)), "score").
+//			Limit(20).
+//			Build()
+//	}
+func (p *Pipeline) Search(s Searcher, scoreField string) *Pipeline {
+	for _, stage := range s.SearchStages(scoreField) {
+		p.Stage(stage)
+	}
+	return p
+}
+
+// Search returns the documents of doc's collection matched by s, best first and at most
+// limit unless it is zero. The relevance is stored in scoreField, so a model field such as
+//
+//	Score float64 `bson:"score,omitempty"`
+//
+// receives it when scoreField is "score". filter further restricts the matches like in
+// Find, and soft-deleted documents are excluded unless ctx is wrapped with WithDeleted.
+func Search[T DocInter](ctx context.Context, doc T, s Searcher, scoreField string, filter any, limit int64) ([]T, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return nil, ErrNotConnected
+	}
+	filter, err := tenantFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, err
+	}
+	filter, err = encryptFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := NewPipeline().Search(s, scoreField)
+	if scoped := scopeFilter(ctx, doc, filter); scoped != nil {
+		pipeline.Match(scoped)
+	}
+	if limit > 0 {
+		pipeline.Limit(limit)
+	}
+	cursor, err := ds.PipeFind(ctx, doc.C(), pipeline.Build())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	var result []T
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	if err := decryptDocs(ctx, result); err != nil {
+		return nil, err
+	}
+	if err := afterFind(ctx, result...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,99 @@
+package mgo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// testBook receives the relevance computed by a search.
+type testBook struct {
+	ID             bson.ObjectID `bson:"_id,omitempty"`
+	Title          string        `bson:"title"`
+	Score          float64       `bson:"score,omitempty"`
+	mgo.SoftDelete `bson:",inline"`
+}
+
+func (b *testBook) C() string                   { return "books" }
+func (b *testBook) Indexes() []mongo.IndexModel { return nil }
+func (b *testBook) Validate() error             { return nil }
+func (b *testBook) GetId() any                  { return b.ID }
+func (b *testBook) SetId(id any)                { b.ID = id.(bson.ObjectID) }
+
+func TestTextQueries(t *testing.T) {
+	assert.Equal(t, bson.E{Key: "$text", Value: bson.D{
+		{Key: "$search", Value: `"green tea" -milk`},
+		{Key: "$language", Value: "none"},
+		{Key: "$caseSensitive", Value: true},
+	}}, mgo.Text(`"green tea" -milk`, mgo.WithTextLanguage("none"), mgo.WithTextCaseSensitive()))
+
+	assert.Equal(t, bson.E{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}}, mgo.TextScore("score"))
+
+	def := mgo.NewCollectDef("books", func() []mongo.IndexModel { return nil }, mgo.WithTextIndex("title", "summary"))
+	assert.Equal(t, bson.D{{Key: "title", Value: "text"}, {Key: "summary", Value: "text"}}, def.Indexes()[0].Keys)
+}
+
+func TestSearch(t *testing.T) {
+	search := func(t *testing.T, s mgo.Searcher) mongo.Pipeline {
+		t.Helper()
+		var pipeline mongo.Pipeline
+		mockDB := &mgo.MockDatastore{
+			OnPipeFind: func(ctx context.Context, collection string, p mongo.Pipeline) (*mongo.Cursor, error) {
+				assert.Equal(t, "books", collection)
+				pipeline = p
+				return mgo.NewOnPipeFindMock(
+					bson.M{"title": "Tea", "score": 2.5},
+					bson.M{"title": "Teapots", "score": 1.0},
+				)(ctx, collection, p)
+			},
+		}
+		defer mgo.SetDatastore(mockDB)()
+
+		books, err := mgo.Search(context.Background(), &testBook{}, s, "score", bson.D{{Key: "lang", Value: "en"}}, 10)
+		assert.NoError(t, err)
+		if assert.Len(t, books, 2) {
+			assert.Equal(t, 2.5, books[0].Score)
+		}
+		return pipeline
+	}
+	tail := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "lang", Value: "en"},
+			{Key: mgo.FieldIsDeleted, Value: bson.D{{Key: "$ne", Value: true}}},
+		}}},
+		{{Key: "$limit", Value: int64(10)}},
+	}
+
+	t.Run("Text", func(t *testing.T) {
+		pipeline := search(t, mgo.TextSearch("tea"))
+		score := bson.D{mgo.TextScore("score")}
+		assert.Equal(t, append(mongo.Pipeline{
+			{{Key: "$match", Value: bson.D{mgo.Text("tea")}}},
+			{{Key: "$sort", Value: score}},
+			{{Key: "$addFields", Value: score}},
+		}, tail...), pipeline)
+	})
+
+	t.Run("Atlas", func(t *testing.T) {
+		pipeline := search(t, mgo.AtlasSearch("books", mgo.AtlasText("tea", "title")))
+		assert.Equal(t, append(mongo.Pipeline{
+			{{Key: "$search", Value: bson.D{
+				{Key: "index", Value: "books"},
+				{Key: "text", Value: bson.D{{Key: "query", Value: "tea"}, {Key: "path", Value: "title"}}},
+			}}},
+			{{Key: "$addFields", Value: bson.D{{Key: "score", Value: bson.D{{Key: "$meta", Value: "searchScore"}}}}}},
+		}, tail...), pipeline)
+	})
+
+	t.Run("Pipeline without score", func(t *testing.T) {
+		pipeline := mgo.NewPipeline().Search(mgo.AtlasSearch("", mgo.AtlasText("tea", "title", "summary")), "").Build()
+		assert.Equal(t, mongo.Pipeline{{{Key: "$search", Value: bson.D{
+			{Key: "text", Value: bson.D{{Key: "query", Value: "tea"}, {Key: "path", Value: []string{"title", "summary"}}}},
+		}}}}, pipeline)
+	})
+}
@@ -0,0 +1,125 @@
+package mgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Field names used by the embeddable SoftDelete type.
+const (
+	FieldIsDeleted = "isDeleted"
+	FieldDeletedAt = "deletedAt"
+)
+
+// SoftDelete can be embedded (with `bson:",inline"`) in a model to turn DeleteById,
+// DeleteOne, DeleteMany and the deletes of bulk operations into soft deletes. Find,
+// FindOne and FindById automatically exclude soft-deleted documents unless the context
+// is wrapped with WithDeleted.
+type SoftDelete struct {
+	IsDeleted bool       `bson:"isDeleted"`
+	DeletedAt *time.Time `bson:"deletedAt,omitempty"`
+}
+
+// softDeletable is satisfied by any model embedding SoftDelete.
+type softDeletable interface {
+	markDeleted(now time.Time)
+}
+
+// markDeleted flags the in-memory document as deleted.
+func (s *SoftDelete) markDeleted(now time.Time) {
+	s.IsDeleted = true
+	s.DeletedAt = &now
+}
+
+// isSoftDeletable reports whether the model embeds SoftDelete.
+func isSoftDeletable(doc any) bool {
+	_, ok := doc.(softDeletable)
+	return ok
+}
+
+type ctxKeyWithDeleted struct{}
+
+// WithDeleted returns a context that makes reads and updates include soft-deleted documents.
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyWithDeleted{}, true)
+}
+
+// includeDeleted reports whether the context asks for soft-deleted documents.
+func includeDeleted(ctx context.Context) bool {
+	v, _ := ctx.Value(ctxKeyWithDeleted{}).(bool)
+	return v
+}
+
+// notDeleted is the filter condition excluding soft-deleted documents.
+// $ne also matches documents written before the model adopted SoftDelete.
+var notDeleted = bson.E{Key: FieldIsDeleted, Value: bson.D{{Key: "$ne", Value: true}}}
+
+// scopeFilter restricts a read filter according to the model's capabilities,
+// e.g. hiding soft-deleted documents.
+func scopeFilter(ctx context.Context, doc any, filter any) any {
+	if isSoftDeletable(doc) && !includeDeleted(ctx) {
+		filter = andFilter(filter, notDeleted)
+	}
+	return filter
+}
+
+// scopeWrite is scopeFilter for the filter of an update.
+func scopeWrite(ctx context.Context, doc any, filter bson.D) bson.D {
+	// andFilter keeps a bson.D filter a bson.D.
+	return scopeFilter(ctx, doc, filter).(bson.D)
+}
+
+// softDelete flags the first document matching filter, or all of them with many, as
+// deleted. Documents that are already deleted are left alone; without many, finding
+// none is reported as ErrNotFound. DeletedCount holds the number of flagged documents.
+func softDelete(ctx context.Context, ds Datastore, doc DocInter, filter bson.D, many bool) (*WriteResult, error) {
+	now := nowFunc()
+	update := softDeleteUpdate(doc, now)
+	filter, audit, err := beginAudit(ctx, ds, doc, AuditDelete, andFilter(filter, notDeleted).(bson.D), many, nil)
+	if err != nil {
+		return nil, err
+	}
+	var result *WriteResult
+	if many {
+		result, err = ds.UpdateMany(ctx, doc.C(), filter, update)
+		err = writeError(err)
+	} else {
+		result, err = requireMatch(ds.UpdateOne(ctx, doc.C(), filter, update))
+	}
+	if err != nil {
+		return result, err
+	}
+	result.DeletedCount = result.ModifiedCount
+	audit.finish(nil)
+	if sd, ok := any(doc).(softDeletable); ok && !many {
+		sd.markDeleted(now)
+	}
+	return result, nil
+}
+
+// softDeleteUpdate is the update flagging documents of doc's model as deleted at now.
+func softDeleteUpdate(doc any, now time.Time) bson.D {
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: FieldIsDeleted, Value: true},
+		{Key: FieldDeletedAt, Value: now},
+	}}}
+	return stampUpdate(doc, update, now)
+}
+
+// deletedUpsertError explains the duplicate key error of an Upsert by _id, which means
+// that the document with that _id is soft-deleted and thus hidden from the filter.
+func deletedUpsertError(ctx context.Context, doc any, filter bson.D, err error) error {
+	if err == nil || !isSoftDeletable(doc) || includeDeleted(ctx) || !errors.Is(err, ErrDuplicateKey) {
+		return err
+	}
+	for _, e := range filter {
+		if e.Key == "_id" {
+			return fmt.Errorf("%w: document %v is soft-deleted, use WithDeleted to update it", err, e.Value)
+		}
+	}
+	return err
+}
@@ -0,0 +1,35 @@
+package mgo
+
+import (
+	"reflect"
+	"strings"
+)
+
+// tagName is the struct tag holding the package's field options, e.g. `vulpes:"encrypt"`.
+const tagName = "vulpes"
+
+// fieldTag holds the comma-separated options of a vulpes struct tag.
+// Options are either flags ("encrypt") or key=value pairs.
+type fieldTag map[string]string
+
+// parseTag returns the vulpes tag options of f, or nil when it has none.
+func parseTag(f reflect.StructField) fieldTag {
+	raw, ok := f.Tag.Lookup(tagName)
+	if !ok || raw == "" || raw == "-" {
+		return nil
+	}
+	tag := fieldTag{}
+	for _, opt := range strings.Split(raw, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		if key != "" {
+			tag[key] = value
+		}
+	}
+	return tag
+}
+
+// has reports whether the option is present.
+func (t fieldTag) has(option string) bool {
+	_, ok := t[option]
+	return ok
+}
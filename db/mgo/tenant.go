@@ -0,0 +1,465 @@
+package mgo
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// TenantDatabase is an optional interface for models whose collection lives in a separate
+// database per tenant, instead of a collection shared by all tenants and filtered by a
+// field tagged with `vulpes:"tenant"`:
+//
+//	func (*Invoice) TenantDatabase(tenant string) string { return "shop_" + tenant }
+type TenantDatabase interface {
+	// TenantDatabase returns the name of the database holding the tenant's documents.
+	TenantDatabase(tenant string) string
+}
+
+type ctxKeyTenant struct{}
+
+// WithTenant returns a context acting on behalf of tenant, e.g. for jobs that do not
+// run on behalf of a gRPC caller. It takes precedence over the tenant resolver.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, ctxKeyTenant{}, tenant)
+}
+
+type ctxKeyAllTenants struct{}
+
+// WithAllTenants returns a context allowed to use tenant models without a tenant, reading
+// and writing the documents of all tenants, e.g. for back-office reports and migrations.
+// When ctx also carries a tenant, operations stay restricted to it. Models implementing
+// TenantDatabase still need a tenant to choose their database.
+func WithAllTenants(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeyAllTenants{}, true)
+}
+
+// allTenants reports whether ctx was elevated with WithAllTenants.
+func allTenants(ctx context.Context) bool {
+	v, _ := ctx.Value(ctxKeyAllTenants{}).(bool)
+	return v
+}
+
+// tenantResolver finds the tenant of contexts without WithTenant, see SetTenantResolver.
+var tenantResolver func(ctx context.Context) string
+
+// SetTenantResolver sets how the tenant of a call is found when ctx has none set with
+// WithTenant, e.g. the merchant of the gRPC caller, and returns a function restoring the
+// previous resolver:
+//
+//	mgo.SetTenantResolver(func(ctx context.Context) string {
+//		if user, _ := ezgrpc.GetUser(ctx); user != nil {
+//			return user.Merchant
+//		}
+//		return ""
+//	})
+func SetTenantResolver(resolve func(ctx context.Context) string) (restore func()) {
+	original := tenantResolver
+	tenantResolver = resolve
+	return func() {
+		tenantResolver = original
+	}
+}
+
+// TenantFromContext returns the tenant set with WithTenant, or else the one found by the
+// tenant resolver; empty means no tenant.
+func TenantFromContext(ctx context.Context) string {
+	if tenant, ok := ctx.Value(ctxKeyTenant{}).(string); ok {
+		return tenant
+	}
+	if tenantResolver != nil {
+		return tenantResolver(ctx)
+	}
+	return ""
+}
+
+// tenantField is the string field tagged with `vulpes:"tenant"`.
+type tenantField struct {
+	index []int
+	// path is the name of the field in the stored document.
+	path string
+}
+
+// tenantFieldCache maps a struct type to its *tenantField, nil when there is none.
+var tenantFieldCache sync.Map
+
+// tenantFieldOf returns the tenant field of the model type t, looking into inline structs.
+func tenantFieldOf(t reflect.Type) *tenantField {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	if field, ok := tenantFieldCache.Load(t); ok {
+		return field.(*tenantField)
+	}
+	field := findTenantField(t, nil)
+	tenantFieldCache.Store(t, field)
+	return field
+}
+
+func findTenantField(t reflect.Type, index []int) *tenantField {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, inline, skip := bsonFieldName(f)
+		if skip {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		if parseTag(f).has("tenant") && f.Type.Kind() == reflect.String {
+			return &tenantField{index: fieldIndex, path: name}
+		}
+		if inline && f.Type.Kind() == reflect.Struct {
+			if field := findTenantField(f.Type, fieldIndex); field != nil {
+				return field
+			}
+		}
+	}
+	return nil
+}
+
+// isTenanted reports whether the documents of the model belong to tenants.
+func isTenanted(doc any) bool {
+	if _, ok := doc.(TenantDatabase); ok {
+		return true
+	}
+	return tenantFieldOf(reflect.TypeOf(doc)) != nil
+}
+
+// tenantOf returns the tenant the operation on doc is restricted to, or "" when it is
+// not restricted: the model has no tenants, or ctx is elevated without a tenant.
+// Tenant models without a tenant are refused with ErrTenantDenied, and so are models
+// implementing TenantDatabase in an elevated ctx, since their database needs a tenant.
+func tenantOf(ctx context.Context, doc any) (string, error) {
+	if !isTenanted(doc) {
+		return "", nil
+	}
+	tenant := TenantFromContext(ctx)
+	if tenant != "" {
+		return tenant, nil
+	}
+	if _, ok := doc.(TenantDatabase); ok && allTenants(ctx) {
+		return "", fmt.Errorf("%w: %T needs a tenant to choose its database", ErrTenantDenied, doc)
+	}
+	if !allTenants(ctx) {
+		return "", fmt.Errorf("%w: %T needs a tenant", ErrTenantDenied, doc)
+	}
+	return "", nil
+}
+
+// tenantFilter restricts filter to the documents of the tenant of ctx when the model has
+// a tenant field. It fails like tenantOf.
+func tenantFilter[F any](ctx context.Context, doc any, filter F) (F, error) {
+	tenant, err := tenantOf(ctx, doc)
+	field := tenantFieldOf(reflect.TypeOf(doc))
+	if err != nil || tenant == "" || field == nil {
+		return filter, err
+	}
+	scoped, ok := andFilter(filter, bson.E{Key: field.path, Value: tenant}).(F)
+	if !ok {
+		return filter, fmt.Errorf("%w: filter %T cannot be restricted to the tenant, use bson.D", ErrInvalidDocument, filter)
+	}
+	return scoped, nil
+}
+
+// tenantPipeline restricts the documents entering pipeline to the tenant of ctx, like
+// tenantFilter. The $match stage follows stages that must come first, such as $geoNear.
+// Stages reading other collections are scoped too, see scopeJoins.
+func tenantPipeline(ctx context.Context, doc any, pipeline mongo.Pipeline) (mongo.Pipeline, error) {
+	match, err := tenantFilter(ctx, doc, bson.D(nil))
+	if err != nil {
+		return pipeline, err
+	}
+	pipeline, err = scopeJoins(ctx, doc, pipeline)
+	if err != nil || match == nil {
+		return pipeline, err
+	}
+	at := 0
+	if len(pipeline) > 0 && len(pipeline[0]) > 0 {
+		switch first := pipeline[0][0]; first.Key {
+		case "$geoNear", "$search", "$searchMeta", "$vectorSearch":
+			at = 1
+		case "$match":
+			// A $text query must be in the first stage.
+			switch cond := first.Value.(type) {
+			case bson.D:
+				if hasKey(cond, "$text") {
+					at = 1
+				}
+			case bson.M:
+				if _, ok := cond["$text"]; ok {
+					at = 1
+				}
+			}
+		}
+	}
+	scoped := make(mongo.Pipeline, 0, len(pipeline)+1)
+	scoped = append(scoped, pipeline[:at]...)
+	scoped = append(scoped, bson.D{{Key: "$match", Value: match}})
+	return append(scoped, pipeline[at:]...), nil
+}
+
+// scopeJoins restricts the documents that $lookup, $graphLookup and $unionWith stages read
+// from other collections to the tenant of ctx, including the stages of sub-pipelines and
+// $facet. The model of a joined collection is the one registered with RegisterIndex;
+// collections without one are not scoped. Joining a TenantDatabase model from outside
+// its database is refused with ErrTenantDenied.
+func scopeJoins(ctx context.Context, doc any, pipeline []bson.D) ([]bson.D, error) {
+	scoped := make([]bson.D, 0, len(pipeline))
+	for _, stage := range pipeline {
+		if len(stage) != 1 {
+			scoped = append(scoped, stage)
+			continue
+		}
+		op := stage[0].Key
+		if op != "$lookup" && op != "$graphLookup" && op != "$unionWith" && op != "$facet" {
+			scoped = append(scoped, stage)
+			continue
+		}
+		value := stage[0].Value
+		if from, ok := value.(string); ok && op == "$unionWith" {
+			value = bson.D{{Key: "coll", Value: from}}
+		}
+		spec, ok := toDoc(value)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s stage %T cannot be restricted to the tenant, use bson.D", ErrInvalidDocument, op, value)
+		}
+		var err error
+		switch op {
+		case "$facet":
+			for i, e := range spec {
+				if spec[i].Value, err = scopeSubPipeline(ctx, doc, op, e.Value, nil); err != nil {
+					return nil, err
+				}
+			}
+		case "$graphLookup":
+			spec, err = scopeGraphLookup(ctx, doc, spec)
+		default:
+			fromKey := "from"
+			if op == "$unionWith" {
+				fromKey = "coll"
+			}
+			spec, err = scopeLookup(ctx, doc, op, fromKey, spec)
+		}
+		if err != nil {
+			return nil, err
+		}
+		scoped = append(scoped, bson.D{{Key: op, Value: spec}})
+	}
+	return scoped, nil
+}
+
+// scopeLookup scopes the pipeline of a $lookup or $unionWith spec and adds a leading
+// $match on the tenant of the joined collection, read from the fromKey field.
+func scopeLookup(ctx context.Context, doc any, op, fromKey string, spec bson.D) (bson.D, error) {
+	match, err := joinMatch(ctx, doc, spec, fromKey)
+	if err != nil {
+		return nil, err
+	}
+	var sub any
+	for _, e := range spec {
+		if e.Key == "pipeline" {
+			sub = e.Value
+		}
+	}
+	if sub == nil && match == nil {
+		return spec, nil
+	}
+	scopedSub, err := scopeSubPipeline(ctx, doc, op, sub, match)
+	if err != nil {
+		return nil, err
+	}
+	return setField(spec, "pipeline", scopedSub), nil
+}
+
+// scopeGraphLookup restricts the documents a $graphLookup spec visits to the tenant of
+// the joined collection through restrictSearchWithMatch.
+func scopeGraphLookup(ctx context.Context, doc any, spec bson.D) (bson.D, error) {
+	match, err := joinMatch(ctx, doc, spec, "from")
+	if err != nil || match == nil {
+		return spec, err
+	}
+	var restrict any = match
+	for _, e := range spec {
+		if e.Key == "restrictSearchWithMatch" {
+			restrict = bson.D{{Key: "$and", Value: bson.A{e.Value, match}}}
+		}
+	}
+	return setField(spec, "restrictSearchWithMatch", restrict), nil
+}
+
+// scopeSubPipeline scopes the joins of a sub-pipeline and starts it with a $match on
+// match, if not nil.
+func scopeSubPipeline(ctx context.Context, doc any, op string, sub any, match bson.D) ([]bson.D, error) {
+	var stages []bson.D
+	switch p := sub.(type) {
+	case nil:
+	case mongo.Pipeline:
+		stages = p
+	case []bson.D:
+		stages = p
+	case bson.A:
+		for _, s := range p {
+			stage, ok := toDoc(s)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s pipeline stage %T cannot be restricted to the tenant, use bson.D", ErrInvalidDocument, op, s)
+			}
+			stages = append(stages, stage)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s pipeline %T cannot be restricted to the tenant, use mongo.Pipeline", ErrInvalidDocument, op, sub)
+	}
+	stages, err := scopeJoins(ctx, doc, stages)
+	if err != nil || match == nil {
+		return stages, err
+	}
+	return append([]bson.D{{{Key: "$match", Value: match}}}, stages...), nil
+}
+
+// joinMatch returns the tenant condition on the collection named by the fromKey field of
+// a join spec, or nil when its documents are not restricted. It fails like tenantOf.
+func joinMatch(ctx context.Context, doc any, spec bson.D, fromKey string) (bson.D, error) {
+	var from string
+	for _, e := range spec {
+		if e.Key == fromKey {
+			from, _ = e.Value.(string)
+		}
+	}
+	model := registeredModel(from)
+	if model == nil {
+		return nil, nil
+	}
+	if td, ok := model.(TenantDatabase); ok {
+		tenant := TenantFromContext(ctx)
+		outer, same := doc.(TenantDatabase)
+		if tenant == "" || !same || outer.TenantDatabase(tenant) != td.TenantDatabase(tenant) {
+			return nil, fmt.Errorf("%w: %s of another database cannot be joined", ErrTenantDenied, from)
+		}
+		return nil, nil
+	}
+	return tenantFilter(ctx, model, bson.D(nil))
+}
+
+// toDoc returns v as a bson.D, converting a bson.M with its keys sorted.
+func toDoc(v any) (bson.D, bool) {
+	switch d := v.(type) {
+	case bson.D:
+		return slices.Clone(d), true
+	case bson.M:
+		out := make(bson.D, 0, len(d))
+		for _, key := range slices.Sorted(maps.Keys(d)) {
+			out = append(out, bson.E{Key: key, Value: d[key]})
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// setField sets key in d, replacing an earlier value.
+func setField(d bson.D, key string, value any) bson.D {
+	for i, e := range d {
+		if e.Key == key {
+			d[i].Value = value
+			return d
+		}
+	}
+	return append(d, bson.E{Key: key, Value: value})
+}
+
+// stampTenant sets the tenant field of a document about to be written to the tenant of
+// ctx. Documents of another tenant are refused with ErrTenantDenied.
+func stampTenant(ctx context.Context, doc any) error {
+	tenant, err := tenantOf(ctx, doc)
+	field := tenantFieldOf(reflect.TypeOf(doc))
+	if err != nil || tenant == "" || field == nil || isNilDoc(doc) {
+		return err
+	}
+	v := reflect.ValueOf(doc).Elem().FieldByIndex(field.index)
+	switch v.String() {
+	case tenant:
+	case "":
+		v.SetString(tenant)
+	default:
+		return fmt.Errorf("%w: document belongs to tenant %q", ErrTenantDenied, v.String())
+	}
+	return nil
+}
+
+// checkTenantUpdate refuses updates that change the tenant field, which would move
+// documents to another tenant, unless ctx is elevated with WithAllTenants. This covers
+// every operator naming the field, such as $set and $unset, and $rename to the field.
+func checkTenantUpdate(ctx context.Context, doc any, update bson.D) error {
+	field := tenantFieldOf(reflect.TypeOf(doc))
+	if field == nil || allTenants(ctx) {
+		return nil
+	}
+	for _, op := range update {
+		var fields bson.D
+		switch v := op.Value.(type) {
+		case bson.D:
+			fields = v
+		case bson.M:
+			for key, value := range v {
+				fields = append(fields, bson.E{Key: key, Value: value})
+			}
+		}
+		for _, e := range fields {
+			target, _ := e.Value.(string)
+			if isTenantPath(e.Key, field.path) || (op.Key == "$rename" && isTenantPath(target, field.path)) {
+				return fmt.Errorf("%w: %s cannot change the tenant field %s", ErrTenantDenied, op.Key, field.path)
+			}
+		}
+	}
+	return nil
+}
+
+// isTenantPath reports whether the dotted path names the tenant field or a part of it.
+func isTenantPath(path, tenantPath string) bool {
+	return path == tenantPath || strings.HasPrefix(path, tenantPath+".")
+}
+
+// tenantOwns checks that the document identified by doc's _id belongs to the tenant of
+// ctx, including soft-deleted documents. It returns ErrNotFound otherwise.
+func tenantOwns(ctx context.Context, ds Datastore, doc DocInter) error {
+	tenant, err := tenantOf(ctx, doc)
+	field := tenantFieldOf(reflect.TypeOf(doc))
+	if err != nil || tenant == "" || field == nil {
+		return err
+	}
+	n, err := ds.CountDocuments(ctx, doc.C(), bson.D{{Key: "_id", Value: doc.GetId()}, {Key: field.path, Value: tenant}})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// tenantStore routes models implementing TenantDatabase to the database of the tenant of
+// ctx. Without a tenant, ds is returned unchanged.
+func tenantStore(ctx context.Context, index any, ds Datastore) Datastore {
+	td, ok := index.(TenantDatabase)
+	if !ok || ds == nil {
+		return ds
+	}
+	if tenant := TenantFromContext(ctx); tenant != "" {
+		return ds.database(td.TenantDatabase(tenant))
+	}
+	return ds
+}
+
+func (m *mongoStore) database(name string) Datastore {
+	return &mongoStore{db: m.db.Client().Database(name)}
+}
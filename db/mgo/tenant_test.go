@@ -0,0 +1,213 @@
+package mgo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+	"github.com/arwoosa/vulpes/ezgrpc"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"google.golang.org/grpc/metadata"
+)
+
+// testReceipt is shared by all tenants and filtered by its merchant.
+type testReceipt struct {
+	ID       bson.ObjectID `bson:"_id,omitempty"`
+	Merchant string        `bson:"merchantId" vulpes:"tenant"`
+	Item     string        `bson:"item"`
+}
+
+func (o *testReceipt) C() string                   { return "receipts" }
+func (o *testReceipt) Indexes() []mongo.IndexModel { return nil }
+func (o *testReceipt) Validate() error             { return nil }
+func (o *testReceipt) GetId() any                  { return o.ID }
+func (o *testReceipt) SetId(id any)                { o.ID = id.(bson.ObjectID) }
+
+// testLedger lives in a database per tenant.
+type testLedger struct {
+	ID   bson.ObjectID `bson:"_id,omitempty"`
+	Memo string        `bson:"memo"`
+}
+
+func (l *testLedger) C() string                           { return "ledgers" }
+func (l *testLedger) Indexes() []mongo.IndexModel         { return nil }
+func (l *testLedger) Validate() error                     { return nil }
+func (l *testLedger) GetId() any                          { return l.ID }
+func (l *testLedger) SetId(id any)                        { l.ID = id.(bson.ObjectID) }
+func (l *testLedger) TenantDatabase(tenant string) string { return "shop_" + tenant }
+
+// testReceiptSearch searches the receipts of a tenant by text.
+type testReceiptSearch struct {
+	Receipt testReceipt `bson:",inline"`
+}
+
+func (s *testReceiptSearch) C() string                   { return "receipts" }
+func (s *testReceiptSearch) Indexes() []mongo.IndexModel { return nil }
+func (s *testReceiptSearch) GetPipeline(q bson.M) mongo.Pipeline {
+	return mongo.Pipeline{{{Key: "$match", Value: bson.M{"$text": bson.M{"$search": q["term"]}}}}}
+}
+
+func TestTenantField(t *testing.T) {
+	defer mgo.SetDatastore(mgo.NewMemoryDatastore())()
+	ctxA := mgo.WithTenant(context.Background(), "a")
+	ctxB := mgo.WithTenant(context.Background(), "b")
+
+	_, err := mgo.Save(context.Background(), &testReceipt{Item: "tea"})
+	assert.ErrorIs(t, err, mgo.ErrTenantDenied)
+
+	receipt, err := mgo.Save(ctxA, &testReceipt{Item: "tea"})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", receipt.Merchant, "the tenant is stamped")
+	_, err = mgo.Save(ctxB, &testReceipt{Item: "mug"})
+	assert.NoError(t, err)
+	_, err = mgo.Save(ctxB, &testReceipt{Merchant: "a", Item: "pot"})
+	assert.ErrorIs(t, err, mgo.ErrTenantDenied)
+
+	receipts, err := mgo.Find(ctxA, &testReceipt{}, bson.D{})
+	assert.NoError(t, err)
+	if assert.Len(t, receipts, 1) {
+		assert.Equal(t, "tea", receipts[0].Item)
+	}
+	assert.ErrorIs(t, mgo.FindById(ctxB, &testReceipt{ID: receipt.ID}), mgo.ErrNotFound)
+
+	t.Run("Tenant resolver", func(t *testing.T) {
+		defer mgo.SetTenantResolver(func(ctx context.Context) string {
+			if user, _ := ezgrpc.GetUser(ctx); user != nil {
+				return user.Merchant
+			}
+			return ""
+		})()
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("user-id", "u-1", "merchant-id", "b"))
+		n, err := mgo.Count(ctx, &testReceipt{}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	})
+
+	t.Run("Writes stay in the tenant", func(t *testing.T) {
+		_, err := mgo.UpdateById(ctxB, &testReceipt{ID: receipt.ID}, bson.D{{Key: "$set", Value: bson.D{{Key: "item", Value: "cup"}}}})
+		assert.ErrorIs(t, err, mgo.ErrNotFound)
+
+		_, err = mgo.UpdateById(ctxA, &testReceipt{ID: receipt.ID}, bson.D{{Key: "$set", Value: bson.D{{Key: "merchantId", Value: "b"}}}})
+		assert.ErrorIs(t, err, mgo.ErrTenantDenied)
+		_, err = mgo.UpdateById(ctxA, &testReceipt{ID: receipt.ID}, bson.D{{Key: "$rename", Value: bson.D{{Key: "item", Value: "merchantId"}}}})
+		assert.ErrorIs(t, err, mgo.ErrTenantDenied)
+		_, err = mgo.UpdateById(ctxA, &testReceipt{ID: receipt.ID}, bson.D{{Key: "$unset", Value: bson.M{"merchantId": ""}}})
+		assert.ErrorIs(t, err, mgo.ErrTenantDenied)
+
+		res, err := mgo.DeleteMany(ctxB, &testReceipt{}, bson.D{{Key: "item", Value: "tea"}})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), res.DeletedCount)
+	})
+
+	t.Run("All tenants", func(t *testing.T) {
+		n, err := mgo.Count(mgo.WithAllTenants(context.Background()), &testReceipt{}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		n, err = mgo.Count(mgo.WithAllTenants(ctxA), &testReceipt{}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n, "a tenant still restricts an elevated context")
+	})
+
+	t.Run("Bulk operations", func(t *testing.T) {
+		bulk, err := mgo.NewBulkOperation("receipts")
+		assert.NoError(t, err)
+		bulk.InsertOne(&testReceipt{Item: "pot"}).DeleteMany(bson.D{{Key: "item", Value: "tea"}})
+		_, err = bulk.Execute(context.Background())
+		assert.ErrorIs(t, err, mgo.ErrTenantDenied)
+
+		result, err := bulk.Execute(ctxB)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), result.DeletedCount, "the model of the inserted document scopes the filters")
+		n, err := mgo.Count(ctxB, &testReceipt{}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+	})
+}
+
+func TestTenantDatabase(t *testing.T) {
+	defer mgo.SetDatastore(mgo.NewMemoryDatastore())()
+	ctxA := mgo.WithTenant(context.Background(), "a")
+
+	_, err := mgo.Find(context.Background(), &testLedger{}, bson.D{})
+	assert.ErrorIs(t, err, mgo.ErrTenantDenied)
+
+	_, err = mgo.Find(mgo.WithAllTenants(context.Background()), &testLedger{}, bson.D{})
+	assert.ErrorIs(t, err, mgo.ErrTenantDenied, "the database needs a tenant")
+
+	_, err = mgo.Save(ctxA, &testLedger{Memo: "opening"})
+	assert.NoError(t, err)
+
+	ledgers, err := mgo.Find(ctxA, &testLedger{}, bson.D{})
+	assert.NoError(t, err)
+	assert.Len(t, ledgers, 1)
+	ledgers, err = mgo.Find(mgo.WithTenant(context.Background(), "b"), &testLedger{}, bson.D{})
+	assert.NoError(t, err)
+	assert.Empty(t, ledgers)
+}
+
+func TestTenantPipeline(t *testing.T) {
+	var pipeline mongo.Pipeline
+	mockDB := &mgo.MockDatastore{
+		OnPipeFind: func(ctx context.Context, collection string, p mongo.Pipeline) (*mongo.Cursor, error) {
+			pipeline = p
+			return mgo.NewOnPipeFindMock()(ctx, collection, p)
+		},
+	}
+	defer mgo.SetDatastore(mockDB)()
+
+	_, err := mgo.PipeFind(mgo.WithTenant(context.Background(), "a"), &testReceiptSearch{}, bson.M{"term": "tea"})
+	assert.NoError(t, err)
+	if assert.Len(t, pipeline, 2) {
+		assert.Contains(t, pipeline[0][0].Value, "$text", "a $text query stays first")
+		assert.Equal(t, bson.D{{Key: "$match", Value: bson.D{{Key: "merchantId", Value: "a"}}}}, pipeline[1])
+	}
+}
+
+// testJoin is an aggregation on a collection without tenants joining other collections.
+type testJoin struct {
+	pipeline mongo.Pipeline
+}
+
+func (j *testJoin) C() string                           { return "items" }
+func (j *testJoin) Indexes() []mongo.IndexModel         { return nil }
+func (j *testJoin) GetPipeline(q bson.M) mongo.Pipeline { return j.pipeline }
+
+func TestTenantPipelineJoins(t *testing.T) {
+	mgo.RegisterIndex(&testReceipt{})
+	mgo.RegisterIndex(&testLedger{})
+	var pipeline mongo.Pipeline
+	mockDB := &mgo.MockDatastore{
+		OnPipeFind: func(ctx context.Context, collection string, p mongo.Pipeline) (*mongo.Cursor, error) {
+			pipeline = p
+			return mgo.NewOnPipeFindMock()(ctx, collection, p)
+		},
+	}
+	defer mgo.SetDatastore(mockDB)()
+	ctx := mgo.WithTenant(context.Background(), "a")
+	match := bson.D{{Key: "$match", Value: bson.D{{Key: "merchantId", Value: "a"}}}}
+
+	join := &testJoin{pipeline: mgo.NewPipeline().
+		Lookup("receipts", "receiptId", "_id", "receipt").
+		LookupPipeline("receipts", nil, mgo.NewPipeline().Limit(1), "first").
+		Stage(bson.D{{Key: "$unionWith", Value: "receipts"}}).
+		Stage(bson.D{{Key: "$graphLookup", Value: bson.M{"from": "receipts", "startWith": "$_id", "connectFromField": "_id", "connectToField": "parent", "as": "tree"}}}).
+		Build()}
+	_, err := mgo.PipeFind(ctx, join, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, pipeline, 4) {
+		assert.Contains(t, pipeline[0][0].Value, bson.E{Key: "pipeline", Value: []bson.D{match}})
+		assert.Contains(t, pipeline[1][0].Value, bson.E{Key: "pipeline", Value: []bson.D{match, {{Key: "$limit", Value: int64(1)}}}})
+		assert.Equal(t, bson.D{{Key: "coll", Value: "receipts"}, {Key: "pipeline", Value: []bson.D{match}}}, pipeline[2][0].Value)
+		assert.Contains(t, pipeline[3][0].Value, bson.E{Key: "restrictSearchWithMatch", Value: bson.D{{Key: "merchantId", Value: "a"}}})
+	}
+
+	_, err = mgo.PipeFind(context.Background(), join, nil)
+	assert.ErrorIs(t, err, mgo.ErrTenantDenied, "joined tenant collections need a tenant")
+
+	ledgers := &testJoin{pipeline: mgo.NewPipeline().Lookup("ledgers", "ledgerId", "_id", "ledger").Build()}
+	_, err = mgo.PipeFind(ctx, ledgers, nil)
+	assert.ErrorIs(t, err, mgo.ErrTenantDenied, "per-tenant databases cannot be joined")
+}
@@ -0,0 +1,70 @@
+package mgo
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Field names used by the embeddable Timestamps type.
+const (
+	FieldCreatedAt = "createdAt"
+	FieldUpdatedAt = "updatedAt"
+)
+
+// nowFunc returns the current time. It is a variable so tests can freeze the clock.
+var nowFunc = time.Now
+
+// Timestamps can be embedded (with `bson:",inline"`) in a model to have its
+// creation and modification times maintained automatically.
+// Save stamps both fields on insert, while UpdateOne, UpdateMany and bulk
+// operations bound to the model refresh UpdatedAt.
+type Timestamps struct {
+	CreatedAt time.Time `bson:"createdAt"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+}
+
+// timestamped is satisfied by any model embedding Timestamps.
+type timestamped interface {
+	touch(now time.Time, insert bool)
+}
+
+// touch records the time of an insert or update.
+// CreatedAt is only set on insert and never overwrites an explicit value.
+func (t *Timestamps) touch(now time.Time, insert bool) {
+	if insert && t.CreatedAt.IsZero() {
+		t.CreatedAt = now
+	}
+	t.UpdatedAt = now
+}
+
+// isTimestamped reports whether the model embeds Timestamps.
+func isTimestamped(doc any) bool {
+	_, ok := doc.(timestamped)
+	return ok
+}
+
+// stampInsert sets the timestamps of a document that is about to be inserted.
+func stampInsert(doc any, now time.Time) {
+	if ts, ok := doc.(timestamped); ok {
+		ts.touch(now, true)
+	}
+}
+
+// stampUpdate adds `updatedAt` to the $set stage of an update when the model embeds Timestamps.
+func stampUpdate(doc any, update bson.D, now time.Time) bson.D {
+	if !isTimestamped(doc) {
+		return update
+	}
+	return mergeSet(update, bson.D{{Key: FieldUpdatedAt, Value: now}})
+}
+
+// stampUpsert is stampUpdate for upserts: `createdAt` is also set, via $setOnInsert,
+// when the upsert inserts a new document.
+func stampUpsert(doc any, update bson.D, now time.Time) bson.D {
+	if !isTimestamped(doc) {
+		return update
+	}
+	update = mergeOperator(update, "$setOnInsert", bson.D{{Key: FieldCreatedAt, Value: now}})
+	return stampUpdate(doc, update, now)
+}
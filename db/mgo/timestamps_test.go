@@ -0,0 +1,246 @@
+package mgo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// testArticle embeds Timestamps and SoftDelete.
+type testArticle struct {
+	ID             bson.ObjectID `bson:"_id,omitempty"`
+	mgo.Timestamps `bson:",inline"`
+	mgo.SoftDelete `bson:",inline"`
+	Title          string `bson:"title"`
+}
+
+func (a *testArticle) C() string                   { return "articles" }
+func (a *testArticle) Indexes() []mongo.IndexModel { return nil }
+func (a *testArticle) Validate() error             { return nil }
+func (a *testArticle) GetId() any                  { return a.ID }
+func (a *testArticle) SetId(id any)                { a.ID = id.(bson.ObjectID) }
+
+func TestSaveStampsTimestamps(t *testing.T) {
+	mockDB := &mgo.MockDatastore{OnSave: mgo.NewOnSaveMock()}
+	restore := mgo.SetDatastore(mockDB)
+	defer restore()
+
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.Run("Fresh document", func(t *testing.T) {
+		saved, err := mgo.Save(context.Background(), &testArticle{Title: "hello"})
+		assert.NoError(t, err)
+		assert.False(t, saved.CreatedAt.IsZero())
+		assert.Equal(t, saved.CreatedAt, saved.UpdatedAt)
+	})
+
+	t.Run("Explicit CreatedAt is kept", func(t *testing.T) {
+		doc := &testArticle{Title: "import"}
+		doc.CreatedAt = created
+		saved, err := mgo.Save(context.Background(), doc)
+		assert.NoError(t, err)
+		assert.Equal(t, created, saved.CreatedAt)
+		assert.True(t, saved.UpdatedAt.After(created))
+	})
+}
+
+func TestUpdateStampsUpdatedAt(t *testing.T) {
+	t.Run("Appends to existing $set", func(t *testing.T) {
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "title", Value: "new"}}}}
+		mockDB := &mgo.MockDatastore{
+			OnUpdateOne: func(ctx context.Context, collection string, f bson.D, u bson.D) (*mgo.WriteResult, error) {
+				set := u[0].Value.(bson.D)
+				assert.Len(t, set, 2)
+				assert.Equal(t, "title", set[0].Key)
+				assert.Equal(t, mgo.FieldUpdatedAt, set[1].Key)
+				return &mgo.WriteResult{MatchedCount: 1, ModifiedCount: 1}, nil
+			},
+		}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		_, err := mgo.UpdateById(context.Background(), &testArticle{ID: bson.NewObjectID()}, update)
+		assert.NoError(t, err)
+		assert.Len(t, update[0].Value.(bson.D), 1, "caller's update must not be modified")
+	})
+
+	t.Run("Adds $set when missing", func(t *testing.T) {
+		update := bson.D{{Key: "$inc", Value: bson.D{{Key: "views", Value: 1}}}}
+		mockDB := &mgo.MockDatastore{
+			OnUpdateMany: func(ctx context.Context, collection string, f bson.D, u bson.D) (*mgo.WriteResult, error) {
+				assert.Len(t, u, 2)
+				assert.Equal(t, "$set", u[1].Key)
+				return &mgo.WriteResult{MatchedCount: 1, ModifiedCount: 1}, nil
+			},
+		}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		_, err := mgo.UpdateMany(context.Background(), &testArticle{}, bson.D{}, update)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Models without Timestamps are untouched", func(t *testing.T) {
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "name", Value: "new"}}}}
+		mockDB := &mgo.MockDatastore{
+			OnUpdateOne: func(ctx context.Context, collection string, f bson.D, u bson.D) (*mgo.WriteResult, error) {
+				assert.Equal(t, update, u)
+				return &mgo.WriteResult{MatchedCount: 1, ModifiedCount: 1}, nil
+			},
+		}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		_, err := mgo.UpdateOne(context.Background(), &testUser{}, bson.D{}, update)
+		assert.NoError(t, err)
+	})
+}
+
+func TestFindExcludesSoftDeleted(t *testing.T) {
+	var captured any
+	mockDB := &mgo.MockDatastore{
+		OnFind: func(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
+			captured = filter
+			return mongo.NewCursorFromDocuments(nil, nil, nil)
+		},
+		OnFindOne: func(ctx context.Context, collection string, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
+			captured = filter
+			return mongo.NewSingleResultFromDocument(bson.D{}, nil, nil)
+		},
+	}
+	restore := mgo.SetDatastore(mockDB)
+	defer restore()
+
+	t.Run("Find with bson.M filter", func(t *testing.T) {
+		_, err := mgo.Find(context.Background(), &testArticle{}, bson.M{"title": "a"})
+		assert.NoError(t, err)
+		assert.Equal(t, bson.M{"title": "a", mgo.FieldIsDeleted: bson.D{{Key: "$ne", Value: true}}}, captured)
+	})
+
+	t.Run("Find with nil filter", func(t *testing.T) {
+		_, err := mgo.Find(context.Background(), &testArticle{}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, bson.D{{Key: mgo.FieldIsDeleted, Value: bson.D{{Key: "$ne", Value: true}}}}, captured)
+	})
+
+	t.Run("FindById", func(t *testing.T) {
+		id := bson.NewObjectID()
+		err := mgo.FindById(context.Background(), &testArticle{ID: id})
+		assert.NoError(t, err)
+		assert.Equal(t, bson.M{"_id": id, mgo.FieldIsDeleted: bson.D{{Key: "$ne", Value: true}}}, captured)
+	})
+
+	t.Run("WithDeleted", func(t *testing.T) {
+		_, err := mgo.Find(mgo.WithDeleted(context.Background()), &testArticle{}, bson.M{"title": "a"})
+		assert.NoError(t, err)
+		assert.Equal(t, bson.M{"title": "a"}, captured)
+	})
+}
+
+func TestUpdateExcludesSoftDeleted(t *testing.T) {
+	var captured bson.D
+	mockDB := &mgo.MockDatastore{
+		OnUpdateMany: func(ctx context.Context, collection string, f bson.D, u bson.D) (*mgo.WriteResult, error) {
+			captured = f
+			return &mgo.WriteResult{}, nil
+		},
+		OnUpsert: func(ctx context.Context, collection string, f bson.D, u bson.D) (*mgo.WriteResult, error) {
+			captured = f
+			return &mgo.WriteResult{}, nil
+		},
+	}
+	defer mgo.SetDatastore(mockDB)()
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "title", Value: "b"}}}}
+	notDeleted := bson.E{Key: mgo.FieldIsDeleted, Value: bson.D{{Key: "$ne", Value: true}}}
+
+	_, err := mgo.UpdateMany(context.Background(), &testArticle{}, bson.D{{Key: "title", Value: "a"}}, update)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "title", Value: "a"}, notDeleted}, captured)
+
+	_, err = mgo.Upsert(context.Background(), &testArticle{}, bson.D{{Key: "title", Value: "a"}}, update)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "title", Value: "a"}, notDeleted}, captured)
+
+	_, err = mgo.UpdateMany(mgo.WithDeleted(context.Background()), &testArticle{}, bson.D{{Key: "title", Value: "a"}}, update)
+	assert.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "title", Value: "a"}}, captured)
+}
+
+func TestDeleteByIdSoftDeletes(t *testing.T) {
+	id := bson.NewObjectID()
+	mockDB := &mgo.MockDatastore{
+		OnUpdateOne: func(ctx context.Context, collection string, f bson.D, u bson.D) (*mgo.WriteResult, error) {
+			assert.Equal(t, "articles", collection)
+			assert.Equal(t, id, f[0].Value)
+			set := u[0].Value.(bson.D)
+			assert.Equal(t, bson.E{Key: mgo.FieldIsDeleted, Value: true}, set[0])
+			assert.Equal(t, mgo.FieldDeletedAt, set[1].Key)
+			assert.Equal(t, mgo.FieldUpdatedAt, set[2].Key)
+			return &mgo.WriteResult{MatchedCount: 1, ModifiedCount: 1}, nil
+		},
+		OnDeleteOne: func(ctx context.Context, collection string, f bson.D) (*mgo.WriteResult, error) {
+			assert.Equal(t, bson.D{{Key: "_id", Value: id}}, f)
+			return &mgo.WriteResult{DeletedCount: 1}, nil
+		},
+	}
+	restore := mgo.SetDatastore(mockDB)
+	defer restore()
+
+	doc := &testArticle{ID: id}
+	result, err := mgo.DeleteById(context.Background(), doc)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+	assert.True(t, doc.IsDeleted)
+	assert.NotNil(t, doc.DeletedAt)
+
+	result, err = mgo.HardDelete(context.Background(), doc)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.DeletedCount)
+}
+
+func TestDeletesSoftDelete(t *testing.T) {
+	defer mgo.SetDatastore(mgo.NewMemoryDatastore())()
+	ctx := context.Background()
+	a, _ := mgo.Save(ctx, &testArticle{Title: "a"})
+	b, _ := mgo.Save(ctx, &testArticle{Title: "b"})
+	_, _ = mgo.Save(ctx, &testArticle{Title: "c"})
+	_, _ = mgo.Save(ctx, &testArticle{Title: "c"})
+
+	res, err := mgo.DeleteOne(ctx, &testArticle{}, bson.D{{Key: "title", Value: "a"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), res.DeletedCount)
+	_, err = mgo.DeleteOne(ctx, &testArticle{}, bson.D{{Key: "title", Value: "a"}})
+	assert.ErrorIs(t, err, mgo.ErrNotFound, "a deleted document is not deleted again")
+
+	res, err = mgo.DeleteMany(ctx, &testArticle{}, bson.D{{Key: "title", Value: "c"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), res.DeletedCount)
+
+	bulk, err := mgo.NewBulkOperation("articles", mgo.WithModel(&testArticle{}))
+	assert.NoError(t, err)
+	result, err := bulk.DeleteById(b.ID).Execute(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.ModifiedCount)
+
+	live, err := mgo.Find(ctx, &testArticle{}, bson.D{})
+	assert.NoError(t, err)
+	assert.Empty(t, live)
+	all, err := mgo.Find(mgo.WithDeleted(ctx), &testArticle{}, bson.D{})
+	assert.NoError(t, err)
+	if assert.Len(t, all, 4, "the documents are kept") {
+		for _, doc := range all {
+			assert.True(t, doc.IsDeleted)
+			assert.NotNil(t, doc.DeletedAt)
+		}
+	}
+
+	_, err = mgo.Upsert(ctx, &testArticle{}, bson.D{{Key: "_id", Value: a.ID}}, bson.D{{Key: "$set", Value: bson.D{{Key: "title", Value: "A"}}}})
+	assert.ErrorIs(t, err, mgo.ErrDuplicateKey)
+	assert.ErrorContains(t, err, "is soft-deleted")
+}
@@ -0,0 +1,62 @@
+package mgo
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// supportsTransactions reports whether the deployment behind db accepts
+// multi-document transactions, i.e. it is a replica set or a sharded cluster.
+func supportsTransactions(ctx context.Context, db *mongo.Database) bool {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid"
+}
+
+// runInTransaction executes fn inside a transaction on client.
+// Operations performed with the context passed to fn take part in the transaction,
+// which is committed when fn returns nil and aborted otherwise.
+func runInTransaction(ctx context.Context, client *mongo.Client, fn func(ctx context.Context) error) error {
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+// WithTransaction runs fn in a multi-document transaction. Every mgo call made with the
+// context passed to fn takes part in it; the transaction commits when fn returns nil and
+// aborts otherwise. The error returned by fn is passed through unchanged.
+//
+// Transactions require a replica set or a sharded cluster.
+func WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if dataStore == nil {
+		return ErrNotConnected
+	}
+	var fnErr error
+	err := dataStore.Transaction(ctx, func(ctx context.Context) error {
+		fnErr = fn(ctx)
+		return fnErr
+	})
+	if err != nil && fnErr == nil {
+		return fmt.Errorf("%w: %w", ErrWriteFailed, err)
+	}
+	return err
+}
+
+func (m *mongoStore) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return runInTransaction(ctx, m.db.Client(), fn)
+}
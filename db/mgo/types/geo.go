@@ -0,0 +1,151 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidGeoJSON is returned when coordinates do not form a valid GeoJSON geometry.
+var ErrInvalidGeoJSON = errors.New("invalid geojson")
+
+// GeoJSON object types supported by MongoDB geospatial queries.
+const (
+	GeoPoint      = "Point"
+	GeoLineString = "LineString"
+	GeoPolygon    = "Polygon"
+	GeoMultiPoint = "MultiPoint"
+)
+
+// Geometry is implemented by the GeoJSON types of this package.
+type Geometry interface {
+	// GeoType returns the GeoJSON object type, e.g. "Polygon".
+	GeoType() string
+	// Validate reports whether the coordinates form a valid geometry.
+	Validate() error
+}
+
+// Validate checks that the location is a Point with a longitude in [-180, 180]
+// and a latitude in [-90, 90].
+func (l *Location) Validate() error {
+	if l.Type != GeoPoint {
+		return fmt.Errorf("%w: type %q is not %s", ErrInvalidGeoJSON, l.Type, GeoPoint)
+	}
+	return validatePosition(l.Coordinates)
+}
+
+// GeoType returns "Point".
+func (l *Location) GeoType() string { return GeoPoint }
+
+// LineString is a GeoJSON LineString: a path through two or more positions.
+type LineString struct {
+	Type        string      `bson:"type"`
+	Coordinates [][]float64 `bson:"coordinates"`
+}
+
+// NewLineString creates a LineString through the given [longitude, latitude] positions.
+func NewLineString(positions ...[]float64) (*LineString, error) {
+	l := &LineString{Type: GeoLineString, Coordinates: positions}
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Validate checks that the line has at least two valid positions.
+func (l *LineString) Validate() error {
+	if len(l.Coordinates) < 2 {
+		return fmt.Errorf("%w: a line string needs at least 2 positions, got %d", ErrInvalidGeoJSON, len(l.Coordinates))
+	}
+	return validatePositions(l.Coordinates)
+}
+
+// GeoType returns "LineString".
+func (l *LineString) GeoType() string { return GeoLineString }
+
+// MultiPoint is a GeoJSON MultiPoint: a set of positions.
+type MultiPoint struct {
+	Type        string      `bson:"type"`
+	Coordinates [][]float64 `bson:"coordinates"`
+}
+
+// NewMultiPoint creates a MultiPoint from the given [longitude, latitude] positions.
+func NewMultiPoint(positions ...[]float64) (*MultiPoint, error) {
+	m := &MultiPoint{Type: GeoMultiPoint, Coordinates: positions}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Validate checks that there is at least one position and that all positions are valid.
+func (m *MultiPoint) Validate() error {
+	if len(m.Coordinates) == 0 {
+		return fmt.Errorf("%w: a multi point needs at least 1 position", ErrInvalidGeoJSON)
+	}
+	return validatePositions(m.Coordinates)
+}
+
+// GeoType returns "MultiPoint".
+func (m *MultiPoint) GeoType() string { return GeoMultiPoint }
+
+// Polygon is a GeoJSON Polygon. The first ring is the exterior; further rings are holes.
+type Polygon struct {
+	Type        string        `bson:"type"`
+	Coordinates [][][]float64 `bson:"coordinates"`
+}
+
+// NewPolygon creates a Polygon from linear rings of [longitude, latitude] positions.
+// Each ring must have at least four positions and end where it starts.
+func NewPolygon(rings ...[][]float64) (*Polygon, error) {
+	p := &Polygon{Type: GeoPolygon, Coordinates: rings}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate checks that the polygon has at least one closed ring of four or more valid positions.
+func (p *Polygon) Validate() error {
+	if len(p.Coordinates) == 0 {
+		return fmt.Errorf("%w: a polygon needs at least 1 ring", ErrInvalidGeoJSON)
+	}
+	for i, ring := range p.Coordinates {
+		if len(ring) < 4 {
+			return fmt.Errorf("%w: ring %d needs at least 4 positions, got %d", ErrInvalidGeoJSON, i, len(ring))
+		}
+		if err := validatePositions(ring); err != nil {
+			return fmt.Errorf("ring %d: %w", i, err)
+		}
+		first, last := ring[0], ring[len(ring)-1]
+		if first[0] != last[0] || first[1] != last[1] {
+			return fmt.Errorf("%w: ring %d is not closed", ErrInvalidGeoJSON, i)
+		}
+	}
+	return nil
+}
+
+// GeoType returns "Polygon".
+func (p *Polygon) GeoType() string { return GeoPolygon }
+
+func validatePositions(positions [][]float64) error {
+	for i, pos := range positions {
+		if err := validatePosition(pos); err != nil {
+			return fmt.Errorf("position %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validatePosition checks a [longitude, latitude] pair.
+func validatePosition(pos []float64) error {
+	if len(pos) != 2 {
+		return fmt.Errorf("%w: a position needs 2 coordinates, got %d", ErrInvalidGeoJSON, len(pos))
+	}
+	if pos[0] < -180 || pos[0] > 180 {
+		return fmt.Errorf("%w: longitude %v out of range [-180, 180]", ErrInvalidGeoJSON, pos[0])
+	}
+	if pos[1] < -90 || pos[1] > 90 {
+		return fmt.Errorf("%w: latitude %v out of range [-90, 90]", ErrInvalidGeoJSON, pos[1])
+	}
+	return nil
+}
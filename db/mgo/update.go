@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 // UpdateById updates a single document identified by the _id field of the provided document instance.
@@ -15,7 +16,7 @@ import (
 //	It is also used to determine the target collection.
 //
 // update: The update document, e.g., bson.D{{"$set", bson.D{{"field", "value"}}}}.
-func UpdateById[T DocInter](ctx context.Context, doc T, update bson.D) (int64, error) {
+func UpdateById[T DocInter](ctx context.Context, doc T, update bson.D) (*WriteResult, error) {
 	return UpdateOne(ctx, doc, bson.D{{Key: "_id", Value: doc.GetId()}}, update)
 }
 
@@ -25,33 +26,188 @@ func UpdateById[T DocInter](ctx context.Context, doc T, update bson.D) (int64, e
 // doc: An instance of the document type, used to determine the collection.
 // filter: The filter to select the document to update.
 // update: The update document, e.g., bson.D{{"$set", bson.D{{"field", "value"}}}}.
-func UpdateOne[T DocInter](ctx context.Context, doc T, filter bson.D, update bson.D) (int64, error) {
-	if dataStore == nil {
-		return 0, ErrNotConnected
+//
+// It returns ErrNotFound, along with the result, when no document matched.
+// Models embedding Timestamps get `updatedAt` added to the $set stage.
+// Values set on fields tagged with `vulpes:"encrypt"` are encrypted.
+// Models implementing BeforeUpdater may extend update first.
+func UpdateOne[T DocInter](ctx context.Context, doc T, filter bson.D, update bson.D) (*WriteResult, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return nil, ErrNotConnected
+	}
+	update, err := beforeUpdate(ctx, doc, update)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTenantUpdate(ctx, doc, update); err != nil {
+		return nil, err
+	}
+	filter, err = tenantFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, err
+	}
+	filter = scopeWrite(ctx, doc, filter)
+	filter, update, err = encryptWrite(ctx, doc, filter, stampUpdate(doc, update, nowFunc()))
+	if err != nil {
+		return nil, err
 	}
-	return dataStore.UpdateOne(ctx, doc.C(), filter, update)
+	filter, audit, err := beginAudit(ctx, ds, doc, AuditUpdate, filter, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := requireMatch(ds.UpdateOne(ctx, doc.C(), filter, update))
+	if err == nil {
+		audit.finish(nil)
+	}
+	return result, err
 }
 
-func UpdateMany[T DocInter](ctx context.Context, doc T, filter bson.D, update bson.D) (int64, error) {
-	if dataStore == nil {
-		return 0, ErrNotConnected
+// UpdateMany updates all documents that match a given filter.
+// Models embedding Timestamps get `updatedAt` added to the $set stage.
+// Like reads, UpdateOne, UpdateMany and Upsert leave soft-deleted documents alone
+// unless ctx is wrapped with WithDeleted, so an Upsert then inserts a new document.
+// An Upsert by the _id of a soft-deleted document fails with ErrDuplicateKey.
+func UpdateMany[T DocInter](ctx context.Context, doc T, filter bson.D, update bson.D) (*WriteResult, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return nil, ErrNotConnected
+	}
+	update, err := beforeUpdate(ctx, doc, update)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTenantUpdate(ctx, doc, update); err != nil {
+		return nil, err
 	}
-	return dataStore.UpdateMany(ctx, doc.C(), filter, update)
+	filter, err = tenantFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, err
+	}
+	filter = scopeWrite(ctx, doc, filter)
+	filter, update, err = encryptWrite(ctx, doc, filter, stampUpdate(doc, update, nowFunc()))
+	if err != nil {
+		return nil, err
+	}
+	filter, audit, err := beginAudit(ctx, ds, doc, AuditUpdate, filter, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := ds.UpdateMany(ctx, doc.C(), filter, update)
+	if err == nil {
+		audit.finish(nil)
+	}
+	return result, writeError(err)
 }
 
-func (m *mongoStore) UpdateOne(ctx context.Context, collection string, filter bson.D, update bson.D) (int64, error) {
-	result, err := m.getCollection(collection).UpdateOne(ctx, filter, update)
+func (m *mongoStore) UpdateOne(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error) {
+	result, err := m.collection(ctx, collection).UpdateOne(ctx, filter, update)
 	if err != nil {
-		return 0, fmt.Errorf("%w: %v", ErrWriteFailed, err)
+		return nil, fmt.Errorf("%w: %w", ErrWriteFailed, err)
 	}
-	return result.ModifiedCount, nil
+	return newUpdateWriteResult(result), nil
 }
 
 // UpdateMany updates all documents that match a given filter.
-func (m *mongoStore) UpdateMany(ctx context.Context, collection string, filter bson.D, update bson.D) (int64, error) {
-	result, err := m.getCollection(collection).UpdateMany(ctx, filter, update)
+func (m *mongoStore) UpdateMany(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error) {
+	result, err := m.collection(ctx, collection).UpdateMany(ctx, filter, update)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWriteFailed, err)
+	}
+	return newUpdateWriteResult(result), nil
+}
+
+// Upsert updates the first document matching filter, or inserts one built from the
+// equality conditions of filter and the update when none matches.
+// The result's UpsertedID is set when a document was inserted.
+//
+// Models embedding Timestamps get `updatedAt` added to the $set stage and `createdAt`
+// to the $setOnInsert stage.
+func Upsert[T DocInter](ctx context.Context, doc T, filter bson.D, update bson.D) (*WriteResult, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return nil, ErrNotConnected
+	}
+	update, err := beforeUpdate(ctx, doc, update)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTenantUpdate(ctx, doc, update); err != nil {
+		return nil, err
+	}
+	scoped, err := tenantFilter(ctx, doc, filter)
+	if err != nil {
+		return nil, err
+	}
+	scoped = scopeWrite(ctx, doc, scoped)
+	scoped, update, err = encryptWrite(ctx, doc, scoped, stampUpsert(doc, update, nowFunc()))
+	if err != nil {
+		return nil, err
+	}
+	scoped, audit, err := beginAudit(ctx, ds, doc, AuditUpdate, scoped, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := ds.Upsert(ctx, doc.C(), scoped, update)
+	if err == nil {
+		audit.finish(result.UpsertedID)
+	}
+	return result, deletedUpsertError(ctx, doc, filter, writeError(err))
+}
+
+// ReplaceById replaces the whole document identified by doc's _id with doc.
+// The document is validated first. Since every field is written, doc should be loaded
+// before it is modified; models embedding Timestamps keep the loaded CreatedAt and get
+// a new UpdatedAt. It returns ErrNotFound when no document has that _id.
+func ReplaceById[T DocInter](ctx context.Context, doc T) (*WriteResult, error) {
+	ds := storeIn(ctx, doc)
+	if ds == nil {
+		return nil, ErrNotConnected
+	}
+	if err := stampTenant(ctx, doc); err != nil {
+		return nil, err
+	}
+	filter, err := tenantFilter(ctx, doc, bson.D{{Key: "_id", Value: doc.GetId()}})
+	if err != nil {
+		return nil, err
+	}
+	if err := validateDoc(doc); err != nil {
+		return nil, err
+	}
+	if ts, ok := any(doc).(timestamped); ok {
+		ts.touch(nowFunc(), false)
+	}
+	restore, err := encryptDoc(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+	filter, audit, err := beginAudit(ctx, ds, doc, AuditReplace, filter, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := requireMatch(ds.ReplaceOne(ctx, doc.C(), filter, doc))
+	if err == nil {
+		audit.finish(nil)
+	}
+	return result, err
+}
+
+func (m *mongoStore) Upsert(ctx context.Context, collection string, filter bson.D, update bson.D) (*WriteResult, error) {
+	result, err := m.collection(ctx, collection).UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWriteFailed, err)
+	}
+	return newUpdateWriteResult(result), nil
+}
+
+func (m *mongoStore) ReplaceOne(ctx context.Context, collection string, filter bson.D, doc DocInter) (*WriteResult, error) {
+	if err := checkNilDoc(doc); err != nil {
+		return nil, err
+	}
+	result, err := m.collection(ctx, collection).ReplaceOne(ctx, filter, doc)
 	if err != nil {
-		return 0, fmt.Errorf("%w: %v", ErrWriteFailed, err)
+		return nil, fmt.Errorf("%w: %w", ErrWriteFailed, err)
 	}
-	return result.ModifiedCount, nil
+	return newUpdateWriteResult(result), nil
 }
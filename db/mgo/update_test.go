@@ -43,25 +43,25 @@ func TestUpdateMany(t *testing.T) {
 		// Arrange
 		filter := bson.D{{Key: "age", Value: bson.D{{Key: "$gt", Value: 25}}}}
 		update := bson.D{{Key: "$set", Value: bson.D{{Key: "Name", Value: "Over 25"}}}}
-		expectedModifiedCount := int64(2)
+		expectedResult := &mgo.WriteResult{MatchedCount: 2, ModifiedCount: 2}
 
 		mockDB := &mgo.MockDatastore{
-			OnUpdateMany: func(ctx context.Context, collection string, f bson.D, u bson.D) (int64, error) {
+			OnUpdateMany: func(ctx context.Context, collection string, f bson.D, u bson.D) (*mgo.WriteResult, error) {
 				assert.Equal(t, "users", collection)
 				assert.Equal(t, filter, f)
 				assert.Equal(t, update, u)
-				return expectedModifiedCount, nil
+				return expectedResult, nil
 			},
 		}
 		restore := mgo.SetDatastore(mockDB)
 		defer restore()
 
 		// Act
-		modifiedCount, err := mgo.UpdateMany(context.Background(), &testUser{}, filter, update)
+		result, err := mgo.UpdateMany(context.Background(), &testUser{}, filter, update)
 
 		// Assert
 		assert.NoError(t, err)
-		assert.Equal(t, expectedModifiedCount, modifiedCount)
+		assert.Equal(t, expectedResult, result)
 	})
 
 	t.Run("Error from Datastore", func(t *testing.T) {
@@ -71,18 +71,18 @@ func TestUpdateMany(t *testing.T) {
 		expectedErr := errors.New("datastore update many failed")
 
 		mockDB := &mgo.MockDatastore{
-			OnUpdateMany: func(ctx context.Context, collection string, f bson.D, u bson.D) (int64, error) {
-				return 0, expectedErr
+			OnUpdateMany: func(ctx context.Context, collection string, f bson.D, u bson.D) (*mgo.WriteResult, error) {
+				return nil, expectedErr
 			},
 		}
 		restore := mgo.SetDatastore(mockDB)
 		defer restore()
 
 		// Act
-		modifiedCount, err := mgo.UpdateMany(context.Background(), &testUser{}, filter, update)
+		result, err := mgo.UpdateMany(context.Background(), &testUser{}, filter, update)
 
 		// Assert
-		assert.Zero(t, modifiedCount)
+		assert.Nil(t, result)
 		assert.Error(t, err)
 		assert.ErrorIs(t, err, expectedErr)
 	})
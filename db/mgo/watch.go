@@ -0,0 +1,211 @@
+package mgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Change stream operation types.
+const (
+	OperationInsert     = "insert"
+	OperationUpdate     = "update"
+	OperationReplace    = "replace"
+	OperationDelete     = "delete"
+	OperationDrop       = "drop"
+	OperationInvalidate = "invalidate"
+)
+
+// ChangeStream is the subset of *mongo.ChangeStream used by Watch.
+// It is an interface so that tests can feed events without a server.
+type ChangeStream interface {
+	Next(ctx context.Context) bool
+	Decode(val any) error
+	ResumeToken() bson.Raw
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// ChangeEvent is a change stream event whose full document is decoded into T.
+type ChangeEvent[T any] struct {
+	ID                bson.Raw           `bson:"_id"`
+	OperationType     string             `bson:"operationType"`
+	Namespace         ChangeNamespace    `bson:"ns"`
+	DocumentKey       bson.D             `bson:"documentKey"`
+	FullDocument      *T                 `bson:"fullDocument"`
+	UpdateDescription *UpdateDescription `bson:"updateDescription"`
+	ClusterTime       bson.Timestamp     `bson:"clusterTime"`
+}
+
+// ChangeNamespace identifies the database and collection of a change event.
+type ChangeNamespace struct {
+	DB   string `bson:"db"`
+	Coll string `bson:"coll"`
+}
+
+// UpdateDescription lists the fields changed by an update event.
+type UpdateDescription struct {
+	UpdatedFields bson.M   `bson:"updatedFields"`
+	RemovedFields []string `bson:"removedFields"`
+}
+
+// ResumeTokenStore persists change stream resume tokens so that a restarted consumer
+// continues where it left off.
+type ResumeTokenStore interface {
+	// Load returns the last saved token for key, or nil if there is none.
+	Load(ctx context.Context, key string) (bson.Raw, error)
+	// Save records token as the last processed position for key.
+	Save(ctx context.Context, key string, token bson.Raw) error
+}
+
+// WatchHandler processes a change event. Returning an error stops Watch; the event's
+// resume token is not saved, so it is delivered again after a restart.
+type WatchHandler[T any] func(ctx context.Context, event ChangeEvent[T]) error
+
+// WatchOption configures Watch.
+type WatchOption func(*watchConfig)
+
+type watchConfig struct {
+	pipeline     mongo.Pipeline
+	fullDocument options.FullDocument
+	store        ResumeTokenStore
+	key          string
+}
+
+// WithWatchPipeline filters or reshapes events with aggregation stages, e.g. a $match on operationType.
+func WithWatchPipeline(pipeline mongo.Pipeline) WatchOption {
+	return func(c *watchConfig) {
+		c.pipeline = pipeline
+	}
+}
+
+// WithFullDocument sets the fullDocument mode, e.g. options.UpdateLookup to receive
+// the current document with update events.
+func WithFullDocument(mode options.FullDocument) WatchOption {
+	return func(c *watchConfig) {
+		c.fullDocument = mode
+	}
+}
+
+// WithResumeTokenStore persists the resume token under key after each handled event
+// and resumes from it when Watch starts.
+func WithResumeTokenStore(store ResumeTokenStore, key string) WatchOption {
+	return func(c *watchConfig) {
+		c.store = store
+		c.key = key
+	}
+}
+
+// Watch opens a change stream and calls handler for every event until ctx is cancelled,
+// in which case it returns nil. An empty collection watches the whole database.
+//
+// Events are delivered at least once: the resume token is only saved after the handler succeeds.
+func Watch[T any](ctx context.Context, collection string, handler WatchHandler[T], opts ...WatchOption) error {
+	if dataStore == nil {
+		return ErrNotConnected
+	}
+	cfg := &watchConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	csOpts := options.ChangeStream()
+	if cfg.fullDocument != "" {
+		csOpts.SetFullDocument(cfg.fullDocument)
+	}
+	if cfg.store != nil {
+		token, err := cfg.store.Load(ctx, cfg.key)
+		if err != nil {
+			return fmt.Errorf("%w: load resume token: %w", ErrReadFailed, err)
+		}
+		if token != nil {
+			// StartAfter, unlike ResumeAfter, also resumes after an invalidate event.
+			csOpts.SetStartAfter(token)
+		}
+	}
+	pipeline := cfg.pipeline
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+
+	stream, err := dataStore.Watch(ctx, collection, pipeline, csOpts)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	defer func() { _ = stream.Close(context.WithoutCancel(ctx)) }()
+
+	for stream.Next(ctx) {
+		var event ChangeEvent[T]
+		if err := stream.Decode(&event); err != nil {
+			return fmt.Errorf("%w: %w", ErrReadFailed, err)
+		}
+		if err := handler(ctx, event); err != nil {
+			return err
+		}
+		if cfg.store != nil {
+			if err := cfg.store.Save(ctx, cfg.key, stream.ResumeToken()); err != nil {
+				return fmt.Errorf("%w: save resume token: %w", ErrWriteFailed, err)
+			}
+		}
+	}
+	if err := stream.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return nil
+}
+
+func (m *mongoStore) Watch(ctx context.Context, collection string, pipeline mongo.Pipeline, opts ...options.Lister[options.ChangeStreamOptions]) (ChangeStream, error) {
+	if collection == "" {
+		return m.db.Watch(ctx, pipeline, opts...)
+	}
+	return m.collection(ctx, collection).Watch(ctx, pipeline, opts...)
+}
+
+// mongoResumeTokenStore keeps resume tokens in a MongoDB collection, one document per key.
+type mongoResumeTokenStore struct {
+	collection string
+}
+
+// NewMongoResumeTokenStore returns a ResumeTokenStore backed by the named collection
+// of the current connection.
+func NewMongoResumeTokenStore(collection string) ResumeTokenStore {
+	return &mongoResumeTokenStore{collection: collection}
+}
+
+type resumeTokenRecord struct {
+	Key   string   `bson:"_id"`
+	Token bson.Raw `bson:"token"`
+}
+
+func (s *mongoResumeTokenStore) Load(ctx context.Context, key string) (bson.Raw, error) {
+	if dataStore == nil {
+		return nil, ErrNotConnected
+	}
+	var record resumeTokenRecord
+	err := dataStore.FindOne(ctx, s.collection, bson.D{{Key: "_id", Value: key}}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record.Token, nil
+}
+
+func (s *mongoResumeTokenStore) Save(ctx context.Context, key string, token bson.Raw) error {
+	if dataStore == nil {
+		return ErrNotConnected
+	}
+	_, err := dataStore.Upsert(ctx, s.collection,
+		bson.D{{Key: "_id", Value: key}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "token", Value: token},
+			{Key: FieldUpdatedAt, Value: nowFunc()},
+		}}},
+	)
+	return err
+}
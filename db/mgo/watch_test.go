@@ -0,0 +1,132 @@
+package mgo_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/arwoosa/vulpes/db/mgo"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// memoryTokenStore is an in-memory ResumeTokenStore.
+type memoryTokenStore struct {
+	tokens map[string]bson.Raw
+}
+
+func (s *memoryTokenStore) Load(ctx context.Context, key string) (bson.Raw, error) {
+	return s.tokens[key], nil
+}
+
+func (s *memoryTokenStore) Save(ctx context.Context, key string, token bson.Raw) error {
+	s.tokens[key] = token
+	return nil
+}
+
+func changeEvent(n int32, title string) bson.D {
+	return bson.D{
+		{Key: "_id", Value: bson.D{{Key: "_data", Value: n}}},
+		{Key: "operationType", Value: mgo.OperationInsert},
+		{Key: "ns", Value: bson.D{{Key: "db", Value: "app"}, {Key: "coll", Value: "articles"}}},
+		{Key: "fullDocument", Value: bson.D{{Key: "title", Value: title}}},
+	}
+}
+
+func resumeToken(n int32) bson.Raw {
+	raw, _ := bson.Marshal(bson.D{{Key: "_data", Value: n}})
+	return raw
+}
+
+func TestWatch(t *testing.T) {
+	t.Run("Not connected", func(t *testing.T) {
+		restore := mgo.SetDatastore(nil)
+		defer restore()
+		err := mgo.Watch(context.Background(), "articles", func(ctx context.Context, e mgo.ChangeEvent[testArticle]) error { return nil })
+		assert.ErrorIs(t, err, mgo.ErrNotConnected)
+	})
+
+	t.Run("Delivers events and saves tokens", func(t *testing.T) {
+		mockDB := &mgo.MockDatastore{OnWatch: mgo.NewOnWatchMock(changeEvent(1, "first"), changeEvent(2, "second"))}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		store := &memoryTokenStore{tokens: map[string]bson.Raw{}}
+		var titles []string
+		err := mgo.Watch(context.Background(), "articles", func(ctx context.Context, e mgo.ChangeEvent[testArticle]) error {
+			assert.Equal(t, mgo.OperationInsert, e.OperationType)
+			assert.Equal(t, "articles", e.Namespace.Coll)
+			titles = append(titles, e.FullDocument.Title)
+			return nil
+		}, mgo.WithResumeTokenStore(store, "search-indexer"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"first", "second"}, titles)
+		assert.Equal(t, resumeToken(2), store.tokens["search-indexer"])
+	})
+
+	t.Run("Resumes from the stored token", func(t *testing.T) {
+		store := &memoryTokenStore{tokens: map[string]bson.Raw{"search-indexer": resumeToken(7)}}
+		mockDB := &mgo.MockDatastore{
+			OnWatch: func(ctx context.Context, collection string, pipeline mongo.Pipeline, opts ...options.Lister[options.ChangeStreamOptions]) (mgo.ChangeStream, error) {
+				applied := &options.ChangeStreamOptions{}
+				for _, o := range opts {
+					for _, set := range o.List() {
+						assert.NoError(t, set(applied))
+					}
+				}
+				assert.Equal(t, resumeToken(7), applied.StartAfter)
+				assert.Equal(t, options.UpdateLookup, *applied.FullDocument)
+				assert.Len(t, pipeline, 1)
+				return mgo.NewOnWatchMock()(ctx, collection, pipeline)
+			},
+		}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		err := mgo.Watch(context.Background(), "articles",
+			func(ctx context.Context, e mgo.ChangeEvent[testArticle]) error { return nil },
+			mgo.WithResumeTokenStore(store, "search-indexer"),
+			mgo.WithFullDocument(options.UpdateLookup),
+			mgo.WithWatchPipeline(mongo.Pipeline{{{Key: "$match", Value: bson.D{{Key: "operationType", Value: "insert"}}}}}),
+		)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Handler error keeps the token", func(t *testing.T) {
+		mockDB := &mgo.MockDatastore{OnWatch: mgo.NewOnWatchMock(changeEvent(1, "first"), changeEvent(2, "second"))}
+		restore := mgo.SetDatastore(mockDB)
+		defer restore()
+
+		store := &memoryTokenStore{tokens: map[string]bson.Raw{}}
+		errHandler := errors.New("index unavailable")
+		err := mgo.Watch(context.Background(), "articles", func(ctx context.Context, e mgo.ChangeEvent[testArticle]) error {
+			if e.FullDocument.Title == "second" {
+				return errHandler
+			}
+			return nil
+		}, mgo.WithResumeTokenStore(store, "search-indexer"))
+
+		assert.ErrorIs(t, err, errHandler)
+		assert.Equal(t, resumeToken(1), store.tokens["search-indexer"])
+	})
+}
+
+func TestMongoResumeTokenStore(t *testing.T) {
+	defer mgo.SetDatastore(mgo.NewMemoryDatastore())()
+	ctx := context.Background()
+	store := mgo.NewMongoResumeTokenStore("resume_tokens")
+
+	token, err := store.Load(ctx, "search-indexer")
+	assert.NoError(t, err)
+	assert.Nil(t, token)
+
+	assert.NoError(t, store.Save(ctx, "search-indexer", resumeToken(1)))
+	assert.NoError(t, store.Save(ctx, "search-indexer", resumeToken(2)))
+	token, err = store.Load(ctx, "search-indexer")
+	assert.NoError(t, err)
+	assert.Equal(t, resumeToken(2), token)
+}
@@ -16,8 +16,14 @@ var (
 
 	queues = make(map[string]amqp.Queue) // 存已宣告的 queue
 	mu     sync.RWMutex
+
+	confirmChannel *amqp.Channel // publisher confirm 專用 channel
+	confirmMu      sync.Mutex
 )
 
+// ErrNotConfirmed 表示 broker 拒絕 (nack) 了訊息
+var ErrNotConfirmed = errors.New("message not confirmed by broker")
+
 // Init 建立連線與 channel (全域)
 func Init(url string) error {
 	var err error
@@ -35,6 +41,12 @@ func Init(url string) error {
 
 // Close 關閉全域連線
 func Close() {
+	confirmMu.Lock()
+	if confirmChannel != nil {
+		_ = confirmChannel.Close()
+		confirmChannel = nil // 之後的 SendConfirm 會在重新 Init 後建立新的 channel
+	}
+	confirmMu.Unlock()
 	if channel != nil {
 		_ = channel.Close()
 	}
@@ -86,6 +98,68 @@ func Send(queue string, body string) error {
 		})
 }
 
+// SendConfirm 發送訊息並等待 broker 確認 (publisher confirms)
+// 只有在 broker 接收 (ack) 後才回傳 nil，適合需要 at-least-once 的場景 (例如 outbox relay)
+func SendConfirm(ctx context.Context, queue string, body string) error {
+	mu.RLock()
+	_, ok := queues[queue]
+	mu.RUnlock()
+	if !ok {
+		return errors.New("queue not declared: " + queue)
+	}
+
+	ch, err := getConfirmChannel()
+	if err != nil {
+		return err
+	}
+
+	dc, err := ch.PublishWithDeferredConfirmWithContext(ctx,
+		"",    // exchange
+		queue, // routing key
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:  "text/plain",
+			DeliveryMode: amqp.Persistent,
+			Body:         []byte(body),
+		})
+	if err != nil {
+		return err
+	}
+
+	acked, err := dc.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return ErrNotConfirmed
+	}
+	return nil
+}
+
+// getConfirmChannel 取得 (必要時重新建立) confirm 模式的 channel
+func getConfirmChannel() (*amqp.Channel, error) {
+	confirmMu.Lock()
+	defer confirmMu.Unlock()
+
+	if confirmChannel != nil && !confirmChannel.IsClosed() {
+		return confirmChannel, nil
+	}
+	if conn == nil {
+		return nil, errors.New("rabbitmq not initialized")
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+	confirmChannel = ch
+	return ch, nil
+}
+
 // Consume 消費訊息
 func Consume(queue string, handler func(msg string) error) error {
 	mu.RLock()